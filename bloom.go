@@ -0,0 +1,139 @@
+package flexdb
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+)
+
+const (
+	// bloomBitsPerID sizes the filter for about a 1% false positive rate
+	bloomBitsPerID = 10
+	// bloomHashes is the number of bit positions set per ID
+	bloomHashes = 7
+	// bloomMinCapacity is the smallest number of IDs a filter is sized for
+	bloomMinCapacity = 1024
+)
+
+// bloomFilter records the IDs of an entity type so lookups of IDs that were
+// never stored can be answered without taking the database lock. Deleted IDs
+// stay in the filter until it is rebuilt, which only costs a normal lookup.
+type bloomFilter struct {
+	bits     []atomic.Uint64
+	capacity int64
+	added    atomic.Int64
+}
+
+// newBloomFilter returns an empty filter sized for capacity IDs
+func newBloomFilter(capacity int) *bloomFilter {
+	if capacity < bloomMinCapacity {
+		capacity = bloomMinCapacity
+	}
+	words := (capacity*bloomBitsPerID + 63) / 64
+	return &bloomFilter{bits: make([]atomic.Uint64, words), capacity: int64(capacity)}
+}
+
+// positions calls fn with each bit position of id, using double hashing
+func (f *bloomFilter) positions(id string, fn func(word int, mask uint64) bool) {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	sum := h.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)|1
+	m := uint32(len(f.bits) * 64)
+	for i := uint32(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % m
+		if !fn(int(bit/64), 1<<(bit%64)) {
+			return
+		}
+	}
+}
+
+// add records id in the filter
+func (f *bloomFilter) add(id string) {
+	f.positions(id, func(word int, mask uint64) bool {
+		for {
+			old := f.bits[word].Load()
+			if old&mask != 0 || f.bits[word].CompareAndSwap(old, old|mask) {
+				return true
+			}
+		}
+	})
+	f.added.Add(1)
+}
+
+// mayContain reports false only when id was never added
+func (f *bloomFilter) mayContain(id string) bool {
+	found := true
+	f.positions(id, func(word int, mask uint64) bool {
+		if f.bits[word].Load()&mask == 0 {
+			found = false
+		}
+		return found
+	})
+	return found
+}
+
+// EnableBloomFilter keeps a bloom filter over the IDs of an entity type so
+// Get and Has skip the lock and map lookups for IDs that were never stored.
+// The filter grows as IDs are added and is worth enabling for large types
+// that see many lookups of missing IDs.
+func (db *Database) EnableBloomFilter(entityType string) {
+	entityType = db.typeName(entityType)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.rebuildBloom(entityType)
+}
+
+// rebuildBloom replaces the filter of an entity type with one built from the
+// committed IDs, sized for twice as many. The caller must hold the write lock.
+func (db *Database) rebuildBloom(entityType string) {
+	entities := db.data[entityType]
+	filter := newBloomFilter(2 * len(entities))
+	for id := range entities {
+		filter.add(id)
+	}
+	db.blooms.Store(entityType, filter)
+}
+
+// bloomAdd records a committed ID in the filter of its type, if it has one,
+// rebuilding the filter once it holds more IDs than it was sized for. The
+// caller must hold the write lock.
+func (db *Database) bloomAdd(entityType, id string) {
+	value, ok := db.blooms.Load(entityType)
+	if !ok {
+		return
+	}
+	filter := value.(*bloomFilter)
+	filter.add(id)
+	if filter.added.Load() > filter.capacity {
+		db.rebuildBloom(entityType)
+	}
+}
+
+// definitelyAbsent reports whether the filter of an entity type rules out id
+func (db *Database) definitelyAbsent(entityType, id string) bool {
+	value, ok := db.blooms.Load(entityType)
+	return ok && !value.(*bloomFilter).mayContain(id)
+}
+
+// Has reports whether an entity exists, including changes in this transaction
+func (tx *Transaction) Has(entityType, id string) bool {
+	entityType = tx.db.typeName(entityType)
+
+	if changedEntities, ok := tx.changes[entityType]; ok {
+		if entity, ok := changedEntities[id]; ok {
+			return entity != nil
+		}
+	}
+	if !tx.db.definitelyAbsent(entityType, id) {
+		if _, ok := tx.db.getCommitted(entityType, id); ok {
+			return true
+		}
+	}
+	if loader := tx.db.collectionConfig(entityType).loader; loader != nil {
+		_, ok := tx.db.loadThrough(entityType, id, loader)
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package flexdb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "existing", Name: "before"})
+	tx.Commit()
+
+	db.EnableBloomFilter("test")
+
+	// Enough IDs to force the filter to grow past its initial size
+	tx = db.Transact(false)
+	for i := 0; i < 3000; i++ {
+		tx.Set("test", &TestEntity{ID: fmt.Sprint("new-", i)})
+	}
+	tx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+	for _, id := range []string{"existing", "new-0", "new-2999"} {
+		if _, ok := readTx.Get("test", id); !ok {
+			t.Errorf("Expected %s to be found", id)
+		}
+		if !readTx.Has("test", id) {
+			t.Errorf("Expected Has(%s) to be true", id)
+		}
+	}
+	if _, ok := readTx.Get("test", "missing"); ok || readTx.Has("test", "missing") {
+		t.Error("Expected a missing ID not to be found")
+	}
+
+	// Deleted IDs stay in the filter but still read as absent
+	tx = db.Transact(false)
+	tx.Delete("test", "existing")
+	tx.Commit()
+	afterDelete := db.Transact(true)
+	defer afterDelete.Rollback()
+	if afterDelete.Has("test", "existing") {
+		t.Error("Expected a deleted ID not to be found")
+	}
+}
+
+// BenchmarkNegativeGet looks up IDs that do not exist in a large collection
+func BenchmarkNegativeGet(b *testing.B) {
+	for _, bloom := range []bool{false, true} {
+		b.Run(fmt.Sprintf("bloom=%v", bloom), func(b *testing.B) {
+			dbPath := "./bench_db.json"
+			defer os.Remove(dbPath)
+
+			db, _ := NewDatabase(dbPath, WithSyncMode(SyncNever))
+			tx := db.Transact(false)
+			for i := 0; i < 10000; i++ {
+				tx.Set("test", &TestEntity{ID: fmt.Sprint(i)})
+			}
+			tx.Commit()
+			if bloom {
+				db.EnableBloomFilter("test")
+			}
+
+			readTx := db.Transact(true)
+			defer readTx.Rollback()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				readTx.Get("test", "missing")
+			}
+		})
+	}
+}
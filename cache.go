@@ -0,0 +1,242 @@
+package flexdb
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// Cache is the backend used to cache committed entities by key. The default
+// is an in-process cache; WithCacheBackend plugs in another implementation,
+// such as a shared cache or NoCache. Implementations must be safe for
+// concurrent use.
+type Cache interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{})
+	Delete(key string)
+	Flush()
+}
+
+// CacheKeyLister is implemented by caches that can list their keys. It lets
+// RebuildCache drop stale entries of one type instead of flushing everything.
+type CacheKeyLister interface {
+	Keys() []string
+}
+
+// CacheStats reports how a cache is being used
+type CacheStats struct {
+	Items     int
+	Hits      int64
+	Misses    int64
+	Evictions int64
+}
+
+// CacheStatsReporter is implemented by caches that track usage statistics
+type CacheStatsReporter interface {
+	Stats() CacheStats
+}
+
+// WithCacheBackend replaces the default in-process entity cache
+func WithCacheBackend(c Cache) Option {
+	return func(db *Database) {
+		db.cache = c
+	}
+}
+
+// NoCache is a Cache that stores nothing, so every read goes to the data
+var NoCache Cache = noCache{}
+
+type noCache struct{}
+
+func (noCache) Get(string) (interface{}, bool) { return nil, false }
+func (noCache) Set(string, interface{})        {}
+func (noCache) Delete(string)                  {}
+func (noCache) Flush()                         {}
+
+// memoryCache is the default Cache backed by go-cache
+type memoryCache struct {
+	c      *cache.Cache
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{c: cache.New(5*time.Minute, 10*time.Minute)}
+}
+
+func (m *memoryCache) Get(key string) (interface{}, bool) {
+	value, ok := m.c.Get(key)
+	if ok {
+		m.hits.Add(1)
+	} else {
+		m.misses.Add(1)
+	}
+	return value, ok
+}
+func (m *memoryCache) Set(key string, value interface{}) {
+	m.c.Set(key, value, cache.DefaultExpiration)
+}
+func (m *memoryCache) Delete(key string) { m.c.Delete(key) }
+func (m *memoryCache) Flush()            { m.c.Flush() }
+
+func (m *memoryCache) Stats() CacheStats {
+	return CacheStats{Items: m.c.ItemCount(), Hits: m.hits.Load(), Misses: m.misses.Load()}
+}
+
+func (m *memoryCache) Keys() []string {
+	items := m.c.Items()
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// WithCacheMaxItems replaces the default cache with one holding at most n
+// entities, evicting the least recently used entry once it is full. Unlike
+// the default cache, entries do not expire with time.
+func WithCacheMaxItems(n int) Option {
+	return func(db *Database) {
+		db.cache = newLRUCache(n)
+	}
+}
+
+// lruCache is a Cache bounded to a fixed number of items with LRU eviction
+type lruCache struct {
+	mu        sync.Mutex
+	max       int
+	order     *list.List // front is most recently used
+	items     map[string]*list.Element
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+// lruEntry is the value held by each element of lruCache.order
+type lruEntry struct {
+	key   string
+	value interface{}
+}
+
+func newLRUCache(max int) *lruCache {
+	return &lruCache{max: max, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (l *lruCache) Get(key string) (interface{}, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.items[key]
+	if !ok {
+		l.misses++
+		return nil, false
+	}
+	l.hits++
+	l.order.MoveToFront(el)
+	return el.Value.(*lruEntry).value, true
+}
+
+func (l *lruCache) Set(key string, value interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		el.Value.(*lruEntry).value = value
+		l.order.MoveToFront(el)
+		return
+	}
+	l.items[key] = l.order.PushFront(&lruEntry{key: key, value: value})
+	for l.max > 0 && l.order.Len() > l.max {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*lruEntry).key)
+		l.evictions++
+	}
+}
+
+func (l *lruCache) Delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		l.order.Remove(el)
+		delete(l.items, key)
+	}
+}
+
+func (l *lruCache) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.order.Init()
+	l.items = make(map[string]*list.Element)
+}
+
+func (l *lruCache) Keys() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	keys := make([]string, 0, len(l.items))
+	for key := range l.items {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (l *lruCache) Stats() CacheStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return CacheStats{Items: len(l.items), Hits: l.hits, Misses: l.misses, Evictions: l.evictions}
+}
+
+// CacheStats returns the usage statistics of the entity cache. Backends that
+// do not implement CacheStatsReporter report zero values.
+func (db *Database) CacheStats() CacheStats {
+	if reporter, ok := db.cache.(CacheStatsReporter); ok {
+		return reporter.Stats()
+	}
+	return CacheStats{}
+}
+
+// FlushCache removes every cached entity. Subsequent reads repopulate the
+// cache from committed data.
+func (db *Database) FlushCache() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.cache.Flush()
+}
+
+// RebuildCache replaces the cached entries for an entity type with its
+// committed data, dropping any stale entries in the process. Caches that do
+// not implement CacheKeyLister are flushed entirely first. It returns the
+// number of entities cached.
+func (db *Database) RebuildCache(entityType string) int {
+	entityType = db.typeName(entityType)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if lister, ok := db.cache.(CacheKeyLister); ok {
+		// The prefix can also match types whose name extends this one; evicting
+		// their entries only costs a cache miss
+		prefix := getCacheKey(entityType, "")
+		for _, key := range lister.Keys() {
+			if strings.HasPrefix(key, prefix) {
+				db.cache.Delete(key)
+			}
+		}
+	} else {
+		db.cache.Flush()
+	}
+
+	for id, entity := range db.data[entityType] {
+		db.cache.Set(getCacheKey(entityType, id), entity)
+	}
+	return len(db.data[entityType])
+}
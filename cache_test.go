@@ -0,0 +1,139 @@
+package flexdb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFlushAndRebuildCache(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "Cached"})
+	tx.Set("test", &TestEntity{ID: "2", Name: "Also cached"})
+	tx.Commit()
+
+	db.FlushCache()
+	if keys := db.cache.(CacheKeyLister).Keys(); len(keys) != 0 {
+		t.Fatalf("Expected an empty cache after flush, got %v", keys)
+	}
+
+	readTx := db.Transact(true)
+	if _, ok := readTx.Get("test", "1"); !ok {
+		t.Fatal("Expected Get to fall back to committed data")
+	}
+	readTx.Rollback()
+	if _, found := db.cache.Get(getCacheKey("test", "1")); !found {
+		t.Error("Expected Get to repopulate the cache")
+	}
+
+	// A stale entry is replaced by the committed value
+	db.cache.Set(getCacheKey("test", "2"), &TestEntity{ID: "2", Name: "Stale"})
+	db.cache.Set(getCacheKey("test", "3"), &TestEntity{ID: "3", Name: "Ghost"})
+	if n := db.RebuildCache("test"); n != 2 {
+		t.Errorf("Expected 2 entities cached, got %d", n)
+	}
+	cached, _ := db.cache.Get(getCacheKey("test", "2"))
+	if cached.(*TestEntity).Name != "Also cached" {
+		t.Errorf("Expected rebuilt entry, got %v", cached)
+	}
+	if _, found := db.cache.Get(getCacheKey("test", "3")); found {
+		t.Error("Expected entries without committed data to be dropped")
+	}
+}
+
+// countingCache is a stub Cache that records lookups
+type countingCache struct {
+	entries map[string]interface{}
+	gets    int
+}
+
+func (c *countingCache) Get(key string) (interface{}, bool) {
+	c.gets++
+	v, ok := c.entries[key]
+	return v, ok
+}
+func (c *countingCache) Set(key string, value interface{}) { c.entries[key] = value }
+func (c *countingCache) Delete(key string)                 { delete(c.entries, key) }
+func (c *countingCache) Flush()                            { c.entries = make(map[string]interface{}) }
+
+func TestCacheBackend(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	stub := &countingCache{entries: make(map[string]interface{})}
+	db, _ := NewDatabase(dbPath, WithCacheBackend(stub))
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "Cached"})
+	tx.Commit()
+
+	if _, ok := stub.entries[getCacheKey("test", "1")]; !ok {
+		t.Error("Expected Commit to populate the cache backend")
+	}
+
+	// A value only present in the backend is served from it
+	stub.entries[getCacheKey("test", "1")] = &TestEntity{ID: "1", Name: "From cache"}
+	readTx := db.Transact(true)
+	entity, _ := readTx.Get("test", "1")
+	readTx.Rollback()
+	if stub.gets == 0 || entity.(*TestEntity).Name != "From cache" {
+		t.Errorf("Expected Get to consult the cache backend, got %v after %d gets", entity, stub.gets)
+	}
+
+	// Without key listing, RebuildCache flushes and refills
+	stub.entries["test:ghost"] = &TestEntity{ID: "ghost"}
+	db.RebuildCache("test")
+	if _, ok := stub.entries["test:ghost"]; ok {
+		t.Error("Expected RebuildCache to drop stale entries")
+	}
+
+	noCacheDB, _ := NewDatabase(dbPath, WithCacheBackend(NoCache))
+	readTx = noCacheDB.Transact(true)
+	defer readTx.Rollback()
+	if _, ok := readTx.Get("test", "1"); !ok {
+		t.Error("Expected reads to work without a cache")
+	}
+}
+
+func TestCacheMaxItemsEvictsLeastRecentlyUsed(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath, WithCacheMaxItems(2))
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "One"})
+	tx.Set("test", &TestEntity{ID: "2", Name: "Two"})
+	tx.Commit()
+
+	// Touching 1 makes 2 the oldest entry
+	if _, found := db.cache.Get(getCacheKey("test", "1")); !found {
+		t.Fatal("Expected entity 1 to be cached")
+	}
+
+	tx = db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "3", Name: "Three"})
+	tx.Commit()
+
+	if _, found := db.cache.Get(getCacheKey("test", "2")); found {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+	for _, id := range []string{"1", "3"} {
+		if _, found := db.cache.Get(getCacheKey("test", id)); !found {
+			t.Errorf("Expected entity %s to remain cached", id)
+		}
+	}
+
+	stats := db.CacheStats()
+	if stats.Items != 2 || stats.Evictions != 1 {
+		t.Errorf("Expected 2 items and 1 eviction, got %+v", stats)
+	}
+
+	// Evicted entities are still served from committed data
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+	if _, ok := readTx.Get("test", "2"); !ok {
+		t.Error("Expected evicted entity to be readable")
+	}
+}
@@ -0,0 +1,94 @@
+package flexdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// checksumField holds the CRC32 of a record written with WithChecksums
+const checksumField = "_flexdb_checksum"
+
+// ChecksumError reports a record whose stored checksum does not match its contents
+type ChecksumError struct {
+	EntityType string
+	ID         string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch for %s/%s", e.EntityType, e.ID)
+}
+
+// WithChecksums stores a CRC32 checksum with every record saved. Records
+// that carry a checksum are verified on load whether or not the option is
+// set, and a mismatch fails the load with a ChecksumError per record instead
+// of loading corrupt data.
+func WithChecksums() Option {
+	return func(db *Database) {
+		db.checksums = true
+	}
+}
+
+// withChecksums returns the data as field maps with a checksum added to each record
+func withChecksums(data map[string]map[string]Entity) (map[string]map[string]Entity, error) {
+	docs, err := toDocuments(data)
+	if err != nil {
+		return nil, err
+	}
+	summed := make(map[string]map[string]Entity, len(docs))
+	for entityType, entities := range docs {
+		summed[entityType] = make(map[string]Entity, len(entities))
+		for id, doc := range entities {
+			// Checksum the record exactly as it is written, ID key included
+			raw, err := (&GenericEntity{ID: id, Fields: doc}).MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			var written map[string]interface{}
+			if err := decodeJSON(raw, &written); err != nil {
+				return nil, err
+			}
+			sum, err := checksum(written)
+			if err != nil {
+				return nil, err
+			}
+			written[checksumField] = sum
+			summed[entityType][id] = &GenericEntity{ID: id, Fields: written}
+		}
+	}
+	return summed, nil
+}
+
+// verifyChecksums checks and strips the checksums of decoded records,
+// returning a ChecksumError for every record that does not match
+func verifyChecksums(docs map[string]map[string]map[string]interface{}) error {
+	var errs []error
+	for entityType, entities := range docs {
+		for id, doc := range entities {
+			stored, ok := doc[checksumField]
+			if !ok {
+				continue
+			}
+			delete(doc, checksumField)
+			sum, err := checksum(doc)
+			if err != nil {
+				return err
+			}
+			if stored != sum {
+				errs = append(errs, &ChecksumError{EntityType: entityType, ID: id})
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checksum returns the CRC32 of a record's canonical JSON encoding. Map keys
+// are sorted by encoding/json, so equal records always hash the same.
+func checksum(doc map[string]interface{}) (string, error) {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE(raw)), nil
+}
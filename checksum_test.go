@@ -0,0 +1,48 @@
+package flexdb
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestChecksums(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath, WithChecksums())
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "Alice", Value: 1})
+	tx.Set("test", &TestEntity{ID: "2", Name: "Bob", Value: 2})
+	tx.Set("doc", &GenericEntity{ID: "d1", Fields: map[string]interface{}{"ratio": 0.1, "tags": []interface{}{"a", "b"}}})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	reloaded, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Expected an intact file to load, got %v", err)
+	}
+	e, _ := reloaded.Get("test", "1")
+	if _, ok := e.(*GenericEntity).Fields[checksumField]; ok {
+		t.Error("Expected the checksum to be stripped on load")
+	}
+
+	// Flip one byte inside Alice's record
+	data, _ := os.ReadFile(dbPath)
+	corrupted := bytes.Replace(data, []byte(`"Alice"`), []byte(`"Alicf"`), 1)
+	if bytes.Equal(corrupted, data) {
+		t.Fatal("Expected to find the record to corrupt")
+	}
+	os.WriteFile(dbPath, corrupted, 0644)
+
+	_, err = NewDatabase(dbPath)
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("Expected a ChecksumError, got %v", err)
+	}
+	if checksumErr.EntityType != "test" || checksumErr.ID != "1" {
+		t.Errorf("Expected test/1 to be flagged, got %s/%s", checksumErr.EntityType, checksumErr.ID)
+	}
+}
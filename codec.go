@@ -0,0 +1,193 @@
+package flexdb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// codecHeaderPrefix starts the header line of files written with a codec other than JSON
+const codecHeaderPrefix = "FLEXDB:"
+
+// Codec encodes and decodes the database file. Decoded entities are returned
+// as field maps keyed by entity type and ID.
+type Codec interface {
+	Name() string
+	Encode(data map[string]map[string]Entity) ([]byte, error)
+	Decode(data []byte) (map[string]map[string]map[string]interface{}, error)
+}
+
+var (
+	// JSONCodec stores the database as indented JSON. It is the default and
+	// writes no header, so files stay plain JSON.
+	JSONCodec Codec = jsonCodec{escapeHTML: true, indent: "  "}
+	// GobCodec stores the database using encoding/gob
+	GobCodec Codec = gobCodec{}
+)
+
+var builtinCodecs = map[string]Codec{
+	JSONCodec.Name(): JSONCodec,
+	GobCodec.Name():  GobCodec,
+}
+
+func init() {
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+	gob.Register(json.Number(""))
+}
+
+// WithCodec selects the codec used to save the database. Files are always
+// loaded with the codec they were written in, and without this option the
+// database keeps saving in that codec.
+func WithCodec(codec Codec) Option {
+	return func(db *Database) {
+		db.codec = codec
+	}
+}
+
+type jsonCodec struct {
+	escapeHTML bool
+	indent     string
+}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (c jsonCodec) Encode(data map[string]map[string]Entity) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(c.escapeHTML)
+	enc.SetIndent("", c.indent)
+	if err := enc.Encode(data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (jsonCodec) Decode(data []byte) (map[string]map[string]map[string]interface{}, error) {
+	var docs map[string]map[string]map[string]interface{}
+	if err := decodeJSON(data, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Encode(data map[string]map[string]Entity) ([]byte, error) {
+	docs, err := toDocuments(data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(docs); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Decode(data []byte) (map[string]map[string]map[string]interface{}, error) {
+	var docs map[string]map[string]map[string]interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// toDocuments converts entities into plain field maps using their JSON encoding
+func toDocuments(data map[string]map[string]Entity) (map[string]map[string]map[string]interface{}, error) {
+	docs := make(map[string]map[string]map[string]interface{}, len(data))
+	for entityType, entities := range data {
+		docs[entityType] = make(map[string]map[string]interface{}, len(entities))
+		for id, entity := range entities {
+			raw, err := json.Marshal(entity)
+			if err != nil {
+				return nil, err
+			}
+			var doc map[string]interface{}
+			if err := decodeJSON(raw, &doc); err != nil {
+				return nil, err
+			}
+			docs[entityType][id] = doc
+		}
+	}
+	return docs, nil
+}
+
+// saveCodec returns the codec used to save, applying the JSON options to the default codec
+func (db *Database) saveCodec() Codec {
+	if db.codec == nil || db.codec.Name() == JSONCodec.Name() {
+		return jsonCodec{escapeHTML: db.escapeHTML, indent: db.indent}
+	}
+	return db.codec
+}
+
+// encode serializes the database contents, prefixing a header for non-JSON codecs
+func (db *Database) encode() ([]byte, error) {
+	return db.encodeData(db.persistedData())
+}
+
+// encodeData serializes data with the save codec
+func (db *Database) encodeData(data map[string]map[string]Entity) ([]byte, error) {
+	data = db.withEntityCodecs(data)
+	if db.checksums {
+		summed, err := withChecksums(data)
+		if err != nil {
+			return nil, err
+		}
+		data = summed
+	}
+	codec := db.saveCodec()
+	body, err := codec.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+	if codec.Name() == JSONCodec.Name() {
+		return body, nil
+	}
+	return append([]byte(codecHeaderPrefix+codec.Name()+"\n"), body...), nil
+}
+
+// decode detects the codec a file was written in from its header and decodes it
+func (db *Database) decode(data []byte) (map[string]map[string]map[string]interface{}, error) {
+	if !bytes.HasPrefix(data, []byte(codecHeaderPrefix)) {
+		return JSONCodec.Decode(data)
+	}
+
+	header, body, _ := bytes.Cut(data, []byte("\n"))
+	name := string(header[len(codecHeaderPrefix):])
+	codec := builtinCodecs[name]
+	if db.codec != nil && db.codec.Name() == name {
+		codec = db.codec
+	}
+	if codec == nil {
+		return nil, fmt.Errorf("unknown codec %q in database file", name)
+	}
+	// Without an explicit codec, keep saving in the format the file was written in
+	if db.codec == nil {
+		db.codec = codec
+	}
+	return codec.Decode(body)
+}
+
+// ConvertCodec rewrites the database file with a different codec and uses
+// it for all later saves. The file is replaced atomically.
+func (db *Database) ConvertCodec(newCodec Codec) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	previous := db.codec
+	db.codec = newCodec
+	data, err := db.encode()
+	if err != nil {
+		db.codec = previous
+		return err
+	}
+	if err := db.writeStorage(db.path, data, true); err != nil {
+		db.codec = previous
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package flexdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestConvertCodec(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	writeTx := db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "1", Name: "Alice", Value: 30})
+	writeTx.Set("test", &GenericEntity{ID: "2", Fields: map[string]interface{}{"Name": "Bob", "Tags": []interface{}{"a", "b"}}})
+	writeTx.Commit()
+
+	data, _ := os.ReadFile(dbPath)
+	if !json.Valid(data) {
+		t.Fatalf("Expected a plain JSON file before conversion, got %q", data)
+	}
+
+	if err := db.ConvertCodec(GobCodec); err != nil {
+		t.Fatalf("ConvertCodec failed: %v", err)
+	}
+
+	data, _ = os.ReadFile(dbPath)
+	if !bytes.HasPrefix(data, []byte("FLEXDB:gob\n")) {
+		t.Fatalf("Expected gob header, got %q", data[:20])
+	}
+
+	reloaded, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to load gob database: %v", err)
+	}
+	readTx := reloaded.Transact(true)
+	alice, ok := readTx.Get("test", "1")
+	if name, _ := getField(alice, "Name"); !ok || name != "Alice" {
+		t.Errorf("Unexpected entity after conversion: %v", alice)
+	}
+	bob, _ := readTx.Get("test", "2")
+	if tags, _ := getField(bob, "Tags"); len(tags.([]interface{})) != 2 {
+		t.Errorf("Unexpected nested value after conversion: %v", tags)
+	}
+	readTx.Rollback()
+
+	// The reloaded database keeps saving in gob
+	writeTx = reloaded.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "3", Name: "Charlie", Value: 35})
+	if err := writeTx.Commit(); err != nil {
+		t.Fatalf("Failed to commit to gob database: %v", err)
+	}
+	data, _ = os.ReadFile(dbPath)
+	if !bytes.HasPrefix(data, []byte("FLEXDB:gob\n")) {
+		t.Error("Expected the reloaded database to keep the gob codec")
+	}
+}
@@ -0,0 +1,370 @@
+package flexdb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ErrUniqueViolation is returned when a write would duplicate a unique field value
+var ErrUniqueViolation = errors.New("unique constraint violation")
+
+// ErrMissingFields is returned when a GenericEntity lacks fields required by SetRequiredFields
+var ErrMissingFields = errors.New("missing required fields")
+
+// ErrAppendOnly is returned when updating or deleting an entity of an append-only type
+var ErrAppendOnly = errors.New("append-only collection")
+
+// CollectionConfig bundles the configuration of a single entity type
+type CollectionConfig struct {
+	// Indexes lists the fields to index for faster querying
+	Indexes []string
+	// Unique lists fields whose values must not repeat across the collection
+	Unique []string
+	// Enums restricts fields to a fixed set of allowed values
+	Enums map[string][]interface{}
+	// Validators are run against every entity before it is written
+	Validators []func(Entity) error
+	// Timestamps maintains CreatedAt and UpdatedAt fields on write
+	Timestamps bool
+	// IDGenerator assigns an ID to entities written without one
+	IDGenerator func() string
+}
+
+// collection holds the write-time rules configured for an entity type
+type collection struct {
+	unique       []string
+	enums        map[string][]interface{}
+	validators   []func(Entity) error
+	timestamps   bool
+	idGenerator  func() string
+	history      bool
+	historyLimit int
+	transforms   map[string][]func(interface{}) interface{}
+	relations    map[string]string
+	loader       func(id string) (Entity, bool, error)
+	defaults     map[string]interface{}
+	fieldTypes   map[string]FieldType
+	required     []string
+	appendOnly   bool
+	capacity     int
+	marshal      func(Entity) ([]byte, error)
+	unmarshal    func([]byte) (Entity, error)
+
+	// versions lists the history versions of each entity, oldest first
+	versions map[string][]int
+}
+
+// Configure applies a collection configuration to an entity type in one step
+func (db *Database) Configure(entityType string, cfg CollectionConfig) {
+	entityType = db.typeName(entityType)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, field := range cfg.Indexes {
+		db.buildIndex(entityType, field)
+	}
+
+	c := db.collectionFor(entityType)
+	c.unique = append([]string(nil), cfg.Unique...)
+	c.enums = make(map[string][]interface{}, len(cfg.Enums))
+	for field, values := range cfg.Enums {
+		c.enums[field] = append([]interface{}(nil), values...)
+	}
+	c.validators = append([]func(Entity) error(nil), cfg.Validators...)
+	c.timestamps = cfg.Timestamps
+	c.idGenerator = cfg.IDGenerator
+}
+
+// AddFieldTransform registers a function that rewrites a field's value every
+// time an entity of the type is Set, e.g. to trim or lowercase input
+func (db *Database) AddFieldTransform(entityType, field string, transform func(interface{}) interface{}) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c := db.collectionFor(entityType)
+	if c.transforms == nil {
+		c.transforms = make(map[string][]func(interface{}) interface{})
+	}
+	c.transforms[field] = append(c.transforms[field], transform)
+}
+
+// applyTransforms runs the registered field transforms on an entity
+func (c collection) applyTransforms(entity Entity) {
+	for field, transforms := range c.transforms {
+		value, ok := getField(entity, field)
+		if !ok {
+			continue
+		}
+		for _, transform := range transforms {
+			value = transform(value)
+		}
+		setField(entity, field, value)
+	}
+}
+
+// SetAppendOnly makes an entity type insert-only: Set on an existing ID and
+// Delete return ErrAppendOnly
+func (db *Database) SetAppendOnly(entityType string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.collectionFor(entityType).appendOnly = true
+}
+
+// typeName returns the name an entity type is stored under, lowercased when
+// WithCaseInsensitiveTypes is set
+func (db *Database) typeName(entityType string) string {
+	if db.foldTypes {
+		return strings.ToLower(entityType)
+	}
+	return entityType
+}
+
+// SetRequiredFields makes Set reject a GenericEntity of the type that does
+// not have every one of fields, naming the missing ones in the error. A key
+// that is present with a nil value counts as present. Typed entities always
+// have their fields and are not checked. It replaces earlier required fields.
+func (db *Database) SetRequiredFields(entityType string, fields ...string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.collectionFor(entityType).required = append([]string(nil), fields...)
+}
+
+// collectionFor returns the mutable configuration of an entity type, creating
+// it if needed. The caller must hold the write lock.
+func (db *Database) collectionFor(entityType string) *collection {
+	entityType = db.typeName(entityType)
+
+	c := db.collections[entityType]
+	if c == nil {
+		c = &collection{}
+		db.collections[entityType] = c
+	}
+	return c
+}
+
+// collectionConfig returns a copy of the rules configured for an entity type
+func (db *Database) collectionConfig(entityType string) collection {
+	entityType = db.typeName(entityType)
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if c := db.collections[entityType]; c != nil {
+		return *c
+	}
+	return collection{}
+}
+
+// Touch advances the UpdatedAt of an entity to now when timestamps are
+// enabled for the type, leaving every other field as stored. Only UpdatedAt
+// changes, so the entity is not run through hooks, transforms or validators
+// again. An entity only a loader could provide is reported as ErrNotFound.
+func (tx *Transaction) Touch(entityType, id string) error {
+	entityType = tx.db.typeName(entityType)
+
+	if tx.readOnly {
+		return fmt.Errorf("cannot modify data in a read-only transaction")
+	}
+	entity, ok := tx.lookup(entityType, id)
+	if !ok {
+		return fmt.Errorf("%w: %s/%s", ErrNotFound, entityType, id)
+	}
+	cfg := tx.db.collectionConfig(entityType)
+	if !cfg.timestamps {
+		return nil
+	}
+	if cfg.appendOnly {
+		return fmt.Errorf("%w: cannot overwrite %s %s", ErrAppendOnly, entityType, id)
+	}
+
+	touched := copyEntity(entity)
+	setField(touched, "UpdatedAt", time.Now())
+	tx.setChange(entityType, id, touched)
+	return nil
+}
+
+// setTimestamps sets UpdatedAt to now and CreatedAt when it has not been set,
+// carrying CreatedAt over from the existing version of the entity
+func setTimestamps(entity, existing Entity, now time.Time) {
+	createdAt, hasCreatedAt := getField(entity, "CreatedAt")
+	if !hasCreatedAt || isZeroValue(createdAt) {
+		if prior, ok := getField(existing, "CreatedAt"); ok && !isZeroValue(prior) {
+			setField(entity, "CreatedAt", prior)
+		} else {
+			setField(entity, "CreatedAt", now)
+		}
+	}
+	setField(entity, "UpdatedAt", now)
+}
+
+// validate checks an entity against the enum and validator rules of a collection
+func (c collection) validate(entity Entity) error {
+	if ge, ok := entity.(*GenericEntity); ok && len(c.required) > 0 {
+		var missing []string
+		for _, field := range c.required {
+			if _, ok := ge.Fields[field]; !ok {
+				missing = append(missing, field)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("%w: %s", ErrMissingFields, strings.Join(missing, ", "))
+		}
+	}
+
+	for field, allowed := range c.enums {
+		value, ok := getField(entity, field)
+		if !ok {
+			continue
+		}
+		valid := false
+		for _, a := range allowed {
+			if valuesEqual(value, a) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid value %v for field %s: must be one of %v", value, field, allowed)
+		}
+	}
+
+	for _, validator := range c.validators {
+		if err := validator(entity); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkUnique ensures no other entity visible to the transaction shares a unique field value
+func (tx *Transaction) checkUnique(entityType string, entity Entity, fields []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	others := tx.GetAll(entityType)
+	for _, field := range fields {
+		value, ok := getField(entity, field)
+		if !ok || value == nil {
+			continue
+		}
+		for _, other := range others {
+			if other.GetID() == entity.GetID() {
+				continue
+			}
+			if otherValue, ok := getField(other, field); ok && valuesEqual(value, otherValue) {
+				return fmt.Errorf("%w: %s.%s = %v already used by %s", ErrUniqueViolation, entityType, field, value, other.GetID())
+			}
+		}
+	}
+
+	return nil
+}
+
+// SetGlobalIDUniqueness makes IDs unique across all user entity types rather
+// than per type. While enabled, Set returns ErrUniqueViolation when another
+// type already holds an entity with the same ID. History and migration
+// bookkeeping types are not considered.
+func (db *Database) SetGlobalIDUniqueness(enabled bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.globalIDs = enabled
+}
+
+// checkGlobalID ensures no entity of another type visible to the transaction uses id
+func (tx *Transaction) checkGlobalID(entityType, id string) error {
+	tx.db.mu.RLock()
+	enabled := tx.db.globalIDs
+	var owner string
+	if enabled {
+		for otherType, entities := range tx.db.data {
+			if otherType == entityType || isInternalType(otherType) {
+				continue
+			}
+			if _, ok := entities[id]; ok {
+				if pending, changed := tx.changes[otherType][id]; changed && pending == nil {
+					continue
+				}
+				owner = otherType
+				break
+			}
+		}
+	}
+	tx.db.mu.RUnlock()
+	if !enabled {
+		return nil
+	}
+
+	if owner == "" {
+		for otherType, changes := range tx.changes {
+			if otherType == entityType || isInternalType(otherType) {
+				continue
+			}
+			if entity, ok := changes[id]; ok && entity != nil {
+				owner = otherType
+				break
+			}
+		}
+	}
+	if owner != "" {
+		return fmt.Errorf("%w: id %s already used by %s", ErrUniqueViolation, id, owner)
+	}
+	return nil
+}
+
+// isInternalType reports whether an entity type holds the database's own bookkeeping
+func isInternalType(entityType string) bool {
+	return entityType == migrationVersionType("") ||
+		strings.HasPrefix(entityType, migrationVersionType("")+":") ||
+		strings.HasPrefix(entityType, historyType(""))
+}
+
+// setField sets the named field of an entity, converting the value to the
+// field's type for typed entities. It reports whether the field was set.
+func setField(entity Entity, field string, value interface{}) bool {
+	if isNilEntity(entity) {
+		return false
+	}
+	if ge, ok := entity.(*GenericEntity); ok {
+		if ge.Fields == nil {
+			ge.Fields = make(map[string]interface{})
+		}
+		ge.Fields[field] = value
+		return true
+	}
+	v := reflect.Indirect(reflect.ValueOf(entity))
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+	fv := v.FieldByName(field)
+	if !fv.IsValid() || !fv.CanSet() {
+		return false
+	}
+	if value == nil {
+		fv.Set(reflect.Zero(fv.Type()))
+		return true
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Type().AssignableTo(fv.Type()) {
+		fv.Set(rv)
+		return true
+	}
+	if rv.Type().ConvertibleTo(fv.Type()) {
+		fv.Set(rv.Convert(fv.Type()))
+		return true
+	}
+	return false
+}
+
+// isZeroValue reports whether v is nil or the zero value of its type
+func isZeroValue(v interface{}) bool {
+	return v == nil || reflect.ValueOf(v).IsZero()
+}
@@ -0,0 +1,265 @@
+package flexdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// UserEntity is a sample entity with timestamps for testing collection features
+type UserEntity struct {
+	ID        string
+	Email     string
+	Status    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (u *UserEntity) GetID() string   { return u.ID }
+func (u *UserEntity) SetID(id string) { u.ID = id }
+
+func TestConfigure(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	nextID := 0
+	db.Configure("user", CollectionConfig{
+		Indexes: []string{"Email"},
+		Unique:  []string{"Email"},
+		Enums:   map[string][]interface{}{"Status": {"active", "disabled"}},
+		Validators: []func(Entity) error{func(e Entity) error {
+			if e.(*UserEntity).Email == "" {
+				return fmt.Errorf("email is required")
+			}
+			return nil
+		}},
+		Timestamps: true,
+		IDGenerator: func() string {
+			nextID++
+			return fmt.Sprintf("user-%d", nextID)
+		},
+	})
+
+	if _, ok := db.indexes["user"]["Email"]; !ok {
+		t.Error("Expected Email index to be created")
+	}
+
+	writeTx := db.Transact(false)
+	defer writeTx.Rollback()
+
+	// ID generator and timestamps
+	alice := &UserEntity{Email: "alice@example.com", Status: "active"}
+	if err := writeTx.Set("user", alice); err != nil {
+		t.Fatalf("Failed to set entity: %v", err)
+	}
+	if alice.ID != "user-1" {
+		t.Errorf("Expected generated ID user-1, got %q", alice.ID)
+	}
+	if alice.CreatedAt.IsZero() || alice.UpdatedAt.IsZero() {
+		t.Error("Expected CreatedAt and UpdatedAt to be set")
+	}
+
+	// CreatedAt is preserved when the entity is rewritten
+	createdAt := alice.CreatedAt
+	rewritten := &UserEntity{ID: "user-1", Email: "alice@example.com", Status: "disabled"}
+	if err := writeTx.Set("user", rewritten); err != nil {
+		t.Fatalf("Failed to update entity: %v", err)
+	}
+	if !rewritten.CreatedAt.Equal(createdAt) {
+		t.Errorf("Expected CreatedAt to be preserved, got %v want %v", rewritten.CreatedAt, createdAt)
+	}
+
+	// Unique constraint
+	err := writeTx.Set("user", &UserEntity{Email: "alice@example.com", Status: "active"})
+	if !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Expected ErrUniqueViolation, got %v", err)
+	}
+
+	// Enum constraint
+	if err := writeTx.Set("user", &UserEntity{Email: "bob@example.com", Status: "unknown"}); err == nil {
+		t.Error("Expected enum violation error")
+	}
+
+	// Validators
+	if err := writeTx.Set("user", &UserEntity{Status: "active"}); err == nil {
+		t.Error("Expected validator error")
+	}
+}
+
+func TestFieldTransforms(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	normalize := func(v interface{}) interface{} {
+		if s, ok := v.(string); ok {
+			return strings.ToLower(strings.TrimSpace(s))
+		}
+		return v
+	}
+	db.AddFieldTransform("user", "Email", normalize)
+
+	writeTx := db.Transact(false)
+	defer writeTx.Rollback()
+
+	typed := &UserEntity{ID: "1", Email: "  Alice@Example.COM "}
+	if err := writeTx.Set("user", typed); err != nil {
+		t.Fatalf("Failed to set entity: %v", err)
+	}
+	if typed.Email != "alice@example.com" {
+		t.Errorf("Expected typed email to be normalized, got %q", typed.Email)
+	}
+
+	generic := &GenericEntity{ID: "2", Fields: map[string]interface{}{"Email": " BOB@example.com"}}
+	if err := writeTx.Set("user", generic); err != nil {
+		t.Fatalf("Failed to set entity: %v", err)
+	}
+	if generic.Fields["Email"] != "bob@example.com" {
+		t.Errorf("Expected generic email to be normalized, got %q", generic.Fields["Email"])
+	}
+}
+
+func TestAppendOnly(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.SetAppendOnly("audit")
+
+	tx := db.Transact(false)
+	if err := tx.Set("audit", &TestEntity{ID: "1", Name: "login"}); err != nil {
+		t.Fatalf("Expected inserts to be allowed, got %v", err)
+	}
+	tx.Commit()
+
+	tx = db.Transact(false)
+	defer tx.Rollback()
+	if err := tx.Set("audit", &TestEntity{ID: "1", Name: "tampered"}); !errors.Is(err, ErrAppendOnly) {
+		t.Errorf("Expected ErrAppendOnly on overwrite, got %v", err)
+	}
+	if err := tx.Delete("audit", "1"); !errors.Is(err, ErrAppendOnly) {
+		t.Errorf("Expected ErrAppendOnly on delete, got %v", err)
+	}
+	if err := tx.Set("audit", &TestEntity{ID: "2", Name: "logout"}); err != nil {
+		t.Errorf("Expected a new insert to be allowed, got %v", err)
+	}
+}
+
+func TestGlobalIDUniqueness(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("user", &UserEntity{ID: "shared"})
+	if err := tx.Set("order", &OrderEntity{ID: "shared"}); err != nil {
+		t.Fatalf("Expected per-type IDs by default, got %v", err)
+	}
+	tx.Commit()
+
+	db.SetGlobalIDUniqueness(true)
+
+	tx = db.Transact(false)
+	defer tx.Rollback()
+	if err := tx.Set("invoice", &TestEntity{ID: "shared"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Expected ErrUniqueViolation for a committed id, got %v", err)
+	}
+	tx.Set("user", &UserEntity{ID: "pending"})
+	if err := tx.Set("order", &OrderEntity{ID: "pending"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Expected ErrUniqueViolation for a pending id, got %v", err)
+	}
+	if err := tx.Set("user", &UserEntity{ID: "shared", Email: "updated"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Expected ErrUniqueViolation while the order still holds the id, got %v", err)
+	}
+
+	// Freeing the id in the other type allows it again
+	tx.Delete("order", "shared")
+	if err := tx.Set("user", &UserEntity{ID: "shared", Email: "updated"}); err != nil {
+		t.Errorf("Expected the freed id to be usable, got %v", err)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.Configure("user", CollectionConfig{Timestamps: true})
+
+	tx := db.Transact(false)
+	tx.Set("user", &UserEntity{ID: "u1", Email: "alice@example.com", Status: "active"})
+	tx.Commit()
+
+	readTx := db.Transact(true)
+	before, _ := readTx.Get("user", "u1")
+	readTx.Rollback()
+	original := *before.(*UserEntity)
+
+	// Touch must neither rerun transforms nor consult the loader
+	db.AddFieldTransform("user", "Email", func(v interface{}) interface{} { return "rewritten" })
+	loads := 0
+	db.SetLoader("user", func(id string) (Entity, bool, error) {
+		loads++
+		return &UserEntity{ID: id}, true, nil
+	})
+
+	time.Sleep(time.Millisecond)
+	tx = db.Transact(false)
+	if err := tx.Touch("user", "u1"); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+	if err := tx.Touch("user", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing entity, got %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if loads != 0 {
+		t.Errorf("Expected Touch not to call the loader, got %d calls", loads)
+	}
+
+	readTx = db.Transact(true)
+	defer readTx.Rollback()
+	after, _ := readTx.Get("user", "u1")
+	touched := *after.(*UserEntity)
+	if !touched.UpdatedAt.After(original.UpdatedAt) {
+		t.Errorf("Expected UpdatedAt to advance, got %v then %v", original.UpdatedAt, touched.UpdatedAt)
+	}
+	touched.UpdatedAt = original.UpdatedAt
+	if touched != original {
+		t.Errorf("Expected only UpdatedAt to change, got %+v want %+v", touched, original)
+	}
+}
+
+func TestSetRequiredFields(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.SetRequiredFields("contact", "name", "email", "phone")
+
+	tx := db.Transact(false)
+	defer tx.Rollback()
+
+	err := tx.Set("contact", &GenericEntity{ID: "c1", Fields: map[string]interface{}{"name": "Alice"}})
+	if !errors.Is(err, ErrMissingFields) {
+		t.Fatalf("Expected ErrMissingFields, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "email, phone") {
+		t.Errorf("Expected the error to name the missing fields, got %v", err)
+	}
+	if _, ok := tx.Get("contact", "c1"); ok {
+		t.Error("Expected the rejected record not to be stored")
+	}
+
+	err = tx.Set("contact", &GenericEntity{ID: "c2", Fields: map[string]interface{}{"name": "Bob", "email": "bob@example.com", "phone": nil}})
+	if err != nil {
+		t.Errorf("Expected a record with every required key to be accepted, got %v", err)
+	}
+}
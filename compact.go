@@ -0,0 +1,264 @@
+package flexdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// CompactResult reports the work done by CompactFile
+type CompactResult struct {
+	// Files is the number of files read, the main file and any rotated files
+	Files int
+	// Kept is the number of live records written
+	Kept int
+	// Dropped counts tombstones and the older records they or newer files replace
+	Dropped int
+}
+
+// CompactFile rewrites a JSON database file, merged with any files rotated
+// from it by WithMaxFileSize, as a single file of live records without
+// tombstones, and then removes the rotated files. Records are streamed one at
+// a time, newest file first, so only the type and ID of each record seen are
+// held in memory; live records are spilled to temporary files beside the
+// database until the output is assembled. The database must not be open.
+// A crash after the new file is in place but before every rotated file is
+// removed leaves the older records of those files to be loaded again.
+func CompactFile(path string) (CompactResult, error) {
+	var result CompactResult
+	files := []string{path}
+	for n := 1; ; n++ {
+		rotated := fmt.Sprintf("%s.%d", path, n)
+		if _, err := os.Stat(rotated); err != nil {
+			break
+		}
+		files = append(files, rotated)
+	}
+
+	dir := filepath.Dir(path)
+	spillDir, err := os.MkdirTemp(dir, filepath.Base(path)+".compact-*")
+	if err != nil {
+		return result, err
+	}
+	defer os.RemoveAll(spillDir)
+
+	spills := make(map[string]*compactSpill)
+	defer func() {
+		for _, spill := range spills {
+			spill.file.Close()
+		}
+	}()
+	seen := make(map[string]map[string]struct{})
+
+	for _, file := range files {
+		err := streamRecords(file, func(entityType, id string, raw json.RawMessage) error {
+			if seen[entityType] == nil {
+				seen[entityType] = make(map[string]struct{})
+			}
+			if _, ok := seen[entityType][id]; ok {
+				result.Dropped++
+				return nil
+			}
+			seen[entityType][id] = struct{}{}
+
+			var doc map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &doc); err != nil {
+				return fmt.Errorf("%s/%s: %w", entityType, id, err)
+			}
+			if string(bytes.TrimSpace(doc[tombstoneField])) == "true" {
+				result.Dropped++
+				return nil
+			}
+
+			spill := spills[entityType]
+			if spill == nil {
+				f, err := os.CreateTemp(spillDir, "type-*")
+				if err != nil {
+					return err
+				}
+				spill = &compactSpill{file: f, w: bufio.NewWriter(f)}
+				spills[entityType] = spill
+			}
+			result.Kept++
+			return spill.write(id, raw)
+		})
+		if os.IsNotExist(err) && file == path && len(files) > 1 {
+			// A rotated database may not have written its main file yet
+			continue
+		}
+		if err != nil {
+			return CompactResult{}, fmt.Errorf("%s: %w", file, err)
+		}
+		result.Files++
+	}
+
+	if err := writeCompacted(path, spills); err != nil {
+		return CompactResult{}, err
+	}
+	for _, rotated := range files[1:] {
+		if err := os.Remove(rotated); err != nil {
+			return CompactResult{}, err
+		}
+	}
+	return result, nil
+}
+
+// compactSpill buffers the live records of one entity type as the members of
+// a JSON object, without the surrounding braces
+type compactSpill struct {
+	file  *os.File
+	w     *bufio.Writer
+	count int
+}
+
+func (s *compactSpill) write(id string, raw json.RawMessage) error {
+	key, err := json.Marshal(id)
+	if err != nil {
+		return err
+	}
+	if s.count > 0 {
+		s.w.WriteByte(',')
+	}
+	s.count++
+	s.w.Write(key)
+	s.w.WriteByte(':')
+	_, err = s.w.Write(raw)
+	return err
+}
+
+// writeCompacted assembles the spilled records into a temporary file that
+// then replaces the database file
+func writeCompacted(path string, spills map[string]*compactSpill) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	entityTypes := make([]string, 0, len(spills))
+	for entityType := range spills {
+		entityTypes = append(entityTypes, entityType)
+	}
+	sort.Strings(entityTypes)
+
+	w := bufio.NewWriter(tmp)
+	w.WriteByte('{')
+	for i, entityType := range entityTypes {
+		spill := spills[entityType]
+		if err := spill.w.Flush(); err != nil {
+			tmp.Close()
+			return err
+		}
+		if _, err := spill.file.Seek(0, io.SeekStart); err != nil {
+			tmp.Close()
+			return err
+		}
+		key, _ := json.Marshal(entityType)
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.Write(key)
+		w.WriteString(":{")
+		if _, err := io.Copy(w, spill.file); err != nil {
+			tmp.Close()
+			return err
+		}
+		w.WriteByte('}')
+	}
+	w.WriteString("}\n")
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// streamRecords decodes a JSON database file one record at a time, calling
+// fn with the raw document of each
+func streamRecords(path string, fn func(entityType, id string, raw json.RawMessage) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if head, _ := r.Peek(len(codecHeaderPrefix)); string(head) == codecHeaderPrefix {
+		return fmt.Errorf("streaming compaction only supports JSON files")
+	}
+	dec := json.NewDecoder(r)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		if err == io.EOF {
+			return nil // An empty file holds no records
+		}
+		return err
+	}
+	for dec.More() {
+		entityType, err := stringToken(dec)
+		if err != nil {
+			return err
+		}
+		if err := expectDelim(dec, '{'); err != nil {
+			return err
+		}
+		for dec.More() {
+			id, err := stringToken(dec)
+			if err != nil {
+				return err
+			}
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return err
+			}
+			if err := fn(entityType, id, raw); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(dec, '}'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// expectDelim reads the next token and checks it is the delimiter want
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("expected %v in database file, got %v", want, tok)
+	}
+	return nil
+}
+
+// stringToken reads the next token as an object key
+func stringToken(dec *json.Decoder) (string, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return "", err
+	}
+	s, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a key in database file, got %v", tok)
+	}
+	return s, nil
+}
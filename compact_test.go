@@ -0,0 +1,90 @@
+package flexdb
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCompactFile(t *testing.T) {
+	dbPath := "./test_db.json"
+	cleanup := func() {
+		os.Remove(dbPath)
+		for n := 1; n <= 20; n++ {
+			os.Remove(fmt.Sprintf("%s.%d", dbPath, n))
+		}
+	}
+	cleanup()
+	defer cleanup()
+
+	db, _ := NewDatabase(dbPath, WithMaxFileSize(300))
+	for i := 0; i < 20; i++ {
+		tx := db.Transact(false)
+		tx.Set("test", &TestEntity{ID: fmt.Sprint(i), Name: "rotating", Value: i})
+		tx.Commit()
+	}
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "updated", Value: 100})
+	tx.Delete("test", "0")
+	tx.Delete("test", "2")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	main, _ := os.ReadFile(dbPath)
+	if !strings.Contains(string(main), tombstoneField) {
+		t.Fatal("Expected the main file to hold tombstones before compaction")
+	}
+
+	result, err := CompactFile(dbPath)
+	if err != nil {
+		t.Fatalf("CompactFile failed: %v", err)
+	}
+	if result.Files < 2 || result.Kept != 18 {
+		t.Errorf("Expected 18 live records merged from several files, got %+v", result)
+	}
+	if _, err := os.Stat(dbPath + ".1"); !os.IsNotExist(err) {
+		t.Errorf("Expected rotated files to be removed, got %v", err)
+	}
+	compacted, _ := os.ReadFile(dbPath)
+	if strings.Contains(string(compacted), tombstoneField) {
+		t.Error("Expected the compacted file to omit tombstones")
+	}
+
+	// The compacted file loads on its own, without rotation
+	reloaded, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	readTx := reloaded.Transact(true)
+	defer readTx.Rollback()
+	if count := readTx.Count("test"); count != 18 {
+		t.Errorf("Expected 18 entities after compaction, got %d", count)
+	}
+	for _, id := range []string{"0", "2"} {
+		if _, ok := readTx.Get("test", id); ok {
+			t.Errorf("Expected deleted entity %s to stay deleted", id)
+		}
+	}
+	updated, _ := readTx.Get("test", "1")
+	if name, _ := getField(updated, "Name"); name != "updated" {
+		t.Errorf("Expected the newest version to be kept, got %v", name)
+	}
+}
+
+func TestCompactFileRejectsOtherCodecs(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath, WithCodec(GobCodec))
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "gob"})
+	tx.Commit()
+
+	if _, err := CompactFile(dbPath); err == nil {
+		t.Error("Expected an error compacting a gob file")
+	}
+	if _, err := NewDatabase(dbPath); err != nil {
+		t.Errorf("Expected the file to be left intact, got %v", err)
+	}
+}
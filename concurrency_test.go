@@ -0,0 +1,90 @@
+package flexdb
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentReaders(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath, WithSyncMode(SyncNever))
+	db.AddIndex("test", "Name")
+	tx := db.Transact(false)
+	for i := 0; i < 50; i++ {
+		tx.Set("test", &TestEntity{ID: fmt.Sprint(i), Name: "reader", Value: i})
+	}
+	tx.Commit()
+
+	const readers = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, readers)
+
+	// A writer keeps committing while the readers run
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			tx := db.Transact(false)
+			tx.Set("test", &TestEntity{ID: fmt.Sprint(i), Name: "reader", Value: i * 2})
+			tx.Commit()
+		}
+	}()
+
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				readTx := db.Transact(true)
+				if _, ok := readTx.Get("test", fmt.Sprint(i)); !ok {
+					errs <- fmt.Errorf("entity %d not found", i)
+				}
+				results, err := readTx.NewQuery("test").Where("Name", "reader").Execute()
+				if err != nil || len(results) != 50 {
+					errs <- fmt.Errorf("query returned %d results: %v", len(results), err)
+				}
+				readTx.Count("test")
+				readTx.Rollback()
+			}
+		}()
+	}
+
+	wg.Wait()
+	<-done
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+		break
+	}
+}
+
+func BenchmarkConcurrentReads(b *testing.B) {
+	dbPath := "./bench_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	for i := 0; i < 1000; i++ {
+		tx.Set("test", &TestEntity{ID: fmt.Sprint(i), Value: i})
+	}
+	tx.Commit()
+
+	for _, goroutines := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("goroutines-%d", goroutines), func(b *testing.B) {
+			b.SetParallelism(goroutines)
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					readTx := db.Transact(true)
+					readTx.Get("test", fmt.Sprint(i%1000))
+					readTx.Rollback()
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package flexdb
+
+import (
+	"cmp"
+	"sort"
+)
+
+// Condition is a typed filter built with the generic helpers Eq, Gt, Lt and
+// In. The helpers fix the value's type at the call site, and comparisons
+// treat numbers of different kinds as equal when their values match, so an
+// int condition still matches a float64 field reloaded from JSON.
+type Condition struct {
+	filter Filter
+}
+
+// Filter returns the condition as a serializable Filter
+func (c *Condition) Filter() Filter {
+	return c.filter
+}
+
+// Eq matches entities whose field equals v
+func Eq[T comparable](field string, v T) *Condition {
+	return &Condition{filter: FilterEq(field, v)}
+}
+
+// Gt matches entities whose field is greater than v
+func Gt[T cmp.Ordered](field string, v T) *Condition {
+	return &Condition{filter: FilterGt(field, v)}
+}
+
+// Lt matches entities whose field is less than v
+func Lt[T cmp.Ordered](field string, v T) *Condition {
+	return &Condition{filter: FilterLt(field, v)}
+}
+
+// In matches entities whose field equals one of values
+func In[T comparable](field string, values ...T) *Condition {
+	list := make([]interface{}, len(values))
+	for i, v := range values {
+		list[i] = v
+	}
+	return &Condition{filter: FilterIn(field, list...)}
+}
+
+// WhereCond adds a typed condition to the query
+func (q *Query) WhereCond(c *Condition) *Query {
+	if c == nil {
+		return q
+	}
+	return q.Apply(c.filter)
+}
+
+// Find returns the entities matching every condition as T, ordered by ID
+func (c *Collection[T]) Find(conds ...*Condition) ([]T, error) {
+	tx := c.db.Transact(true)
+	defer tx.Rollback()
+
+	q := tx.NewQuery(c.entityType)
+	for _, cond := range conds {
+		q.WhereCond(cond)
+	}
+	entities, err := q.Execute()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entities, func(i, j int) bool { return entities[i].GetID() < entities[j].GetID() })
+
+	results := make([]T, 0, len(entities))
+	for _, entity := range entities {
+		typed, err := decodeEntity[T](entity)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, typed)
+	}
+	return results, nil
+}
@@ -0,0 +1,42 @@
+package flexdb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestGenericConditions(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "Alice", Value: 25})
+	tx.Set("test", &TestEntity{ID: "2", Name: "Bob", Value: 30})
+	tx.Set("test", &TestEntity{ID: "3", Name: "Carol", Value: 35})
+	tx.Commit()
+
+	// Reloaded entities store Value as float64; int conditions must still match
+	reloaded, _ := NewDatabase(dbPath)
+	for name, d := range map[string]*Database{"typed": db, "reloaded": reloaded} {
+		users := NewCollection[*TestEntity](d, "test")
+
+		matches, err := users.Find(Eq("Value", 25))
+		if err != nil {
+			t.Fatalf("%s: Find failed: %v", name, err)
+		}
+		if len(matches) != 1 || matches[0].Name != "Alice" {
+			t.Errorf("%s: expected Alice for Value == 25, got %v", name, matches)
+		}
+
+		matches, _ = users.Find(Gt("Value", 25), Lt("Value", 35))
+		if len(matches) != 1 || matches[0].Name != "Bob" {
+			t.Errorf("%s: expected Bob for 25 < Value < 35, got %v", name, matches)
+		}
+
+		matches, _ = users.Find(In("Name", "Alice", "Carol"))
+		if len(matches) != 2 || matches[0].ID != "1" || matches[1].ID != "3" {
+			t.Errorf("%s: expected Alice and Carol, got %v", name, matches)
+		}
+	}
+}
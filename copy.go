@@ -0,0 +1,51 @@
+package flexdb
+
+import "sort"
+
+// copyBatchSize is the number of entities written per destination transaction by CopyTo
+const copyBatchSize = 500
+
+// CopyTo copies the committed entities of a type that match where (or all of
+// them when where is nil) into dest, committing in batches. It returns the
+// number of entities copied.
+func (db *Database) CopyTo(dest *Database, entityType string, where func(Entity) bool) (int, error) {
+	entityType = db.typeName(entityType)
+
+	db.mu.RLock()
+	ids := make([]string, 0, len(db.data[entityType]))
+	for id := range db.data[entityType] {
+		ids = append(ids, id)
+	}
+	db.mu.RUnlock()
+	sort.Strings(ids)
+
+	copied := 0
+	for start := 0; start < len(ids); start += copyBatchSize {
+		end := start + copyBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		var batch []Entity
+		for _, entity := range db.snapshotTx().GetMany(entityType, ids[start:end]) {
+			if where == nil || where(entity) {
+				batch = append(batch, copyEntity(entity))
+			}
+		}
+		if len(batch) == 0 {
+			continue
+		}
+
+		tx := dest.Transact(false)
+		if err := tx.BatchSet(entityType, batch); err != nil {
+			tx.Rollback()
+			return copied, err
+		}
+		if err := tx.Commit(); err != nil {
+			return copied, err
+		}
+		copied += len(batch)
+	}
+
+	return copied, nil
+}
@@ -0,0 +1,45 @@
+package flexdb
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestCopyTo(t *testing.T) {
+	srcPath := "./test_db.json"
+	destPath := "./test_copy_db.json"
+	defer os.Remove(srcPath)
+	defer os.Remove(destPath)
+
+	src, _ := NewDatabase(srcPath)
+	dest, _ := NewDatabase(destPath)
+
+	writeTx := src.Transact(false)
+	for i := 0; i < 1200; i++ {
+		writeTx.Set("test", &TestEntity{ID: strconv.Itoa(i), Value: i})
+	}
+	writeTx.Commit()
+
+	copied, err := src.CopyTo(dest, "test", func(e Entity) bool {
+		return e.(*TestEntity).Value%2 == 0
+	})
+	if err != nil {
+		t.Fatalf("CopyTo failed: %v", err)
+	}
+	if copied != 600 {
+		t.Errorf("Expected 600 copied entities, got %d", copied)
+	}
+
+	readTx := dest.Transact(true)
+	defer readTx.Rollback()
+	entities := readTx.GetAll("test")
+	if len(entities) != 600 {
+		t.Fatalf("Expected 600 entities in destination, got %d", len(entities))
+	}
+	for _, e := range entities {
+		if e.(*TestEntity).Value%2 != 0 {
+			t.Errorf("Entity %s should not have been copied", e.GetID())
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package flexdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Decimal is an exact fixed-point amount with two decimal places, stored as
+// integer cents. It is written to the database file as a JSON number such as
+// 12.34 and is understood by the comparison and aggregation helpers, so
+// queries, ordering and sums over money values do not suffer float rounding.
+type Decimal int64
+
+// DecimalFromCents returns the Decimal for an amount in cents
+func DecimalFromCents(cents int64) Decimal {
+	return Decimal(cents)
+}
+
+// ParseDecimal parses a decimal string such as "12.34" or "-0.5"
+func ParseDecimal(s string) (Decimal, error) {
+	str := strings.TrimSpace(s)
+	negative := strings.HasPrefix(str, "-")
+	str = strings.TrimPrefix(strings.TrimPrefix(str, "-"), "+")
+
+	whole, frac, _ := strings.Cut(str, ".")
+	if whole == "" && frac == "" || len(frac) > 2 {
+		return 0, fmt.Errorf("invalid decimal %q", s)
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units < 0 {
+		return 0, fmt.Errorf("invalid decimal %q", s)
+	}
+	cents, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil || cents < 0 {
+		return 0, fmt.Errorf("invalid decimal %q", s)
+	}
+
+	d := Decimal(units*100 + cents)
+	if negative {
+		d = -d
+	}
+	return d, nil
+}
+
+// Cents returns the amount in cents
+func (d Decimal) Cents() int64 {
+	return int64(d)
+}
+
+// Add returns d + other
+func (d Decimal) Add(other Decimal) Decimal {
+	return d + other
+}
+
+// Sub returns d - other
+func (d Decimal) Sub(other Decimal) Decimal {
+	return d - other
+}
+
+// Float64 returns the amount as a float64, which may be inexact
+func (d Decimal) Float64() float64 {
+	return float64(d) / 100
+}
+
+// String formats the amount with two decimal places
+func (d Decimal) String() string {
+	sign := ""
+	cents := int64(d)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Compare implements Comparable
+func (d Decimal) Compare(other Comparable) int {
+	o, ok := other.(Decimal)
+	if !ok {
+		return strings.Compare(d.String(), fmt.Sprint(other))
+	}
+	switch {
+	case d < o:
+		return -1
+	case d > o:
+		return 1
+	}
+	return 0
+}
+
+// MarshalJSON writes the amount as an exact JSON number
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a decimal string
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		s = string(data)
+	}
+	parsed, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// toDecimal converts Decimals, numbers and decimal strings to a Decimal,
+// rounding floats to the nearest cent
+func toDecimal(v interface{}) (Decimal, bool) {
+	switch t := v.(type) {
+	case Decimal:
+		return t, true
+	case string:
+		d, err := ParseDecimal(t)
+		return d, err == nil
+	case float32, float64:
+		f, _ := toFloat64(t)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, false
+		}
+		return Decimal(math.Round(f * 100)), true
+	}
+	if f, ok := toFloat64(v); ok {
+		return Decimal(f * 100), true
+	}
+	return 0, false
+}
+
+// isDecimal reports whether either value is a Decimal
+func isDecimal(a, b interface{}) bool {
+	_, okA := a.(Decimal)
+	_, okB := b.(Decimal)
+	return okA || okB
+}
@@ -0,0 +1,73 @@
+package flexdb
+
+import (
+	"os"
+	"testing"
+)
+
+type PaymentEntity struct {
+	ID     string
+	Status string
+	Amount Decimal
+}
+
+func (p *PaymentEntity) GetID() string   { return p.ID }
+func (p *PaymentEntity) SetID(id string) { p.ID = id }
+
+func TestParseDecimal(t *testing.T) {
+	tests := map[string]int64{"12.34": 1234, "-0.5": -50, "3": 300, ".07": 7, "+1.00": 100}
+	for in, want := range tests {
+		d, err := ParseDecimal(in)
+		if err != nil || d.Cents() != want {
+			t.Errorf("ParseDecimal(%q) = %d, %v; want %d", in, d.Cents(), err, want)
+		}
+	}
+	for _, in := range []string{"", "1.234", "abc", "1.-2"} {
+		if _, err := ParseDecimal(in); err == nil {
+			t.Errorf("Expected ParseDecimal(%q) to fail", in)
+		}
+	}
+	if s := DecimalFromCents(-105).String(); s != "-1.05" {
+		t.Errorf("Expected -1.05, got %s", s)
+	}
+}
+
+func TestDecimalSum(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	// 0.1 + 0.2 is the classic float64 rounding error
+	amounts := []string{"0.10", "0.20", "0.10", "0.20", "0.10", "0.20", "0.10", "0.20", "0.10", "0.20"}
+	var expected Decimal
+	for i, a := range amounts {
+		d, _ := ParseDecimal(a)
+		expected = expected.Add(d)
+		tx.Set("payment", &PaymentEntity{ID: string(rune('a' + i)), Status: "paid", Amount: d})
+	}
+	tx.Commit()
+
+	if expected.String() != "1.50" {
+		t.Fatalf("Expected Decimal addition to be exact, got %s", expected)
+	}
+
+	reloaded, _ := NewDatabase(dbPath)
+	for name, d := range map[string]*Database{"typed": db, "reloaded": reloaded} {
+		readTx := d.Transact(true)
+		groups, err := readTx.NewQuery("payment").GroupBy("Status").Aggregate("Amount").Execute()
+		if err != nil || len(groups) != 1 {
+			t.Fatalf("%s: GroupBy failed: %v", name, err)
+		}
+		if sum := groups[0].Aggregate.DecimalSum; sum != expected {
+			t.Errorf("%s: expected exact sum %s, got %s", name, expected, sum)
+		}
+
+		threshold, _ := ParseDecimal("0.15")
+		results, _ := readTx.NewQuery("payment").Apply(FilterGt("Amount", threshold)).Execute()
+		if len(results) != 5 {
+			t.Errorf("%s: expected 5 payments above 0.15, got %d", name, len(results))
+		}
+		readTx.Rollback()
+	}
+}
@@ -0,0 +1,94 @@
+package flexdb
+
+// RegisterDerivedCollection keeps the collection name in sync with the
+// source type, like a materialized view. Whenever a source entity is set,
+// derive maps it to the ID and entity to store in name; ok false means the
+// entity has no derived record. The record derived from the previously
+// stored version is deleted when its ID changes or the source is deleted;
+// the ID derived for each source entity is recorded in "derived:" + name, so
+// this also works for entities changed in place. Derived writes happen in the same transaction, so they commit atomically
+// with the source change.
+func (db *Database) RegisterDerivedCollection(name, source string, derive func(Entity) (id string, derived Entity, ok bool)) {
+	name, source = db.typeName(name), db.typeName(source)
+	keys := derivedKeysType(name)
+
+	deriveSafe := func(entity Entity) (id string, derived Entity, ok bool, err error) {
+		if isNilEntity(entity) {
+			return "", nil, false, nil
+		}
+		err = safeCall("derive", func() error {
+			id, derived, ok = derive(entity)
+			return nil
+		})
+		return id, derived, ok, err
+	}
+
+	// staleID returns the ID of the record derived from the stored version of
+	// a source entity. It is read from the recorded key rather than derived
+	// from old, since an entity changed in place and set again is the same
+	// value as the new version.
+	staleID := func(tx *Transaction, sourceID string, old Entity) (string, bool, error) {
+		if key, ok := tx.lookup(keys, sourceID); ok {
+			id, ok := key.(*GenericEntity).Fields["id"].(string)
+			return id, ok, nil
+		}
+		// Records derived before keys were recorded
+		id, _, ok, err := deriveSafe(old)
+		return id, ok, err
+	}
+
+	db.RegisterHookV2("post-set", func(tx *Transaction, ev HookEvent) error {
+		if ev.EntityType != source {
+			return nil
+		}
+		sourceID := ev.New.GetID()
+		oldID, hadOld, err := staleID(tx, sourceID, ev.Old)
+		if err != nil {
+			return err
+		}
+		newID, derived, ok, err := deriveSafe(ev.New)
+		if err != nil {
+			return err
+		}
+		if hadOld && (!ok || oldID != newID) {
+			if err := tx.Delete(name, oldID); err != nil {
+				return err
+			}
+		}
+		if !ok {
+			if _, recorded := tx.lookup(keys, sourceID); recorded {
+				return tx.Delete(keys, sourceID)
+			}
+			return nil
+		}
+		derived.SetID(newID)
+		if err := tx.Set(name, derived); err != nil {
+			return err
+		}
+		return tx.Set(keys, &GenericEntity{ID: sourceID, Fields: map[string]interface{}{"id": newID}})
+	})
+
+	db.RegisterHookV2("post-delete", func(tx *Transaction, ev HookEvent) error {
+		if ev.EntityType != source {
+			return nil
+		}
+		sourceID := ev.Old.GetID()
+		oldID, hadOld, err := staleID(tx, sourceID, ev.Old)
+		if err != nil || !hadOld {
+			return err
+		}
+		if err := tx.Delete(name, oldID); err != nil {
+			return err
+		}
+		if _, recorded := tx.lookup(keys, sourceID); recorded {
+			return tx.Delete(keys, sourceID)
+		}
+		return nil
+	})
+}
+
+// derivedKeysType returns the name of the collection recording which derived
+// record each source entity produced
+func derivedKeysType(name string) string {
+	return "derived:" + name
+}
@@ -0,0 +1,94 @@
+package flexdb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDerivedCollection(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.RegisterDerivedCollection("user_by_email", "user", func(e Entity) (string, Entity, bool) {
+		user := e.(*UserEntity)
+		if user.Email == "" {
+			return "", nil, false
+		}
+		return user.Email, &GenericEntity{Fields: map[string]interface{}{"userID": user.ID}}, true
+	})
+
+	tx := db.Transact(false)
+	tx.Set("user", &UserEntity{ID: "u1", Email: "alice@example.com"})
+	tx.Set("user", &UserEntity{ID: "u2", Email: "bob@example.com"})
+	tx.Commit()
+
+	lookup := func(email string) (string, bool) {
+		e, ok := db.Get("user_by_email", email)
+		if !ok {
+			return "", false
+		}
+		return e.(*GenericEntity).Fields["userID"].(string), true
+	}
+	if id, ok := lookup("alice@example.com"); !ok || id != "u1" {
+		t.Errorf("Expected alice's email to map to u1, got %q", id)
+	}
+
+	// Changing the email moves the derived record in the same commit
+	tx = db.Transact(false)
+	tx.Set("user", &UserEntity{ID: "u1", Email: "alice@new.example.com"})
+	if _, ok := db.Get("user_by_email", "alice@new.example.com"); ok {
+		t.Error("Expected the derived record to wait for the commit")
+	}
+	tx.Commit()
+	if _, ok := lookup("alice@example.com"); ok {
+		t.Error("Expected the old email record to be removed")
+	}
+	if id, ok := lookup("alice@new.example.com"); !ok || id != "u1" {
+		t.Errorf("Expected the new email to map to u1, got %q", id)
+	}
+
+	// Deleting the source removes its derived record
+	tx = db.Transact(false)
+	tx.Delete("user", "u2")
+	tx.Commit()
+	if _, ok := lookup("bob@example.com"); ok {
+		t.Error("Expected the derived record of a deleted user to be removed")
+	}
+}
+
+func TestDerivedCollectionInPlaceChange(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.RegisterDerivedCollection("user_by_email", "user", func(e Entity) (string, Entity, bool) {
+		user := e.(*UserEntity)
+		return user.Email, &GenericEntity{Fields: map[string]interface{}{"userID": user.ID}}, true
+	})
+
+	tx := db.Transact(false)
+	tx.Set("user", &UserEntity{ID: "u1", Email: "alice@example.com"})
+	tx.Commit()
+
+	// Changing the stored entity in place leaves Old and New the same value
+	tx = db.Transact(false)
+	user, _ := tx.Get("user", "u1")
+	user.(*UserEntity).Email = "alice@new.example.com"
+	tx.Set("user", user)
+	tx.Commit()
+
+	if _, ok := db.Get("user_by_email", "alice@example.com"); ok {
+		t.Error("Expected the record derived from the old email to be removed")
+	}
+	if _, ok := db.Get("user_by_email", "alice@new.example.com"); !ok {
+		t.Error("Expected a record derived from the new email")
+	}
+
+	tx = db.Transact(false)
+	tx.Delete("user", "u1")
+	tx.Commit()
+	if entities := db.GetAll("user_by_email"); len(entities) != 0 {
+		t.Errorf("Expected deleting the source to remove its derived record, got %v", entities)
+	}
+}
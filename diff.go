@@ -0,0 +1,31 @@
+package flexdb
+
+import "reflect"
+
+// FieldChange describes the old and new value of a single field
+type FieldChange struct {
+	Old interface{}
+	New interface{}
+}
+
+// Diff compares two versions of an entity and returns the fields that differ.
+// Either side may be nil, in which case every field of the other side is reported.
+func Diff(old, new Entity) map[string]FieldChange {
+	oldFields := entityFields(old)
+	newFields := entityFields(new)
+	changes := make(map[string]FieldChange)
+
+	for field, oldValue := range oldFields {
+		newValue, ok := newFields[field]
+		if !ok || !reflect.DeepEqual(oldValue, newValue) {
+			changes[field] = FieldChange{Old: oldValue, New: newValue}
+		}
+	}
+	for field, newValue := range newFields {
+		if _, ok := oldFields[field]; !ok {
+			changes[field] = FieldChange{Old: nil, New: newValue}
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,32 @@
+package flexdb
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	old := &TestEntity{ID: "1", Name: "Alice", Value: 30}
+	updated := &TestEntity{ID: "1", Name: "Alice", Value: 31}
+
+	changes := Diff(old, updated)
+	if len(changes) != 1 {
+		t.Fatalf("Expected 1 changed field, got %d: %v", len(changes), changes)
+	}
+	change, ok := changes["Value"]
+	if !ok || change.Old != 30 || change.New != 31 {
+		t.Errorf("Unexpected change for Value: %+v", change)
+	}
+
+	// GenericEntity fields are compared by key, including added and removed ones
+	genericOld := &GenericEntity{ID: "1", Fields: map[string]interface{}{"Name": "Bob", "Age": 40.0}}
+	genericNew := &GenericEntity{ID: "1", Fields: map[string]interface{}{"Name": "Bob", "Email": "bob@example.com"}}
+
+	changes = Diff(genericOld, genericNew)
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changed fields, got %d: %v", len(changes), changes)
+	}
+	if changes["Age"].Old != 40.0 || changes["Age"].New != nil {
+		t.Errorf("Unexpected change for Age: %+v", changes["Age"])
+	}
+	if changes["Email"].Old != nil || changes["Email"].New != "bob@example.com" {
+		t.Errorf("Unexpected change for Email: %+v", changes["Email"])
+	}
+}
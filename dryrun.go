@@ -0,0 +1,39 @@
+package flexdb
+
+import "sort"
+
+// DryRun marks the transaction so Commit records its changes instead of
+// applying them. Nothing is written to disk or to the database, and watchers,
+// observers and the replication sink are not notified. The recorded changes
+// are returned by Intended. It returns the transaction for chaining.
+func (tx *Transaction) DryRun() *Transaction {
+	tx.dryRun = true
+	return tx
+}
+
+// Intended returns the changes a dry-run transaction would have committed,
+// ordered by entity type and ID
+func (tx *Transaction) Intended() []ChangeEvent {
+	return append([]ChangeEvent(nil), tx.intended...)
+}
+
+// recordIntended adds changes to the dry-run log in place of committing them
+func (tx *Transaction) recordIntended(changes map[string]map[string]Entity) {
+	var events []ChangeEvent
+	for entityType, entities := range changes {
+		for id, entity := range entities {
+			event := ChangeEvent{EntityType: entityType, ID: id, Operation: OpSet, Entity: entity}
+			if entity == nil {
+				event.Operation = OpDelete
+			}
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].EntityType != events[j].EntityType {
+			return events[i].EntityType < events[j].EntityType
+		}
+		return events[i].ID < events[j].ID
+	})
+	tx.intended = append(tx.intended, events...)
+}
@@ -0,0 +1,54 @@
+package flexdb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "existing", Name: "kept"})
+	tx.Commit()
+	before, _ := os.ReadFile(dbPath)
+
+	// A handler under test that deletes one entity and creates another
+	handler := func(tx *Transaction) error {
+		if err := tx.Delete("test", "existing"); err != nil {
+			return err
+		}
+		return tx.Set("test", &TestEntity{ID: "created", Name: "new"})
+	}
+
+	tx = db.Transact(false).DryRun()
+	if err := handler(tx); err != nil {
+		t.Fatalf("Handler failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Dry-run commit failed: %v", err)
+	}
+
+	intended := tx.Intended()
+	if len(intended) != 2 {
+		t.Fatalf("Expected 2 intended changes, got %v", intended)
+	}
+	if intended[0].ID != "created" || intended[0].Operation != OpSet || intended[0].Entity.(*TestEntity).Name != "new" {
+		t.Errorf("Expected the set of created first, got %+v", intended[0])
+	}
+	if intended[1].ID != "existing" || intended[1].Operation != OpDelete {
+		t.Errorf("Expected the delete of existing second, got %+v", intended[1])
+	}
+
+	if _, ok := db.Get("test", "existing"); !ok {
+		t.Error("Expected the dry run not to delete existing")
+	}
+	if _, ok := db.Get("test", "created"); ok {
+		t.Error("Expected the dry run not to create entities")
+	}
+	if after, _ := os.ReadFile(dbPath); string(after) != string(before) {
+		t.Error("Expected the dry run not to write the file")
+	}
+}
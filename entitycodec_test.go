@@ -0,0 +1,160 @@
+package flexdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Priority is an enum stored as a string by a custom codec
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityHigh
+)
+
+var priorityNames = map[Priority]string{PriorityLow: "low", PriorityHigh: "high"}
+
+// TicketEntity has a field the generic JSON path would store as a number
+type TicketEntity struct {
+	ID       string
+	Priority Priority
+}
+
+func (t *TicketEntity) GetID() string   { return t.ID }
+func (t *TicketEntity) SetID(id string) { t.ID = id }
+
+func marshalTicket(e Entity) ([]byte, error) {
+	t, ok := e.(*TicketEntity)
+	if !ok {
+		return nil, fmt.Errorf("unexpected entity %T", e)
+	}
+	return json.Marshal(map[string]string{"priority": priorityNames[t.Priority]})
+}
+
+func unmarshalTicket(data []byte) (Entity, error) {
+	var doc struct {
+		Priority string `json:"priority"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	for p, name := range priorityNames {
+		if name == doc.Priority {
+			return &TicketEntity{Priority: p}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown priority %q", doc.Priority)
+}
+
+func TestRegisterCodecFor(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	if err := db.RegisterCodecFor("tickets", marshalTicket, unmarshalTicket); err != nil {
+		t.Fatalf("RegisterCodecFor failed: %v", err)
+	}
+	tx := db.Transact(false)
+	tx.Set("tickets", &TicketEntity{ID: "1", Priority: PriorityHigh})
+	tx.Set("tickets", &TicketEntity{ID: "2", Priority: PriorityLow})
+	tx.Set("test", &TestEntity{ID: "1", Name: "untouched"})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	raw, _ := os.ReadFile(dbPath)
+	if !strings.Contains(string(raw), `"high"`) {
+		t.Errorf("Expected the enum to be written as a string, got %s", raw)
+	}
+
+	reloaded, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	reloaded.AddIndex("tickets", "Priority")
+	if err := reloaded.RegisterCodecFor("tickets", marshalTicket, unmarshalTicket); err != nil {
+		t.Fatalf("RegisterCodecFor after reload failed: %v", err)
+	}
+
+	readTx := reloaded.Transact(true)
+	defer readTx.Rollback()
+	entity, ok := readTx.Get("tickets", "1")
+	ticket, isTicket := entity.(*TicketEntity)
+	if !ok || !isTicket || ticket.ID != "1" || ticket.Priority != PriorityHigh {
+		t.Fatalf("Expected ticket 1 decoded by the codec, got %#v", entity)
+	}
+	results, _ := readTx.NewQuery("tickets").Where("Priority", PriorityLow).Execute()
+	if len(results) != 1 || results[0].GetID() != "2" {
+		t.Errorf("Expected queries to see the decoded values, got %v", results)
+	}
+	if _, ok := readTx.Get("test", "1"); !ok {
+		t.Error("Expected other types to use the default path")
+	}
+}
+
+func TestRegisterCodecForRejectsUndecodableRecords(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("tickets", &GenericEntity{ID: "1", Fields: map[string]interface{}{"priority": "urgent"}})
+	tx.Commit()
+
+	reloaded, _ := NewDatabase(dbPath)
+	if err := reloaded.RegisterCodecFor("tickets", marshalTicket, unmarshalTicket); err == nil {
+		t.Fatal("Expected an error for a record the codec cannot decode")
+	}
+	readTx := reloaded.Transact(true)
+	defer readTx.Rollback()
+	if _, ok := readTx.Get("tickets", "1"); !ok {
+		t.Error("Expected the record to be left as loaded")
+	}
+}
+
+func TestEntityCodecImportedRecords(t *testing.T) {
+	dbPath := "./test_db.json"
+	sourcePath := "./test_db_source.json"
+	defer os.Remove(dbPath)
+	defer os.Remove(sourcePath)
+
+	source, _ := NewDatabase(sourcePath)
+	tx := source.Transact(false)
+	tx.Set("tickets", &GenericEntity{ID: "1", Fields: map[string]interface{}{"priority": "high"}})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	db, _ := NewDatabase(dbPath)
+	if err := db.RegisterCodecFor("tickets", marshalTicket, unmarshalTicket); err != nil {
+		t.Fatalf("RegisterCodecFor failed: %v", err)
+	}
+	if err := db.ImportMerge(sourcePath, MergeOverwrite); err != nil {
+		t.Fatalf("ImportMerge failed: %v", err)
+	}
+	tx = db.Transact(false)
+	batch := []Entity{&GenericEntity{ID: "2", Fields: map[string]interface{}{"priority": "low"}}}
+	if _, err := tx.ImportBatch("tickets", batch, ImportOptions{}); err != nil {
+		t.Fatalf("ImportBatch failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit of a generic record failed: %v", err)
+	}
+
+	reloaded, _ := NewDatabase(dbPath)
+	if err := reloaded.RegisterCodecFor("tickets", marshalTicket, unmarshalTicket); err != nil {
+		t.Fatalf("RegisterCodecFor after reload failed: %v", err)
+	}
+	readTx := reloaded.Transact(true)
+	defer readTx.Rollback()
+	for id, want := range map[string]Priority{"1": PriorityHigh, "2": PriorityLow} {
+		entity, _ := readTx.Get("tickets", id)
+		if ticket, ok := entity.(*TicketEntity); !ok || ticket.Priority != want {
+			t.Errorf("Expected ticket %s to be written with the codec, got %#v", id, entity)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package flexdb
+
+// QueryCost is a pre-flight estimate of the work a query will do
+type QueryCost struct {
+	// IndexUsable reports whether Execute serves an equality filter from an index
+	IndexUsable bool
+	// IndexField is the field whose index, time partition or prefix index
+	// narrows the scan, if any
+	IndexField string
+	// TotalEntities is the number of entities of the queried type
+	TotalEntities int
+	// EstimatedScan is the number of entities the filters will be evaluated against
+	EstimatedScan int
+}
+
+// IndexStats describes the cardinality of an index
+type IndexStats struct {
+	// Entries is the number of indexed entities
+	Entries int
+	// DistinctValues is the number of distinct indexed values
+	DistinctValues int
+	// MaxBucketSize is the largest number of entities sharing one value
+	MaxBucketSize int
+}
+
+// IndexStats returns cardinality statistics for an index. The zero value is
+// returned when the field is not indexed.
+func (db *Database) IndexStats(entityType, field string) IndexStats {
+	entityType = db.typeName(entityType)
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return indexStats(db.indexes[entityType][field])
+}
+
+// indexStats computes the statistics of an index. The caller must hold the lock.
+func indexStats(index map[string][]string) IndexStats {
+	stats := IndexStats{DistinctValues: len(index)}
+	for _, ids := range index {
+		stats.Entries += len(ids)
+		if len(ids) > stats.MaxBucketSize {
+			stats.MaxBucketSize = len(ids)
+		}
+	}
+	return stats
+}
+
+// EstimateCost estimates the cost of the query without running it. It picks
+// the same narrowing Execute does, so EstimatedScan is the number of entities
+// Execute evaluates the filters against: when several Where fields are
+// indexed, the one with the smallest bucket for the queried value is used,
+// and ties go to the index with more distinct values. A time partition or
+// prefix index is used instead when it narrows the scan further.
+func (q *Query) EstimateCost() QueryCost {
+	total := q.tx.Count(q.entityType)
+	cost := QueryCost{TotalEntities: total, EstimatedScan: total}
+
+	q.tx.db.mu.RLock()
+	defer q.tx.db.mu.RUnlock()
+
+	n, ok := q.narrow()
+	if !ok {
+		return cost
+	}
+	changed := q.tx.changes[q.entityType]
+	scan := 0
+	for _, id := range n.ids {
+		if _, ok := changed[id]; !ok {
+			scan++
+		}
+	}
+	for _, entity := range changed {
+		if entity != nil {
+			scan++
+		}
+	}
+	cost.IndexUsable = n.equality
+	cost.IndexField = n.field
+	cost.EstimatedScan = scan
+	return cost
+}
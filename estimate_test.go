@@ -0,0 +1,125 @@
+package flexdb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestEstimateCost(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	for i := 0; i < 100; i++ {
+		tx.Set("test", &TestEntity{ID: fmt.Sprint(i), Name: fmt.Sprint("name", i%10), Value: i % 2})
+	}
+	tx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	cost := readTx.NewQuery("test").Where("Name", "name3").EstimateCost()
+	if cost.IndexUsable || cost.TotalEntities != 100 || cost.EstimatedScan != 100 {
+		t.Errorf("Expected a full scan without an index, got %+v", cost)
+	}
+
+	db.AddIndex("test", "Name")
+	db.AddIndex("test", "Value")
+
+	cost = readTx.NewQuery("test").Where("Value", 1).Where("Name", "name3").EstimateCost()
+	if !cost.IndexUsable || cost.IndexField != "Name" || cost.EstimatedScan != 10 {
+		t.Errorf("Expected the Name index to narrow the scan to 10, got %+v", cost)
+	}
+
+	cost = readTx.NewQuery("test").WhereLike("Name", "name").EstimateCost()
+	if cost.IndexUsable {
+		t.Errorf("Expected no index for a LIKE filter, got %+v", cost)
+	}
+}
+
+func TestIndexStats(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.AddIndex("test", "Name")
+	db.AddIndex("test", "Value")
+
+	tx := db.Transact(false)
+	// Value has 2 distinct values of 5 each; Name has one bucket of 5 and five singletons
+	for i := 0; i < 10; i++ {
+		name := "shared"
+		if i >= 5 {
+			name = fmt.Sprint("unique", i)
+		}
+		tx.Set("test", &TestEntity{ID: fmt.Sprint(i), Name: name, Value: i % 2})
+	}
+	tx.Commit()
+
+	if stats := db.IndexStats("test", "Value"); stats != (IndexStats{Entries: 10, DistinctValues: 2, MaxBucketSize: 5}) {
+		t.Errorf("Unexpected Value stats: %+v", stats)
+	}
+	if stats := db.IndexStats("test", "Name"); stats != (IndexStats{Entries: 10, DistinctValues: 6, MaxBucketSize: 5}) {
+		t.Errorf("Unexpected Name stats: %+v", stats)
+	}
+	if stats := db.IndexStats("test", "missing"); stats != (IndexStats{}) {
+		t.Errorf("Expected zero stats for a missing index, got %+v", stats)
+	}
+
+	// Both queried buckets hold 5 entities; the planner prefers the more selective index
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+	cost := readTx.NewQuery("test").Where("Value", 0).Where("Name", "shared").EstimateCost()
+	if cost.IndexField != "Name" || cost.EstimatedScan != 5 {
+		t.Errorf("Expected the planner to pick the Name index, got %+v", cost)
+	}
+}
+
+func TestEstimateCostMatchesExecute(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.AddIndex("test", "Name")
+	db.AddIndex("test", "Value")
+	db.AddPrefixIndex("test", "Name")
+	tx := db.Transact(false)
+	for i := 0; i < 100; i++ {
+		tx.Set("test", &TestEntity{ID: fmt.Sprint(i), Name: fmt.Sprint("name", i%10), Value: i % 2})
+	}
+	tx.Commit()
+
+	tx = db.Transact(false)
+	defer tx.Rollback()
+	tx.Set("test", &TestEntity{ID: "new", Name: "name3", Value: 1})
+	tx.Set("test", &TestEntity{ID: "3", Name: "renamed", Value: 1})
+	tx.Delete("test", "13")
+
+	queries := map[string]func(*Query) *Query{
+		"equality": func(q *Query) *Query { return q.Where("Value", 1).Where("Name", "name3") },
+		"prefix":   func(q *Query) *Query { return q.WherePrefix("Name", "name1") },
+		"scan":     func(q *Query) *Query { return q.WhereLike("Name", "3") },
+	}
+	for name, build := range queries {
+		evaluated := 0
+		q := build(tx.NewQuery("test").WhereFunc(func(Entity) bool {
+			evaluated++
+			return true
+		}))
+		cost := q.EstimateCost()
+		if _, err := q.Execute(); err != nil {
+			t.Fatalf("%s: Execute failed: %v", name, err)
+		}
+		if cost.EstimatedScan != evaluated {
+			t.Errorf("%s: estimated a scan of %d but Execute evaluated %d (%+v)", name, cost.EstimatedScan, evaluated, cost)
+		}
+		if name == "scan" && evaluated != tx.Count("test") {
+			t.Errorf("%s: expected a full scan, evaluated %d", name, evaluated)
+		}
+		if name == "equality" && (!cost.IndexUsable || cost.IndexField != "Name" || evaluated >= 50) {
+			t.Errorf("%s: expected the Name index to narrow the scan, got %+v", name, cost)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package flexdb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Filter operators
+const (
+	FilterOpAnd  = "and"
+	FilterOpOr   = "or"
+	FilterOpNot  = "not"
+	FilterOpEq   = "eq"
+	FilterOpGt   = "gt"
+	FilterOpLt   = "lt"
+	FilterOpIn   = "in"
+	FilterOpLike = "like"
+)
+
+// Filter is a node in a filter expression tree. Leaf nodes compare Field
+// against Value; And, Or and Not combine child Filters. Filters can be
+// marshalled to and from JSON so queries can be built from data.
+type Filter struct {
+	Op      string      `json:"op"`
+	Field   string      `json:"field,omitempty"`
+	Value   interface{} `json:"value,omitempty"`
+	Filters []Filter    `json:"filters,omitempty"`
+}
+
+// FilterAnd matches when every child filter matches
+func FilterAnd(filters ...Filter) Filter {
+	return Filter{Op: FilterOpAnd, Filters: filters}
+}
+
+// FilterOr matches when any child filter matches
+func FilterOr(filters ...Filter) Filter {
+	return Filter{Op: FilterOpOr, Filters: filters}
+}
+
+// FilterNot matches when the child filter does not
+func FilterNot(filter Filter) Filter {
+	return Filter{Op: FilterOpNot, Filters: []Filter{filter}}
+}
+
+// FilterEq matches when field equals value
+func FilterEq(field string, value interface{}) Filter {
+	return Filter{Op: FilterOpEq, Field: field, Value: value}
+}
+
+// FilterGt matches when field is greater than value
+func FilterGt(field string, value interface{}) Filter {
+	return Filter{Op: FilterOpGt, Field: field, Value: value}
+}
+
+// FilterLt matches when field is less than value
+func FilterLt(field string, value interface{}) Filter {
+	return Filter{Op: FilterOpLt, Field: field, Value: value}
+}
+
+// FilterIn matches when field equals one of values
+func FilterIn(field string, values ...interface{}) Filter {
+	return Filter{Op: FilterOpIn, Field: field, Value: values}
+}
+
+// FilterLike matches when field is a string containing value
+func FilterLike(field string, value string) Filter {
+	return Filter{Op: FilterOpLike, Field: field, Value: value}
+}
+
+// Apply adds the filter tree to the query. An invalid tree is reported by Execute.
+func (q *Query) Apply(f Filter) *Query {
+	pred, err := f.compile()
+	if err != nil {
+		if q.err == nil {
+			q.err = err
+		}
+		return q
+	}
+	q.addFilter(f.String(), pred)
+	return q
+}
+
+// compile translates the filter tree into a predicate
+func (f Filter) compile() (func(Entity) bool, error) {
+	switch f.Op {
+	case FilterOpAnd, FilterOpOr:
+		preds := make([]func(Entity) bool, 0, len(f.Filters))
+		for _, child := range f.Filters {
+			pred, err := child.compile()
+			if err != nil {
+				return nil, err
+			}
+			preds = append(preds, pred)
+		}
+		if f.Op == FilterOpAnd {
+			return func(e Entity) bool {
+				for _, pred := range preds {
+					if !pred(e) {
+						return false
+					}
+				}
+				return true
+			}, nil
+		}
+		return func(e Entity) bool {
+			for _, pred := range preds {
+				if pred(e) {
+					return true
+				}
+			}
+			return false
+		}, nil
+
+	case FilterOpNot:
+		if len(f.Filters) != 1 {
+			return nil, fmt.Errorf("not filter requires exactly one child, got %d", len(f.Filters))
+		}
+		pred, err := f.Filters[0].compile()
+		if err != nil {
+			return nil, err
+		}
+		return func(e Entity) bool { return !pred(e) }, nil
+
+	case FilterOpEq:
+		return f.fieldPredicate(func(v interface{}) bool { return valuesEqual(v, f.Value) }), nil
+
+	case FilterOpGt, FilterOpLt:
+		want := 1
+		if f.Op == FilterOpLt {
+			want = -1
+		}
+		return f.fieldPredicate(func(v interface{}) bool {
+			c, ok := compareValues(v, f.Value)
+			return ok && c == want
+		}), nil
+
+	case FilterOpIn:
+		values, ok := f.Value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("in filter on %s requires a list value", f.Field)
+		}
+		return f.fieldPredicate(func(v interface{}) bool {
+			for _, candidate := range values {
+				if valuesEqual(v, candidate) {
+					return true
+				}
+			}
+			return false
+		}), nil
+
+	case FilterOpLike:
+		substr, ok := f.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("like filter on %s requires a string value", f.Field)
+		}
+		return f.fieldPredicate(func(v interface{}) bool {
+			s, ok := v.(string)
+			return ok && strings.Contains(s, substr)
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown filter op %q", f.Op)
+}
+
+// fieldPredicate matches entities that have the filter's field and whose value satisfies match
+func (f Filter) fieldPredicate(match func(interface{}) bool) func(Entity) bool {
+	return func(e Entity) bool {
+		v, ok := getField(e, f.Field)
+		return ok && match(v)
+	}
+}
@@ -0,0 +1,60 @@
+package flexdb
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestQueryApplyFilter(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "Alice", Value: 10})
+	tx.Set("test", &TestEntity{ID: "2", Name: "Bob", Value: 20})
+	tx.Set("test", &TestEntity{ID: "3", Name: "Carol", Value: 30})
+	tx.Set("test", &TestEntity{ID: "4", Name: "Dave", Value: 40})
+	tx.Commit()
+
+	// (Name = Alice OR Name LIKE "ar") AND Value > 15
+	f := FilterAnd(
+		FilterOr(FilterEq("Name", "Alice"), FilterLike("Name", "ar")),
+		FilterGt("Value", 15),
+	)
+
+	// Round-trip through JSON to make sure serialized filters still work
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded Filter
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	for name, filter := range map[string]Filter{"built": f, "decoded": decoded} {
+		readTx := db.Transact(true)
+		results, err := readTx.NewQuery("test").Apply(filter).Execute()
+		readTx.Rollback()
+		if err != nil {
+			t.Fatalf("%s: Execute failed: %v", name, err)
+		}
+		if len(results) != 1 || results[0].GetID() != "3" {
+			t.Errorf("%s: expected only Carol, got %v", name, results)
+		}
+	}
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	results, _ := readTx.NewQuery("test").Apply(FilterNot(FilterIn("Value", 10, 40))).Execute()
+	if len(results) != 2 {
+		t.Errorf("Expected 2 results for NOT IN, got %d", len(results))
+	}
+
+	if _, err := readTx.NewQuery("test").Apply(Filter{Op: "bogus"}).Execute(); err == nil {
+		t.Error("Expected an error for an unknown filter op")
+	}
+}
@@ -1,10 +1,12 @@
 package flexdb
 
 import (
+	"bytes"
+	"cmp"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
@@ -14,6 +16,17 @@ import (
 	"github.com/patrickmn/go-cache"
 )
 
+var (
+	// ErrNilEntity is returned when a nil entity is passed to a write operation
+	ErrNilEntity = errors.New("entity must not be nil")
+	// ErrEmptyID is returned when an entity without an ID is written
+	ErrEmptyID = errors.New("entity ID must not be empty")
+	// ErrNotFound is returned when a requested entity does not exist
+	ErrNotFound = errors.New("entity not found")
+	// ErrCallbackPanic wraps panics recovered from hooks and other user callbacks
+	ErrCallbackPanic = errors.New("callback panicked")
+)
+
 type GenericEntity struct {
 	ID     string
 	Fields map[string]interface{}
@@ -22,6 +35,31 @@ type GenericEntity struct {
 func (ge *GenericEntity) GetID() string   { return ge.ID }
 func (ge *GenericEntity) SetID(id string) { ge.ID = id }
 
+// MarshalJSON encodes the entity as a flat object of its fields with the ID
+// merged in, matching the shape typed entities are saved in
+func (ge *GenericEntity) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]interface{}, len(ge.Fields)+1)
+	for k, v := range ge.Fields {
+		fields[k] = v
+	}
+	idKey := "ID"
+	if _, ok := fields["ID"]; !ok {
+		if _, ok := fields["id"]; ok {
+			idKey = "id"
+		}
+	}
+	fields[idKey] = ge.ID
+
+	// HTML escaping is left to the encoder writing the database file
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(fields); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
 // Entity represents a generic database entity
 type Entity interface {
 	GetID() string
@@ -30,18 +68,64 @@ type Entity interface {
 
 // Database represents the main database object
 type Database struct {
-	path       string
-	mu         sync.RWMutex
-	data       map[string]map[string]Entity
-	indexes    map[string]map[string]map[string][]string
-	hooks      map[string][]Hook
-	cache      *cache.Cache
-	migrations []Migration
+	path           string
+	mu             sync.RWMutex
+	data           map[string]map[string]Entity
+	indexes        map[string]map[string]map[string][]string
+	partitions     map[string]*timePartition
+	prefixes       map[string]map[string]*prefixIndex
+	hooks          map[string][]Hook
+	hooksV2        map[string][]HookV2
+	collections    map[string]*collection
+	cache          Cache
+	migrations     []Migration
+	typeMigrations map[string][]Migration
+	stats          txStats
+	escapeHTML     bool
+	indent         string
+	codec          Codec
+	syncMode       SyncMode
+	lastSync       time.Time
+	saveRetries    int
+	saveBackoff    time.Duration
+	storage        Storage
+	ioTimeout      time.Duration
+	abandonedWrite bool
+	middleware     []Middleware
+	globalIDs      bool
+	maxFileSize    int64
+	checksums      bool
+	foldTypes      bool
+	rotated        map[string]map[string]Entity
+	dirty          map[string]map[string]bool
+	lastDelta      map[string]map[string]Entity
+	blooms         sync.Map
+	pageOnce       sync.Once
+	pages          *cache.Cache
+	watchMu        sync.Mutex
+	watchers       []*watcher
+
+	migrationObserver func(MigrationEvent)
+	commitObserver    func(CommitMetrics)
+
+	replicationSink     func([]ChangeEvent) error
+	replicationRequired bool
 }
 
 // Hook is a function that can be registered to run before or after certain database operations
 type Hook func(tx *Transaction, entityType string, entity Entity) error
 
+// HookEvent describes the change a HookV2 is invoked for
+type HookEvent struct {
+	EntityType string
+	Operation  string
+	Old        Entity
+	New        Entity
+}
+
+// HookV2 is a hook registered with RegisterHookV2
+type HookV2 func(tx *Transaction, ev HookEvent) error
+
 // Migration represents a database migration
 type Migration struct {
 	Version int
@@ -49,79 +133,248 @@ type Migration struct {
 	Down    func(*Transaction) error
 }
 
+const (
+	// DirectionUp identifies a migration being applied
+	DirectionUp = "up"
+	// DirectionDown identifies a migration being reverted
+	DirectionDown = "down"
+)
+
+// MigrationEvent is passed to the migration observer before (Done is false)
+// and after (Done is true) a migration runs
+type MigrationEvent struct {
+	Version   int
+	Direction string
+	Done      bool
+	Err       error
+}
+
 // NewDatabase creates and initializes a new database
-func NewDatabase(path string) (*Database, error) {
+func NewDatabase(path string, opts ...Option) (*Database, error) {
 	db := &Database{
-		path:       path,
-		data:       make(map[string]map[string]Entity),
-		indexes:    make(map[string]map[string]map[string][]string),
-		hooks:      make(map[string][]Hook),
-		cache:      cache.New(5*time.Minute, 10*time.Minute),
-		migrations: []Migration{},
+		path:        path,
+		data:        make(map[string]map[string]Entity),
+		indexes:     make(map[string]map[string]map[string][]string),
+		partitions:  make(map[string]*timePartition),
+		prefixes:    make(map[string]map[string]*prefixIndex),
+		hooks:       make(map[string][]Hook),
+		hooksV2:     make(map[string][]HookV2),
+		collections: make(map[string]*collection),
+		cache:       newMemoryCache(),
+		storage:     fileStorage{},
+		migrations:  []Migration{},
+		escapeHTML:  true,
+		indent:      "  ",
+	}
+	for _, opt := range opts {
+		opt(db)
+	}
+	if _, ok := db.storage.(RotatingStorage); db.maxFileSize > 0 && !ok {
+		return nil, errors.New("WithMaxFileSize needs a Storage that implements RotatingStorage")
 	}
 
 	if err := db.load(); err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
+	for entityType := range db.data {
+		if base, ok := strings.CutPrefix(entityType, historyType("")); ok {
+			db.indexHistory(base)
+		}
+	}
 
 	return db, nil
 }
 
 func (db *Database) load() error {
-	data, err := os.ReadFile(db.path)
+	if db.maxFileSize > 0 {
+		return db.loadRotated()
+	}
+
+	docs, err := db.readFile(db.path)
 	if err != nil {
 		return err
 	}
+	db.applyDocs(docs)
+	return nil
+}
 
-	var rawData map[string]map[string]json.RawMessage
-	if err := json.Unmarshal(data, &rawData); err != nil {
-		return err
+// readFile reads and decodes a database file
+func (db *Database) readFile(path string) (map[string]map[string]map[string]interface{}, error) {
+	data, err := db.readStorage(path)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := db.decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyChecksums(docs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
+	return docs, nil
+}
 
-	for entityType, entities := range rawData {
-		db.data[entityType] = make(map[string]Entity)
-		for id, rawEntity := range entities {
-			var entity map[string]interface{}
-			if err := json.Unmarshal(rawEntity, &entity); err != nil {
-				return err
+// applyDocs merges decoded documents into the data as GenericEntity values.
+// Tombstones written by file rotation remove the entity instead. It returns
+// the entities applied, with nil marking a tombstone.
+func (db *Database) applyDocs(docs map[string]map[string]map[string]interface{}) map[string]map[string]Entity {
+	applied := make(map[string]map[string]Entity, len(docs))
+	for entityType, entities := range docs {
+		entityType = db.typeName(entityType)
+		if db.data[entityType] == nil {
+			db.data[entityType] = make(map[string]Entity, len(entities))
+		}
+		if applied[entityType] == nil {
+			applied[entityType] = make(map[string]Entity, len(entities))
+		}
+		for id, entity := range entities {
+			if isTombstone(entity) {
+				delete(db.data[entityType], id)
+				applied[entityType][id] = nil
+				continue
 			}
-			db.data[entityType][id] = &GenericEntity{
+			if fields, ok := legacyGenericFields(entity); ok {
+				entity = fields
+			}
+			ge := &GenericEntity{
 				ID:     id,
 				Fields: entity,
 			}
+			db.data[entityType][id] = ge
+			applied[entityType][id] = ge
 		}
 	}
-
-	return nil
+	return applied
 }
 
 func (db *Database) save() error {
-	data, err := json.MarshalIndent(db.data, "", "  ")
+	_, _, err := db.saveReport()
+	return err
+}
+
+// saveReport saves the database and reports the bytes written and whether the
+// whole database was rewritten, rather than only the changes since the last rotation
+func (db *Database) saveReport() (int64, bool, error) {
+	delta := db.persistedData()
+	data, err := db.encodeData(delta)
 	if err != nil {
-		return err
+		return 0, false, err
 	}
 
-	dir := filepath.Dir(db.path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
+	if db.maxFileSize > 0 && int64(len(data)) > db.maxFileSize && len(db.lastDelta) > 0 {
+		if err := db.rotate(); err != nil {
+			return 0, false, err
+		}
+		delta = db.persistedData()
+		if data, err = db.encodeData(delta); err != nil {
+			return 0, false, err
+		}
 	}
 
-	return os.WriteFile(db.path, data, 0644)
+	lastSync := db.lastSync
+	if err := db.writeWithRetry(data, db.shouldSync(time.Now())); err != nil {
+		// Nothing reached the disk, so the next save must not skip its fsync
+		db.lastSync = lastSync
+		return 0, false, err
+	}
+	if db.maxFileSize > 0 {
+		// Before the first rotation delta is the live data, so take a copy
+		db.lastDelta = copyData(delta)
+		db.markSaved()
+	}
+	return int64(len(data)), db.rotated == nil, nil
 }
 
 // AddIndex creates an index for faster querying
 func (db *Database) AddIndex(entityType, field string) {
+	entityType = db.typeName(entityType)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.buildIndex(entityType, field)
+}
+
+// Reindex drops and rebuilds every index of an entity type from committed data in a single scan
+func (db *Database) Reindex(entityType string) {
+	entityType = db.typeName(entityType)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	indexes := db.indexes[entityType]
+	for field := range indexes {
+		indexes[field] = make(map[string][]string)
+	}
+	for id, entity := range db.data[entityType] {
+		for field, index := range indexes {
+			if key, ok := indexKey(entity, field); ok {
+				index[key] = append(index[key], id)
+			}
+		}
+	}
+	if p := db.partitions[entityType]; p != nil {
+		db.buildPartition(entityType, p.field, p.granularity)
+	}
+	for field := range db.prefixes[entityType] {
+		db.buildPrefixIndex(entityType, field)
+	}
+}
+
+// IndexEntries returns a copy of the value to IDs mapping of an index
+func (db *Database) IndexEntries(entityType, field string) map[string][]string {
+	entityType = db.typeName(entityType)
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	entries := make(map[string][]string, len(db.indexes[entityType][field]))
+	for value, ids := range db.indexes[entityType][field] {
+		entries[value] = append([]string(nil), ids...)
+	}
+	return entries
+}
+
+// Reserve preallocates storage for n entities of a type, including its
+// current indexes and any added later, to avoid repeated map growth during
+// large imports. It never shrinks existing storage.
+func (db *Database) Reserve(entityType string, n int) {
+	entityType = db.typeName(entityType)
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
+	db.collectionFor(entityType).capacity = n
+
+	if existing := db.data[entityType]; len(existing) < n {
+		data := make(map[string]Entity, n)
+		for id, entity := range existing {
+			data[id] = entity
+		}
+		db.data[entityType] = data
+	}
+	for field, index := range db.indexes[entityType] {
+		if len(index) < n {
+			grown := make(map[string][]string, n)
+			for key, ids := range index {
+				grown[key] = ids
+			}
+			db.indexes[entityType][field] = grown
+		}
+	}
+}
+
+// buildIndex (re)creates the index for a field from committed data. The caller must hold the write lock.
+func (db *Database) buildIndex(entityType, field string) {
 	if db.indexes[entityType] == nil {
 		db.indexes[entityType] = make(map[string]map[string][]string)
 	}
-	db.indexes[entityType][field] = make(map[string][]string)
+	db.indexes[entityType][field] = make(map[string][]string, db.collectionFor(entityType).capacity)
 
 	for id, entity := range db.data[entityType] {
-		value := reflect.ValueOf(entity).Elem().FieldByName(field).String()
-		db.indexes[entityType][field][value] = append(db.indexes[entityType][field][value], id)
+		if key, ok := indexKey(entity, field); ok {
+			db.indexes[entityType][field][key] = append(db.indexes[entityType][field][key], id)
+		}
 	}
 }
 
@@ -133,6 +386,15 @@ func (db *Database) RegisterHook(operation string, hook Hook) {
 	db.hooks[operation] = append(db.hooks[operation], hook)
 }
 
+// RegisterHookV2 adds a hook that receives both the previous and the new
+// version of the entity. Old is nil for inserts and New is nil for deletes.
+func (db *Database) RegisterHookV2(operation string, hook HookV2) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.hooksV2[operation] = append(db.hooksV2[operation], hook)
+}
+
 // AddMigration adds a new migration to the database
 func (db *Database) AddMigration(version int, up, down func(*Transaction) error) {
 	db.migrations = append(db.migrations, Migration{
@@ -142,28 +404,204 @@ func (db *Database) AddMigration(version int, up, down func(*Transaction) error)
 	})
 }
 
+// MigrationResult summarises a Migrate, MigrateDown, MigrateType or MigrateTypeDown run
+type MigrationResult struct {
+	FromVersion int
+	ToVersion   int
+	// Applied lists the versions run, in the order they ran
+	Applied []int
+	// Created, Updated and Deleted count the entities the migrations changed,
+	// not including the version record
+	Created int
+	Updated int
+	Deleted int
+}
+
 // Migrate runs all pending migrations up to the specified version
-func (db *Database) Migrate(targetVersion int) error {
+func (db *Database) Migrate(targetVersion int) (MigrationResult, error) {
+	return db.migrateUp(db.migrations, migrationVersionType(""), targetVersion)
+}
+
+// MigrateDown reverts applied migrations, newest first, until the database is at the specified version
+func (db *Database) MigrateDown(targetVersion int) (MigrationResult, error) {
+	return db.migrateDown(db.migrations, migrationVersionType(""), targetVersion)
+}
+
+// AddTypeMigration adds a migration that belongs to a single entity type.
+// Type migrations are versioned independently of global migrations and of
+// other types, in a version record of type "migration:<entityType>".
+func (db *Database) AddTypeMigration(entityType string, version int, up, down func(*Transaction) error) {
+	entityType = db.typeName(entityType)
+
+	if db.typeMigrations == nil {
+		db.typeMigrations = make(map[string][]Migration)
+	}
+	db.typeMigrations[entityType] = append(db.typeMigrations[entityType], Migration{
+		Version: version,
+		Up:      up,
+		Down:    down,
+	})
+}
+
+// MigrateType runs the entity type's pending migrations up to the specified version
+func (db *Database) MigrateType(entityType string, targetVersion int) (MigrationResult, error) {
+	entityType = db.typeName(entityType)
+
+	return db.migrateUp(db.typeMigrations[entityType], migrationVersionType(entityType), targetVersion)
+}
+
+// MigrateTypeDown reverts the entity type's applied migrations until it is at the specified version
+func (db *Database) MigrateTypeDown(entityType string, targetVersion int) (MigrationResult, error) {
+	entityType = db.typeName(entityType)
+
+	return db.migrateDown(db.typeMigrations[entityType], migrationVersionType(entityType), targetVersion)
+}
+
+// TypeVersion returns the migration version an entity type is at. An empty
+// entityType returns the version of the global migrations.
+func (db *Database) TypeVersion(entityType string) (int, error) {
+	entityType = db.typeName(entityType)
+
+	tx := db.snapshotTx()
+	return getCurrentVersion(tx, migrationVersionType(entityType))
+}
+
+// migrateUp runs pending migrations up to targetVersion, tracking progress in the version record of versionType
+func (db *Database) migrateUp(registered []Migration, versionType string, targetVersion int) (MigrationResult, error) {
+	migrations, err := sortMigrations(registered)
+	if err != nil {
+		return MigrationResult{}, err
+	}
+
 	tx := db.Transact(false)
 	defer tx.Rollback() // This will handle unlocking properly
 
-	currentVersion, err := getCurrentVersion(tx)
+	currentVersion, err := getCurrentVersion(tx, versionType)
 	if err != nil {
-		return err
+		return MigrationResult{}, err
 	}
+	result := MigrationResult{FromVersion: currentVersion, ToVersion: currentVersion}
 
-	for _, migration := range db.migrations {
+	for _, migration := range migrations {
 		if migration.Version > currentVersion && migration.Version <= targetVersion {
-			if err := migration.Up(tx); err != nil {
-				return err
+			if err := db.runMigration(tx, migration, DirectionUp); err != nil {
+				return MigrationResult{}, err
 			}
-			if err := setCurrentVersion(tx, migration.Version); err != nil {
-				return err
+			if err := setCurrentVersion(tx, versionType, migration.Version); err != nil {
+				return MigrationResult{}, err
 			}
+			result.Applied = append(result.Applied, migration.Version)
+			result.ToVersion = migration.Version
 		}
 	}
 
-	return tx.Commit()
+	return tx.commitMigration(versionType, result)
+}
+
+// migrateDown reverts applied migrations down to targetVersion, tracking progress in the version record of versionType
+func (db *Database) migrateDown(registered []Migration, versionType string, targetVersion int) (MigrationResult, error) {
+	migrations, err := sortMigrations(registered)
+	if err != nil {
+		return MigrationResult{}, err
+	}
+
+	tx := db.Transact(false)
+	defer tx.Rollback()
+
+	currentVersion, err := getCurrentVersion(tx, versionType)
+	if err != nil {
+		return MigrationResult{}, err
+	}
+	result := MigrationResult{FromVersion: currentVersion, ToVersion: currentVersion}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if migration.Version > currentVersion || migration.Version <= targetVersion {
+			continue
+		}
+		if err := db.runMigration(tx, migration, DirectionDown); err != nil {
+			return MigrationResult{}, err
+		}
+		version := targetVersion
+		if i > 0 && migrations[i-1].Version > targetVersion {
+			version = migrations[i-1].Version
+		}
+		if err := setCurrentVersion(tx, versionType, version); err != nil {
+			return MigrationResult{}, err
+		}
+		result.Applied = append(result.Applied, migration.Version)
+		result.ToVersion = version
+	}
+
+	return tx.commitMigration(versionType, result)
+}
+
+// commitMigration counts the entities the migrations changed into result and
+// commits them. Changes to the version record of versionType are not counted.
+func (tx *Transaction) commitMigration(versionType string, result MigrationResult) (MigrationResult, error) {
+	for entityType, entities := range tx.changes {
+		if entityType == versionType {
+			continue
+		}
+		for id, entity := range entities {
+			_, existed := tx.db.getCommitted(entityType, id)
+			switch {
+			case entity == nil && existed:
+				result.Deleted++
+			case entity != nil && existed:
+				result.Updated++
+			case entity != nil:
+				result.Created++
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return MigrationResult{}, err
+	}
+	return result, nil
+}
+
+// SetMigrationObserver registers a callback invoked before and after each migration runs
+func (db *Database) SetMigrationObserver(observer func(MigrationEvent)) {
+	db.migrationObserver = observer
+}
+
+// runMigration runs a single migration in the given direction, notifying the migration observer
+func (db *Database) runMigration(tx *Transaction, migration Migration, direction string) error {
+	fn := migration.Up
+	if direction == DirectionDown {
+		fn = migration.Down
+	}
+
+	db.notifyMigration(MigrationEvent{Version: migration.Version, Direction: direction})
+	var err error
+	if fn == nil {
+		err = fmt.Errorf("migration %d has no %s function", migration.Version, direction)
+	} else {
+		err = fn(tx)
+	}
+	db.notifyMigration(MigrationEvent{Version: migration.Version, Direction: direction, Done: true, Err: err})
+	return err
+}
+
+func (db *Database) notifyMigration(event MigrationEvent) {
+	if db.migrationObserver != nil {
+		db.migrationObserver(event)
+	}
+}
+
+// sortMigrations returns migrations ordered by version, rejecting duplicate versions
+func sortMigrations(registered []Migration) ([]Migration, error) {
+	migrations := append([]Migration(nil), registered...)
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+	return migrations, nil
 }
 
 // Transaction represents a database transaction
@@ -172,10 +610,19 @@ type Transaction struct {
 	readOnly  bool
 	changes   map[string]map[string]Entity
 	committed bool
+	closed    bool
+	dryRun    bool
+	intended  []ChangeEvent
+
+	// undo records the pending changes replaced since the outermost open
+	// savepoint, so a failed step can be discarded whole
+	undo       []pendingUndo
+	savepoints int
 }
 
 // Transact starts a new transaction
 func (db *Database) Transact(readOnly bool) *Transaction {
+	db.stats.txOpened(readOnly)
 	return &Transaction{
 		db:        db,
 		readOnly:  readOnly,
@@ -184,66 +631,412 @@ func (db *Database) Transact(readOnly bool) *Transaction {
 	}
 }
 
+// Update runs fn in a write transaction, committing when fn returns nil and
+// rolling back when it returns an error or panics. A panic is returned as an
+// error wrapping ErrCallbackPanic.
+func (db *Database) Update(fn func(tx *Transaction) error) error {
+	tx := db.Transact(false)
+	if err := safeCall("update", func() error { return fn(tx) }); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// View runs fn in a read-only transaction, which is always rolled back.
+// A panic is returned as an error wrapping ErrCallbackPanic.
+func (db *Database) View(fn func(tx *Transaction) error) error {
+	tx := db.Transact(true)
+	defer tx.Rollback()
+	return safeCall("view", func() error { return fn(tx) })
+}
+
+// Get retrieves a committed entity by type and ID without an explicit transaction
+func (db *Database) Get(entityType, id string) (Entity, bool) {
+	tx := db.Transact(true)
+	defer tx.Rollback()
+	return tx.Get(entityType, id)
+}
+
+// GetAll retrieves every committed entity of a type without an explicit transaction
+func (db *Database) GetAll(entityType string) []Entity {
+	tx := db.Transact(true)
+	defer tx.Rollback()
+	return tx.GetAll(entityType)
+}
+
+// Query creates a query over the committed entities of a type without an explicit transaction
+func (db *Database) Query(entityType string) *Query {
+	return db.snapshotTx().NewQuery(entityType)
+}
+
+// snapshotTx returns a read-only transaction for internal reads whose
+// lifetime is not managed by the caller, so it is not counted in TxStats
+func (db *Database) snapshotTx() *Transaction {
+	return &Transaction{
+		db:       db,
+		readOnly: true,
+		changes:  make(map[string]map[string]Entity),
+		closed:   true,
+	}
+}
+
 // Commit applies the transaction changes and releases the lock
 func (tx *Transaction) Commit() error {
+	defer tx.close()
+	if tx.readOnly {
+		return nil
+	}
+	if tx.dryRun {
+		tx.recordIntended(tx.changes)
+		return nil
+	}
+	if !hasChanges(tx.changes) {
+		// Nothing to write, so leave the file, indexes and cache untouched
+		tx.committed = true
+		return nil
+	}
+
+	events, metrics, err := tx.apply()
+	if err != nil {
+		return err
+	}
+
+	// Notify watchers once the write lock has been released
+	tx.db.publish(events)
+	tx.db.notifyCommit(metrics)
+	return nil
+}
+
+// CommitTypes commits only the pending changes to the named entity types,
+// saving them to the file, and leaves the changes to other types pending in
+// the transaction, which stays open.
+func (tx *Transaction) CommitTypes(entityTypes ...string) error {
 	if tx.readOnly {
 		return nil
 	}
+	if tx.closed {
+		return fmt.Errorf("transaction is already closed")
+	}
+
+	selected := make(map[string]map[string]Entity)
+	for _, entityType := range entityTypes {
+		if changes, ok := tx.changes[entityType]; ok {
+			selected[entityType] = changes
+		}
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+	if tx.dryRun {
+		tx.recordIntended(selected)
+		for entityType := range selected {
+			delete(tx.changes, entityType)
+		}
+		return nil
+	}
+
+	events, metrics, err := tx.applyChanges(selected)
+	if err != nil {
+		return err
+	}
+	for entityType := range selected {
+		delete(tx.changes, entityType)
+	}
+
+	tx.db.publish(events)
+	tx.db.notifyCommit(metrics)
+	return nil
+}
+
+// apply writes the transaction changes to the database under the write lock
+// and returns the resulting change events
+func (tx *Transaction) apply() ([]ChangeEvent, CommitMetrics, error) {
+	events, metrics, err := tx.applyChanges(tx.changes)
+	if err != nil {
+		return nil, metrics, err
+	}
+	tx.committed = true
+	return events, metrics, nil
+}
+
+// hasChanges reports whether changes holds at least one pending set or delete
+func hasChanges(changes map[string]map[string]Entity) bool {
+	for _, entities := range changes {
+		if len(entities) > 0 {
+			return true
+		}
+	}
+	return false
+}
 
-	tx.db.mu.Lock()
+// applyChanges writes changes to the database under the write lock and saves the file
+func (tx *Transaction) applyChanges(changes map[string]map[string]Entity) ([]ChangeEvent, CommitMetrics, error) {
+	start := time.Now()
+	tx.db.lockForWrite()
 	defer tx.db.mu.Unlock()
+	defer func() { tx.db.stats.committed(time.Since(start)) }()
+	return tx.applyLocked(changes, start)
+}
 
-	for entityType, entities := range tx.changes {
-		if tx.db.data[entityType] == nil {
-			tx.db.data[entityType] = make(map[string]Entity)
+// applyLocked is applyChanges for callers that already hold the write lock
+func (tx *Transaction) applyLocked(changes map[string]map[string]Entity, start time.Time) ([]ChangeEvent, CommitMetrics, error) {
+	// Stage the changes on copies of the affected type maps so a failed save
+	// can put the originals back, leaving memory as it was before the commit
+	original := make(map[string]map[string]Entity)
+	stage := func(entityType string) {
+		if _, ok := original[entityType]; ok {
+			return
+		}
+		original[entityType] = tx.db.data[entityType]
+		size := len(tx.db.data[entityType]) + len(changes[entityType])
+		if c := tx.db.collections[entityType]; c != nil && c.capacity > size {
+			size = c.capacity
+		}
+		staged := make(map[string]Entity, size)
+		for id, entity := range tx.db.data[entityType] {
+			staged[id] = entity
+		}
+		tx.db.data[entityType] = staged
+	}
+
+	var events []ChangeEvent
+	var historied []string
+	now := time.Now()
+	for entityType, entities := range changes {
+		stage(entityType)
+		history := tx.db.collections[entityType] != nil && tx.db.collections[entityType].history
+		if history {
+			stage(historyType(entityType))
+			historied = append(historied, entityType)
 		}
 		for id, entity := range entities {
+			if history {
+				tx.db.appendHistory(entityType, id, entity, now)
+			}
 			if entity == nil {
 				delete(tx.db.data[entityType], id)
-				tx.db.cache.Delete(getCacheKey(entityType, id))
+				events = append(events, ChangeEvent{EntityType: entityType, ID: id, Operation: OpDelete})
 			} else {
 				tx.db.data[entityType][id] = entity
-				tx.db.cache.Set(getCacheKey(entityType, id), entity, cache.DefaultExpiration)
+				events = append(events, ChangeEvent{EntityType: entityType, ID: id, Operation: OpSet, Entity: entity})
 			}
-			// Update indexes
-			for field, index := range tx.db.indexes[entityType] {
-				value := reflect.ValueOf(entity).Elem().FieldByName(field).String()
-				index[value] = append(index[value], id)
+			if tx.db.maxFileSize > 0 {
+				tx.db.markDirty(entityType, id, true)
 			}
 		}
 	}
 
-	tx.committed = true
-	return tx.db.save()
+	restore := func() {
+		for entityType, entities := range original {
+			if entities == nil {
+				delete(tx.db.data, entityType)
+			} else {
+				tx.db.data[entityType] = entities
+			}
+		}
+		for _, entityType := range historied {
+			tx.db.indexHistory(entityType)
+		}
+	}
+	written, full, err := tx.db.saveReport()
+	if err != nil {
+		restore()
+		return nil, CommitMetrics{}, err
+	}
+	if err := tx.db.replicate(events); err != nil {
+		// The replica rejected the commit, so write the previous state back
+		restore()
+		if _, _, saveErr := tx.db.saveReport(); saveErr != nil {
+			return nil, CommitMetrics{}, fmt.Errorf("%w; restoring the database file failed: %v", err, saveErr)
+		}
+		return nil, CommitMetrics{}, err
+	}
+
+	// The save succeeded, so bring the cache and indexes in line with the new data
+	for _, event := range events {
+		previous, existed := original[event.EntityType][event.ID]
+		if event.Operation == OpDelete {
+			tx.db.cache.Delete(getCacheKey(event.EntityType, event.ID))
+		} else {
+			tx.db.cache.Set(getCacheKey(event.EntityType, event.ID), event.Entity)
+			tx.db.bloomAdd(event.EntityType, event.ID)
+		}
+		tx.db.partitionUpdate(event.EntityType, event.ID, event.Entity)
+		tx.db.prefixUpdate(event.EntityType, event.ID, event.Entity)
+		for field, index := range tx.db.indexes[event.EntityType] {
+			if event.Operation == OpDelete {
+				// The stored entity may have been changed in place since it was
+				// indexed, so look for the id in every bucket rather than trusting its key
+				removeIDFromIndex(index, event.ID)
+				continue
+			}
+			if existed {
+				if key, ok := indexKey(previous, field); ok {
+					removeFromIndex(index, key, event.ID)
+				}
+			}
+			if event.Entity != nil {
+				if key, ok := indexKey(event.Entity, field); ok {
+					index[key] = append(index[key], event.ID)
+				}
+			}
+		}
+	}
+
+	metrics := CommitMetrics{BytesWritten: written, FullRewrite: full, Duration: time.Since(start)}
+	for _, event := range events {
+		if event.Operation == OpDelete {
+			metrics.Deletes++
+		} else {
+			metrics.Sets++
+		}
+	}
+	metrics.Entities = metrics.Sets + metrics.Deletes
+	return events, metrics, nil
 }
 
 // Rollback discards the transaction changes
 func (tx *Transaction) Rollback() {
 	// No need to unlock anything, as we're using deferred unlocks in the methods that acquire locks
 	tx.changes = make(map[string]map[string]Entity)
+	tx.close()
 }
 
-// Get retrieves an entity by type and ID
-func (tx *Transaction) Get(entityType string, id string) (Entity, bool) {
-	// Check the transaction's changes first
-	if changedEntities, ok := tx.changes[entityType]; ok {
-		if entity, ok := changedEntities[id]; ok {
-			return entity, true
-		}
+// close marks the transaction as finished so it is no longer counted as open
+func (tx *Transaction) close() {
+	if !tx.closed {
+		tx.closed = true
+		tx.db.stats.txClosed(tx.readOnly)
 	}
+}
 
-	// If not in transaction changes, check the database (which includes committed cache)
-	tx.db.mu.RLock()
-	defer tx.db.mu.RUnlock()
+// pendingUndo is the pending change an entry in the undo log replaced
+type pendingUndo struct {
+	entityType string
+	id         string
+	entity     Entity
+	existed    bool
+}
 
-	if cachedEntity, found := tx.db.cache.Get(getCacheKey(entityType, id)); found {
-		return cachedEntity.(Entity), true
+// setChange records a pending set, or a delete when entity is nil, noting
+// the change it replaces while a savepoint is open
+func (tx *Transaction) setChange(entityType, id string, entity Entity) {
+	if tx.changes[entityType] == nil {
+		tx.changes[entityType] = make(map[string]Entity)
+	}
+	if tx.savepoints > 0 {
+		previous, existed := tx.changes[entityType][id]
+		tx.undo = append(tx.undo, pendingUndo{entityType: entityType, id: id, entity: previous, existed: existed})
+	}
+	tx.changes[entityType][id] = entity
+}
+
+// savepoint starts recording pending changes and returns the mark that
+// rollbackTo or release takes to end it. Savepoints nest.
+func (tx *Transaction) savepoint() int {
+	tx.savepoints++
+	return len(tx.undo)
+}
+
+// rollbackTo discards every pending change made since the savepoint at mark,
+// including those made by hooks, and ends it
+func (tx *Transaction) rollbackTo(mark int) {
+	for i := len(tx.undo) - 1; i >= mark; i-- {
+		u := tx.undo[i]
+		if u.existed {
+			tx.changes[u.entityType][u.id] = u.entity
+		} else {
+			delete(tx.changes[u.entityType], u.id)
+		}
+	}
+	tx.undo = tx.undo[:mark]
+	tx.release(mark)
+}
+
+// release ends the savepoint at mark, keeping its changes
+func (tx *Transaction) release(mark int) {
+	tx.savepoints--
+	if tx.savepoints == 0 {
+		tx.undo = nil
+	}
+}
+
+// Get retrieves an entity by type and ID
+func (tx *Transaction) Get(entityType string, id string) (Entity, bool) {
+	entityType = tx.db.typeName(entityType)
+
+	// Check the transaction's changes first
+	if changedEntities, ok := tx.changes[entityType]; ok {
+		if entity, ok := changedEntities[id]; ok {
+			// A nil entry marks an entity deleted in this transaction
+			if entity == nil {
+				return nil, false
+			}
+			return tx.db.applyDefaults(entityType, entity), true
+		}
+	}
+
+	// If not in transaction changes, check the database (which includes committed cache)
+	if !tx.db.definitelyAbsent(entityType, id) {
+		if entity, ok := tx.db.getCommitted(entityType, id); ok {
+			return tx.db.applyDefaults(entityType, entity), true
+		}
+	}
+
+	// Fall back to the read-through loader, if one is registered
+	if loader := tx.db.collectionConfig(entityType).loader; loader != nil {
+		if entity, ok := tx.db.loadThrough(entityType, id, loader); ok {
+			return tx.db.applyDefaults(entityType, entity), true
+		}
+	}
+
+	return nil, false
+}
+
+// GetErr retrieves an entity by type and ID, returning ErrNotFound when it does not exist
+func (tx *Transaction) GetErr(entityType string, id string) (Entity, error) {
+	entity, ok := tx.Get(entityType, id)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrNotFound, entityType, id)
 	}
+	return entity, nil
+}
 
-	if entities, ok := tx.db.data[entityType]; ok {
+// lookup returns the stored entity for an ID from the transaction's changes or
+// the committed data. Unlike Get it neither calls the loader nor fills in
+// defaults, so write paths can check whether an entity really exists.
+func (tx *Transaction) lookup(entityType, id string) (Entity, bool) {
+	entityType = tx.db.typeName(entityType)
+
+	if changedEntities, ok := tx.changes[entityType]; ok {
+		if entity, ok := changedEntities[id]; ok {
+			return entity, entity != nil
+		}
+	}
+	if tx.db.definitelyAbsent(entityType, id) {
+		return nil, false
+	}
+	return tx.db.getCommitted(entityType, id)
+}
+
+// getCommitted retrieves a committed entity, consulting the cache first
+func (db *Database) getCommitted(entityType, id string) (Entity, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if cachedEntity, found := db.cache.Get(getCacheKey(entityType, id)); found {
+		if entity, ok := cachedEntity.(Entity); ok && !isNilEntity(entity) {
+			return entity, true
+		}
+		// Drop corrupted cache entries and fall back to the stored data
+		db.cache.Delete(getCacheKey(entityType, id))
+	}
+
+	if entities, ok := db.data[entityType]; ok {
 		if entity, ok := entities[id]; ok {
 			// Cache the entity for future use
-			tx.db.cache.Set(getCacheKey(entityType, id), entity, cache.DefaultExpiration)
+			db.cache.Set(getCacheKey(entityType, id), entity)
 			return entity, true
 		}
 	}
@@ -253,12 +1046,30 @@ func (tx *Transaction) Get(entityType string, id string) (Entity, bool) {
 
 // GetAll retrieves all entities of a given type
 func (tx *Transaction) GetAll(entityType string) []Entity {
+	entities := tx.lookupAll(entityType)
+	if defaults := tx.db.collectionConfig(entityType).defaults; len(defaults) > 0 {
+		for i, entity := range entities {
+			entities[i] = withDefaults(entity, defaults)
+		}
+	}
+	return entities
+}
+
+// lookupAll returns the stored entities of a type with the transaction's
+// changes applied. Unlike GetAll it does not fill in defaults, so paths that
+// write entities back store only what was stored.
+func (tx *Transaction) lookupAll(entityType string) []Entity {
+	entityType = tx.db.typeName(entityType)
+
 	var entities []Entity
+	tx.db.mu.RLock()
 	if entityMap, ok := tx.db.data[entityType]; ok {
+		entities = make([]Entity, 0, len(entityMap))
 		for _, entity := range entityMap {
 			entities = append(entities, entity)
 		}
 	}
+	tx.db.mu.RUnlock()
 	if changedEntities, ok := tx.changes[entityType]; ok {
 		for id, entity := range changedEntities {
 			if entity == nil {
@@ -288,29 +1099,88 @@ func (tx *Transaction) GetAll(entityType string) []Entity {
 	return entities
 }
 
+// Count returns the number of entities of a given type, including the transaction's pending changes
+func (tx *Transaction) Count(entityType string) int {
+	entityType = tx.db.typeName(entityType)
+
+	tx.db.mu.RLock()
+	defer tx.db.mu.RUnlock()
+
+	committed := tx.db.data[entityType]
+	count := len(committed)
+	for id, entity := range tx.changes[entityType] {
+		_, exists := committed[id]
+		if entity == nil && exists {
+			count--
+		} else if entity != nil && !exists {
+			count++
+		}
+	}
+	return count
+}
+
 // Set adds or updates an entity
 func (tx *Transaction) Set(entityType string, entity Entity) error {
+	entityType = tx.db.typeName(entityType)
+
 	if tx.readOnly {
 		return fmt.Errorf("cannot modify data in a read-only transaction")
 	}
-
-	// Run pre-set hooks
-	for _, hook := range tx.db.hooks["pre-set"] {
-		if err := hook(tx, entityType, entity); err != nil {
+	if isNilEntity(entity) {
+		return ErrNilEntity
+	}
+	cfg := tx.db.collectionConfig(entityType)
+	if entity.GetID() == "" && cfg.idGenerator != nil {
+		err := safeCall("ID generator", func() error {
+			entity.SetID(cfg.idGenerator())
+			return nil
+		})
+		if err != nil {
 			return err
 		}
 	}
+	if entity.GetID() == "" {
+		return ErrEmptyID
+	}
 
-	if tx.changes[entityType] == nil {
-		tx.changes[entityType] = make(map[string]Entity)
+	// Hooks see the stored entity as Old, not a loaded or defaulted copy
+	old, exists := tx.lookup(entityType, entity.GetID())
+	if exists && cfg.appendOnly {
+		return fmt.Errorf("%w: cannot overwrite %s %s", ErrAppendOnly, entityType, entity.GetID())
+	}
+
+	// Run pre-set hooks
+	if err := tx.runHooks("pre-set", entityType, old, entity); err != nil {
+		return err
+	}
+
+	if err := safeCall("field transform", func() error {
+		cfg.applyTransforms(entity)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if cfg.timestamps {
+		setTimestamps(entity, old, time.Now())
+	}
+	if err := safeCall("validator", func() error { return cfg.validate(entity) }); err != nil {
+		return err
+	}
+	if err := tx.checkUnique(entityType, entity, cfg.unique); err != nil {
+		return err
+	}
+	if err := tx.checkGlobalID(entityType, entity.GetID()); err != nil {
+		return err
+	}
+	if err := tx.checkRelations(entity, cfg.relations); err != nil {
+		return err
 	}
-	tx.changes[entityType][entity.GetID()] = entity
+
+	tx.setChange(entityType, entity.GetID(), entity)
 
 	// Run post-set hooks
-	for _, hook := range tx.db.hooks["post-set"] {
-		if err := hook(tx, entityType, entity); err != nil {
-			return err
-		}
+	if err := tx.runHooks("post-set", entityType, old, entity); err != nil {
+		return err
 	}
 
 	return nil
@@ -318,37 +1188,84 @@ func (tx *Transaction) Set(entityType string, entity Entity) error {
 
 // Delete removes an entity
 func (tx *Transaction) Delete(entityType string, id string) error {
+	entityType = tx.db.typeName(entityType)
+
 	if tx.readOnly {
 		return fmt.Errorf("cannot modify data in a read-only transaction")
 	}
+	if tx.db.collectionConfig(entityType).appendOnly {
+		return fmt.Errorf("%w: cannot delete %s %s", ErrAppendOnly, entityType, id)
+	}
 
 	// Run pre-delete hooks
-	entity, exists := tx.Get(entityType, id)
+	entity, exists := tx.lookup(entityType, id)
 	if exists {
-		for _, hook := range tx.db.hooks["pre-delete"] {
-			if err := hook(tx, entityType, entity); err != nil {
-				return err
-			}
+		if err := tx.runHooks("pre-delete", entityType, entity, nil); err != nil {
+			return err
 		}
 	}
 
-	if tx.changes[entityType] == nil {
-		tx.changes[entityType] = make(map[string]Entity)
-	}
-	tx.changes[entityType][id] = nil
+	tx.setChange(entityType, id, nil)
 
 	// Run post-delete hooks
 	if exists {
-		for _, hook := range tx.db.hooks["post-delete"] {
-			if err := hook(tx, entityType, entity); err != nil {
-				return err
-			}
+		if err := tx.runHooks("post-delete", entityType, entity, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runHooks runs the hooks registered for an operation, stopping at the first
+// error. Hooks registered with RegisterHook receive the new entity, or the
+// old one for deletes.
+func (tx *Transaction) runHooks(operation, entityType string, old, new Entity) error {
+	entity := new
+	if entity == nil {
+		entity = old
+	}
+	for _, hook := range tx.db.hooks[operation] {
+		if err := safeCall(operation+" hook", func() error { return hook(tx, entityType, entity) }); err != nil {
+			return err
 		}
 	}
 
+	event := HookEvent{EntityType: entityType, Operation: operation, Old: old, New: new}
+	for _, hook := range tx.db.hooksV2[operation] {
+		if err := safeCall(operation+" hook", func() error { return hook(tx, event) }); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// Upsert inserts an entity when it does not exist yet, otherwise it stores
+// the result of merging the incoming entity into the existing one
+func (tx *Transaction) Upsert(entityType string, entity Entity, merge func(existing, incoming Entity) Entity) error {
+	if isNilEntity(entity) {
+		return ErrNilEntity
+	}
+
+	existing, exists := tx.lookup(entityType, entity.GetID())
+	if !exists {
+		return tx.Set(entityType, entity)
+	}
+
+	var merged Entity
+	if err := safeCall("upsert merge", func() error {
+		merged = merge(existing, entity)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if isNilEntity(merged) {
+		return ErrNilEntity
+	}
+	merged.SetID(entity.GetID())
+	return tx.Set(entityType, merged)
+}
+
 // BatchSet adds or updates multiple entities in a single operation
 func (tx *Transaction) BatchSet(entityType string, entities []Entity) error {
 	for _, entity := range entities {
@@ -359,6 +1276,56 @@ func (tx *Transaction) BatchSet(entityType string, entities []Entity) error {
 	return nil
 }
 
+// ReplaceCollection replaces every entity of a type with the given set when
+// the transaction commits: entities not in the set are deleted and the rest
+// are written with Set. If any write fails, the transaction's pending changes
+// to the type are left as they were before the call.
+func (tx *Transaction) ReplaceCollection(entityType string, entities []Entity) error {
+	if tx.readOnly {
+		return fmt.Errorf("cannot modify data in a read-only transaction")
+	}
+	entityType = tx.db.typeName(entityType)
+
+	keep := make(map[string]bool, len(entities))
+	for _, entity := range entities {
+		if isNilEntity(entity) {
+			return ErrNilEntity
+		}
+		keep[entity.GetID()] = true
+	}
+
+	var pending map[string]Entity
+	if changes, ok := tx.changes[entityType]; ok {
+		pending = make(map[string]Entity, len(changes))
+		for id, entity := range changes {
+			pending[id] = entity
+		}
+	}
+	restore := func(err error) error {
+		if pending == nil {
+			delete(tx.changes, entityType)
+		} else {
+			tx.changes[entityType] = pending
+		}
+		return err
+	}
+
+	// Delete first so new entities can reuse unique values held by removed ones
+	for _, existing := range tx.GetAll(entityType) {
+		if !keep[existing.GetID()] {
+			if err := tx.Delete(entityType, existing.GetID()); err != nil {
+				return restore(err)
+			}
+		}
+	}
+	for _, entity := range entities {
+		if err := tx.Set(entityType, entity); err != nil {
+			return restore(err)
+		}
+	}
+	return nil
+}
+
 // BatchDelete removes multiple entities in a single operation
 func (tx *Transaction) BatchDelete(entityType string, ids []string) error {
 	for _, id := range ids {
@@ -369,31 +1336,194 @@ func (tx *Transaction) BatchDelete(entityType string, ids []string) error {
 	return nil
 }
 
+// DeleteReturning removes all entities matching pred and returns copies of
+// the removed entities as they were stored. pred sees them with field
+// defaults filled in, as Get returns them.
+func (tx *Transaction) DeleteReturning(entityType string, pred func(Entity) bool) ([]Entity, error) {
+	var deleted []Entity
+	for _, entity := range tx.lookupAll(entityType) {
+		var matched bool
+		if err := safeCall("delete predicate", func() error {
+			matched = pred(tx.db.applyDefaults(entityType, entity))
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+		removed := copyEntity(entity)
+		if err := tx.Delete(entityType, entity.GetID()); err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, removed)
+	}
+	return deleted, nil
+}
+
+// DeleteWhere removes all entities whose field equals value and returns how
+// many were deleted. When the field is indexed, candidates are looked up in
+// the index instead of scanning every entity of the type.
+func (tx *Transaction) DeleteWhere(entityType, field string, value interface{}) (int, error) {
+	var candidates []Entity
+	if ids, ok := tx.indexCandidates(entityType, field, value); ok {
+		for _, id := range ids {
+			if entity, ok := tx.Get(entityType, id); ok {
+				candidates = append(candidates, entity)
+			}
+		}
+	} else {
+		candidates = tx.GetAll(entityType)
+	}
+
+	deleted := 0
+	for _, entity := range candidates {
+		if v, ok := getField(entity, field); !ok || !valuesEqual(v, value) {
+			continue
+		}
+		if err := tx.Delete(entityType, entity.GetID()); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// UpdateWhere applies mutate to a copy of every entity matching pred and
+// stores the result with Set, so hooks fire once per updated entity. It
+// returns how many entities were updated. Entities are visited in ID order.
+// pred sees entities with field defaults filled in, as Get returns them,
+// while mutate gets a copy of the stored entity so defaults are not stored.
+func (tx *Transaction) UpdateWhere(entityType string, pred func(Entity) bool, mutate func(Entity)) (int, error) {
+	entities := tx.lookupAll(entityType)
+	sort.Slice(entities, func(i, j int) bool {
+		return entities[i].GetID() < entities[j].GetID()
+	})
+
+	updated := 0
+	for _, entity := range entities {
+		var matched bool
+		if err := safeCall("update predicate", func() error {
+			matched = pred(tx.db.applyDefaults(entityType, entity))
+			return nil
+		}); err != nil {
+			return updated, err
+		}
+		if !matched {
+			continue
+		}
+		changed := copyEntity(entity)
+		if err := safeCall("update mutator", func() error {
+			mutate(changed)
+			return nil
+		}); err != nil {
+			return updated, err
+		}
+		if err := tx.Set(entityType, changed); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// indexCandidates returns the ids that may have field equal to value: those
+// in the committed index bucket plus any changed in this transaction. It
+// reports false when the field is not indexed or the value has no stable index key.
+func (tx *Transaction) indexCandidates(entityType, field string, value interface{}) ([]string, bool) {
+	entityType = tx.db.typeName(entityType)
+
+	if !indexableValue(value) {
+		return nil, false
+	}
+
+	tx.db.mu.RLock()
+	index, ok := tx.db.indexes[entityType][field]
+	var ids []string
+	if ok {
+		ids = append(ids, index[fmt.Sprint(value)]...)
+	}
+	tx.db.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	for id := range tx.changes[entityType] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	unique := ids[:0]
+	for i, id := range ids {
+		if i == 0 || id != ids[i-1] {
+			unique = append(unique, id)
+		}
+	}
+	return unique, true
+}
+
+// indexableValue reports whether a value has a stable index key, so entities
+// equal to it are found in the bucket keyed by fmt.Sprint(value)
+func indexableValue(value interface{}) bool {
+	switch value.(type) {
+	case string, bool:
+		return true
+	}
+	_, ok := toFloat64(value)
+	return ok
+}
+
 // Query represents a database query
 type Query struct {
 	tx         *Transaction
 	entityType string
 	filters    []func(Entity) bool
-	limit      int
-	offset     int
-	orderBy    string
-	orderDesc  bool
+	// descriptions holds a readable form of each filter for String
+	descriptions []string
+	limit        int
+	offset       int
+	orderBy      string
+	orderDesc    bool
+	err          error
+	// equalities records Where filters so EstimateCost can look for a usable index
+	equalities []fieldValue
+	// timeRanges records WhereTimeRange filters so Execute can prune partitions
+	timeRanges []timeRange
+	// startsWith records WherePrefix filters so Execute can use a prefix index
+	startsWith []fieldValue
+	hydrators  []func(Entity) error
+}
+
+// fieldValue is a field and the value it must equal
+type fieldValue struct {
+	field string
+	value interface{}
 }
 
 // Where adds a filter to the query
 func (q *Query) Where(field string, value interface{}) *Query {
-	q.filters = append(q.filters, func(e Entity) bool {
-		return reflect.ValueOf(e).Elem().FieldByName(field).Interface() == value
+	q.equalities = append(q.equalities, fieldValue{field, value})
+	q.addFilter(fmt.Sprintf("%s = %s", field, describeValue(value)), func(e Entity) bool {
+		fieldValue, ok := getField(e, field)
+		return ok && equalValues(fieldValue, value)
 	})
 	return q
 }
 
+// WhereFunc adds a filter that matches entities for which fn returns true
+func (q *Query) WhereFunc(fn func(Entity) bool) *Query {
+	q.addFilter("<func>", fn)
+	return q
+}
+
 // WhereIn adds a filter that checks if a field's value is in a given slice
 func (q *Query) WhereIn(field string, values []interface{}) *Query {
-	q.filters = append(q.filters, func(e Entity) bool {
-		fieldValue := reflect.ValueOf(e).Elem().FieldByName(field).Interface()
+	q.addFilter(fmt.Sprintf("%s IN %s", field, describeValues(values)), func(e Entity) bool {
+		fieldValue, ok := getField(e, field)
+		if !ok {
+			return false
+		}
 		for _, v := range values {
-			if fieldValue == v {
+			if equalValues(fieldValue, v) {
 				return true
 			}
 		}
@@ -402,15 +1532,129 @@ func (q *Query) WhereIn(field string, values []interface{}) *Query {
 	return q
 }
 
+// WhereTupleIn adds a filter that checks if the combination of several
+// fields equals one of the given tuples. Tuples whose length differs from
+// the number of fields never match.
+func (q *Query) WhereTupleIn(fields []string, tuples [][]interface{}) *Query {
+	described := make([]string, len(tuples))
+	for i, tuple := range tuples {
+		described[i] = describeValues(tuple)
+	}
+	description := fmt.Sprintf("[%s] IN [%s]", strings.Join(fields, ", "), strings.Join(described, ", "))
+	q.addFilter(description, func(e Entity) bool {
+		values := make([]interface{}, len(fields))
+		for i, field := range fields {
+			v, ok := getField(e, field)
+			if !ok {
+				return false
+			}
+			values[i] = v
+		}
+		for _, tuple := range tuples {
+			if len(tuple) != len(values) {
+				continue
+			}
+			matched := true
+			for i, v := range tuple {
+				if !equalValues(values[i], v) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				return true
+			}
+		}
+		return false
+	})
+	return q
+}
+
+// WhereNested adds a filter that matches entities whose arrayField is a
+// slice with at least one element whose subField equals value. Elements may
+// be maps with string keys or structs; fields that are not slices never match.
+func (q *Query) WhereNested(arrayField, subField string, value interface{}) *Query {
+	q.addFilter(fmt.Sprintf("%s[].%s = %s", arrayField, subField, describeValue(value)), func(e Entity) bool {
+		fieldValue, ok := getField(e, arrayField)
+		if !ok || fieldValue == nil {
+			return false
+		}
+		elements := reflect.ValueOf(fieldValue)
+		if elements.Kind() != reflect.Slice && elements.Kind() != reflect.Array {
+			return false
+		}
+		for i := 0; i < elements.Len(); i++ {
+			if v, ok := elementField(elements.Index(i), subField); ok && valuesEqual(v, value) {
+				return true
+			}
+		}
+		return false
+	})
+	return q
+}
+
+// elementField returns the named field of a map or struct element
+func elementField(element reflect.Value, name string) (interface{}, bool) {
+	for element.Kind() == reflect.Interface || element.Kind() == reflect.Ptr {
+		if element.IsNil() {
+			return nil, false
+		}
+		element = element.Elem()
+	}
+	switch element.Kind() {
+	case reflect.Map:
+		if element.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		v := element.MapIndex(reflect.ValueOf(name).Convert(element.Type().Key()))
+		if !v.IsValid() {
+			return nil, false
+		}
+		return v.Interface(), true
+	case reflect.Struct:
+		f := element.FieldByName(name)
+		if !f.IsValid() || !f.CanInterface() {
+			return nil, false
+		}
+		return f.Interface(), true
+	}
+	return nil, false
+}
+
 // WhereLike adds a filter that checks if a field's value contains a given string
 func (q *Query) WhereLike(field string, value string) *Query {
-	q.filters = append(q.filters, func(e Entity) bool {
+	q.addFilter(fmt.Sprintf("%s LIKE %q", field, value), func(e Entity) bool {
 		fieldValue := reflect.ValueOf(e).Elem().FieldByName(field).String()
 		return strings.Contains(fieldValue, value)
 	})
 	return q
 }
 
+// WhereFieldExists adds a filter that matches entities that have the field,
+// even when its value is nil. For GenericEntity this is key presence.
+func (q *Query) WhereFieldExists(field string) *Query {
+	q.addFilter(field+" EXISTS", func(e Entity) bool {
+		_, ok := getField(e, field)
+		return ok
+	})
+	return q
+}
+
+// WhereNull adds a filter that matches entities whose field is missing or nil
+func (q *Query) WhereNull(field string) *Query {
+	q.addFilter(field+" IS NULL", func(e Entity) bool {
+		v, ok := getField(e, field)
+		return !ok || v == nil
+	})
+	return q
+}
+
+// addFilter appends a filter along with its description
+func (q *Query) addFilter(description string, fn func(Entity) bool) {
+	q.filters = append(q.filters, fn)
+	q.descriptions = append(q.descriptions, description)
+}
+
 // Limit sets the maximum number of results to return
 func (q *Query) Limit(limit int) *Query {
 	q.limit = limit
@@ -423,6 +1667,81 @@ func (q *Query) Offset(offset int) *Query {
 	return q
 }
 
+// WhereFieldGt adds a filter that matches when fieldA is greater than fieldB of the same entity
+func (q *Query) WhereFieldGt(fieldA, fieldB string) *Query {
+	return q.whereFields(fieldA, ">", fieldB, func(c int) bool { return c > 0 })
+}
+
+// WhereFieldLt adds a filter that matches when fieldA is less than fieldB of the same entity
+func (q *Query) WhereFieldLt(fieldA, fieldB string) *Query {
+	return q.whereFields(fieldA, "<", fieldB, func(c int) bool { return c < 0 })
+}
+
+// WhereFieldEq adds a filter that matches when fieldA equals fieldB of the same entity
+func (q *Query) WhereFieldEq(fieldA, fieldB string) *Query {
+	return q.whereFields(fieldA, "=", fieldB, func(c int) bool { return c == 0 })
+}
+
+func (q *Query) whereFields(fieldA, op, fieldB string, match func(int) bool) *Query {
+	q.addFilter(fmt.Sprintf("%s %s %s", fieldA, op, fieldB), func(e Entity) bool {
+		a, okA := getField(e, fieldA)
+		b, okB := getField(e, fieldB)
+		if !okA || !okB {
+			return false
+		}
+		c, ok := compareValues(a, b)
+		return ok && match(c)
+	})
+	return q
+}
+
+// WhereGreaterThan adds a filter that matches when field is greater than value.
+// Numbers compare across kinds, so an int argument matches the float64 a
+// reloaded GenericEntity holds, and time.Time compares with RFC 3339 strings.
+// Values that cannot be compared do not match.
+func (q *Query) WhereGreaterThan(field string, value interface{}) *Query {
+	return q.whereCompare(field, ">", value, func(c int) bool { return c > 0 })
+}
+
+// WhereGreaterOrEqual adds a filter that matches when field is at least value
+func (q *Query) WhereGreaterOrEqual(field string, value interface{}) *Query {
+	return q.whereCompare(field, ">=", value, func(c int) bool { return c >= 0 })
+}
+
+// WhereLessThan adds a filter that matches when field is less than value
+func (q *Query) WhereLessThan(field string, value interface{}) *Query {
+	return q.whereCompare(field, "<", value, func(c int) bool { return c < 0 })
+}
+
+// WhereLessOrEqual adds a filter that matches when field is at most value
+func (q *Query) WhereLessOrEqual(field string, value interface{}) *Query {
+	return q.whereCompare(field, "<=", value, func(c int) bool { return c <= 0 })
+}
+
+func (q *Query) whereCompare(field, op string, value interface{}, match func(int) bool) *Query {
+	q.addFilter(fmt.Sprintf("%s %s %s", field, op, describeValue(value)), func(e Entity) bool {
+		fieldValue, ok := getField(e, field)
+		if !ok {
+			return false
+		}
+		c, ok := compareValues(fieldValue, value)
+		return ok && match(c)
+	})
+	return q
+}
+
+// Clone returns a copy of the query that can be extended without affecting the original
+func (q *Query) Clone() *Query {
+	clone := *q
+	clone.filters = append([]func(Entity) bool(nil), q.filters...)
+	clone.descriptions = append([]string(nil), q.descriptions...)
+	clone.equalities = append([]fieldValue(nil), q.equalities...)
+	clone.timeRanges = append([]timeRange(nil), q.timeRanges...)
+	clone.startsWith = append([]fieldValue(nil), q.startsWith...)
+	clone.hydrators = append([]func(Entity) error(nil), q.hydrators...)
+	return &clone
+}
+
 // OrderBy sets the field to order results by
 func (q *Query) OrderBy(field string, desc bool) *Query {
 	q.orderBy = field
@@ -432,31 +1751,42 @@ func (q *Query) OrderBy(field string, desc bool) *Query {
 
 // Execute runs the query and returns the results
 func (q *Query) Execute() ([]Entity, error) {
-	entities := q.tx.GetAll(q.entityType)
+	if q.err != nil {
+		return nil, q.err
+	}
+	entities := q.candidates()
 	var results []Entity
 
-	for _, entity := range entities {
-		match := true
-		for _, filter := range q.filters {
-			if !filter(entity) {
-				match = false
-				break
+	err := safeCall("query filter", func() error {
+		for _, entity := range entities {
+			match := true
+			for _, filter := range q.filters {
+				if !filter(entity) {
+					match = false
+					break
+				}
+			}
+			if match {
+				results = append(results, entity)
 			}
 		}
-		if match {
-			results = append(results, entity)
-		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if q.orderBy != "" {
+	// Results are always totally ordered, with ties broken by ID, so equal
+	// keys and unordered queries come out the same way on every call
+	err = safeCall("query ordering", func() error {
 		sort.Slice(results, func(i, j int) bool {
-			vi := reflect.ValueOf(results[i]).Elem().FieldByName(q.orderBy)
-			vj := reflect.ValueOf(results[j]).Elem().FieldByName(q.orderBy)
-			if q.orderDesc {
-				return vi.Interface().(Comparable).Compare(vj.Interface().(Comparable)) > 0
-			}
-			return vi.Interface().(Comparable).Compare(vj.Interface().(Comparable)) < 0
+			vi, vj := q.sortKey(results[i]), q.sortKey(results[j])
+			return q.compareKeys(vi, results[i].GetID(), vj, results[j].GetID()) < 0
 		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	if q.offset > 0 {
@@ -470,14 +1800,158 @@ func (q *Query) Execute() ([]Entity, error) {
 		results = results[:q.limit]
 	}
 
+	if err := q.hydrate(results); err != nil {
+		return nil, err
+	}
 	return results, nil
 }
 
+// candidates returns the entities the filters are evaluated against: those
+// the narrowest index, time partition or prefix index limits the query to,
+// or all of them
+func (q *Query) candidates() []Entity {
+	entities, ok := q.committedCandidates(func() ([]string, bool) {
+		n, ok := q.narrow()
+		return n.ids, ok
+	})
+	if ok {
+		return entities
+	}
+	return q.tx.GetAll(q.entityType)
+}
+
+// narrowing is the set of committed IDs a query is limited to, before the
+// transaction's changes are added
+type narrowing struct {
+	ids   []string
+	field string
+	// equality is set when the IDs come from an equality index
+	equality bool
+}
+
+// narrow returns the smallest narrowing available to the query: the bucket
+// of an indexed Where field, the partitions overlapping a WhereTimeRange or
+// the range of a prefix index. Among equality indexes with buckets of the
+// same size, the one with more distinct values is chosen. It returns false
+// when nothing narrows the query. The caller must hold the read lock.
+func (q *Query) narrow() (narrowing, bool) {
+	var best narrowing
+	found := false
+	distinct := 0
+	for _, eq := range q.equalities {
+		index, ok := q.tx.db.indexes[q.entityType][eq.field]
+		if !ok || !indexableValue(eq.value) {
+			continue
+		}
+		ids := index[fmt.Sprint(eq.value)]
+		selectivity := len(index)
+		if !found || len(ids) < len(best.ids) || len(ids) == len(best.ids) && selectivity > distinct {
+			best = narrowing{ids: ids, field: eq.field, equality: true}
+			found = true
+			distinct = selectivity
+		}
+	}
+	if ids, ok := q.partitionIDs(); ok && (!found || len(ids) < len(best.ids)) {
+		best = narrowing{ids: ids, field: q.tx.db.partitions[q.entityType].field}
+		found = true
+	}
+	if ids, field, ok := q.prefixIDs(); ok && (!found || len(ids) < len(best.ids)) {
+		best = narrowing{ids: ids, field: field}
+		found = true
+	}
+	return best, found
+}
+
+// committedCandidates returns the committed entities with the IDs collect
+// returns, which runs under the read lock, combined with every pending change
+// of the transaction, since a change may bring an entity into the result.
+// Pending changes are left to the filters. It returns false when collect does.
+func (q *Query) committedCandidates(collect func() ([]string, bool)) ([]Entity, bool) {
+	db := q.tx.db
+	changed := q.tx.changes[q.entityType]
+
+	db.mu.RLock()
+	ids, ok := collect()
+	if !ok {
+		db.mu.RUnlock()
+		return nil, false
+	}
+	entities := make([]Entity, 0, len(ids)+len(changed))
+	for _, id := range ids {
+		if _, ok := changed[id]; ok {
+			continue
+		}
+		entities = append(entities, db.data[q.entityType][id])
+	}
+	db.mu.RUnlock()
+
+	for _, entity := range changed {
+		if entity != nil {
+			entities = append(entities, entity)
+		}
+	}
+	if defaults := db.collectionConfig(q.entityType).defaults; len(defaults) > 0 {
+		for i, entity := range entities {
+			entities[i] = withDefaults(entity, defaults)
+		}
+	}
+	return entities, true
+}
+
+// sortKey returns the value an entity is ordered by, or nil without OrderBy
+func (q *Query) sortKey(e Entity) interface{} {
+	if q.orderBy == "" {
+		return nil
+	}
+	v, _ := getField(e, q.orderBy)
+	return v
+}
+
+// compareKeys orders two results by sort key, honouring the direction, and then by ID
+func (q *Query) compareKeys(keyA interface{}, idA string, keyB interface{}, idB string) int {
+	if q.orderBy != "" {
+		c := orderValues(keyA, keyB)
+		if q.orderDesc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(idA, idB)
+}
+
+// Hydrate registers a function run over each result before Execute returns
+// it, e.g. to attach related data or compute derived fields. Results are
+// copies, so hydration never changes stored entities. The first error stops
+// hydration and is returned by Execute.
+func (q *Query) Hydrate(fn func(Entity) error) *Query {
+	q.hydrators = append(q.hydrators, fn)
+	return q
+}
+
+// hydrate replaces results with hydrated copies
+func (q *Query) hydrate(results []Entity) error {
+	if len(q.hydrators) == 0 {
+		return nil
+	}
+	for i, entity := range results {
+		hydrated := copyEntity(entity)
+		for _, fn := range q.hydrators {
+			if err := safeCall("query hydrator", func() error { return fn(hydrated) }); err != nil {
+				return fmt.Errorf("hydrating %s/%s: %w", q.entityType, entity.GetID(), err)
+			}
+		}
+		results[i] = hydrated
+	}
+	return nil
+}
+
 // NewQuery creates a new query for the given entity type
 func (tx *Transaction) NewQuery(entityType string) *Query {
 	return &Query{
 		tx:         tx,
-		entityType: entityType,
+		entityType: tx.db.typeName(entityType),
 	}
 }
 
@@ -492,20 +1966,345 @@ func getCacheKey(entityType, id string) string {
 	return fmt.Sprintf("%s:%s", entityType, id)
 }
 
-func getCurrentVersion(tx *Transaction) (int, error) {
-	entity, ok := tx.Get("migration", "current_version")
+// indexKey returns the key an entity is stored under in the index of a field
+func indexKey(entity Entity, field string) (string, bool) {
+	value, ok := getField(entity, field)
 	if !ok {
-		return 0, nil
+		return "", false
+	}
+	return fmt.Sprint(value), true
+}
+
+// removeIDFromIndex removes an id from every bucket of an index that holds it
+func removeIDFromIndex(index map[string][]string, id string) {
+	for key, ids := range index {
+		for _, existing := range ids {
+			if existing == id {
+				removeFromIndex(index, key, id)
+				break
+			}
+		}
+	}
+}
+
+// removeFromIndex removes an id from an index bucket, dropping the bucket once it is empty
+func removeFromIndex(index map[string][]string, key, id string) {
+	ids := index[key]
+	for i, existing := range ids {
+		if existing == id {
+			ids = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(index, key)
+	} else {
+		index[key] = ids
+	}
+}
+
+// legacyGenericFields detects entities saved in the old nested GenericEntity
+// shape ({"ID": ..., "Fields": {...}}) and returns their flattened fields
+func legacyGenericFields(entity map[string]interface{}) (map[string]interface{}, bool) {
+	if len(entity) != 2 {
+		return nil, false
+	}
+	id, hasID := entity["ID"].(string)
+	fields, hasFields := entity["Fields"].(map[string]interface{})
+	if !hasID || !hasFields {
+		return nil, false
+	}
+	if _, ok := fields["ID"]; !ok {
+		fields["ID"] = id
+	}
+	return fields, true
+}
+
+// safeCall runs a user callback, converting a panic into an error wrapping ErrCallbackPanic
+func safeCall(name string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %s: %v", ErrCallbackPanic, name, r)
+		}
+	}()
+	return fn()
+}
+
+// isNilEntity reports whether entity is nil or a typed nil pointer
+func isNilEntity(entity Entity) bool {
+	if entity == nil {
+		return true
+	}
+	v := reflect.ValueOf(entity)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// getField returns the named field of an entity and whether it is present.
+// GenericEntity fields are looked up in Fields, typed entities via reflection.
+func getField(entity Entity, field string) (interface{}, bool) {
+	if isNilEntity(entity) {
+		return nil, false
+	}
+	if ge, ok := entity.(*GenericEntity); ok {
+		value, ok := ge.Fields[field]
+		return value, ok
 	}
-	version, ok := entity.(*MigrationVersion)
+	v := reflect.Indirect(reflect.ValueOf(entity))
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+	fv := v.FieldByName(field)
+	if !fv.IsValid() || !fv.CanInterface() {
+		return nil, false
+	}
+	return fv.Interface(), true
+}
+
+// toFloat64 converts numeric values of any kind to float64
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case Decimal:
+		return n.Float64(), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// valuesEqual compares two field values, treating numbers of different kinds as equal when their values match
+func valuesEqual(a, b interface{}) bool {
+	if isDecimal(a, b) {
+		da, okA := toDecimal(a)
+		db, okB := toDecimal(b)
+		if okA && okB {
+			return da == db
+		}
+	}
+	if ia, ok := toInt64(a); ok {
+		if ib, ok := toInt64(b); ok {
+			return ia == ib
+		}
+	}
+	if fa, ok := toFloat64(a); ok {
+		if fb, ok := toFloat64(b); ok {
+			return fa == fb
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// equalValues compares with == when both values are comparable and falls
+// back to reflect.DeepEqual for maps, slices and other uncomparable kinds.
+// json.Number values compare by numeric value.
+func equalValues(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if isJSONNumber(a, b) {
+		return valuesEqual(a, b)
+	}
+	if reflect.ValueOf(a).Comparable() && reflect.ValueOf(b).Comparable() {
+		return a == b
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// copyEntity returns a shallow copy of an entity so callers can modify it without affecting the original
+func copyEntity(entity Entity) Entity {
+	if isNilEntity(entity) {
+		return entity
+	}
+	if ge, ok := entity.(*GenericEntity); ok {
+		fields := make(map[string]interface{}, len(ge.Fields))
+		for k, v := range ge.Fields {
+			fields[k] = v
+		}
+		return &GenericEntity{ID: ge.ID, Fields: fields}
+	}
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr {
+		return entity
+	}
+	cp := reflect.New(v.Elem().Type())
+	cp.Elem().Set(v.Elem())
+	return cp.Interface().(Entity)
+}
+
+// compareValues orders two field values, returning -1, 0 or 1. Numbers of any
+// kind compare by value, and times saved as RFC 3339 strings compare with
+// time.Time values. It reports false when the values cannot be compared.
+func compareValues(a, b interface{}) (int, bool) {
+	if isDecimal(a, b) {
+		da, okA := toDecimal(a)
+		db, okB := toDecimal(b)
+		if okA && okB {
+			return da.Compare(db), true
+		}
+	}
+	if ia, ok := toInt64(a); ok {
+		if ib, ok := toInt64(b); ok {
+			return cmp.Compare(ia, ib), true
+		}
+	}
+	if fa, ok := toFloat64(a); ok {
+		fb, ok := toFloat64(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	switch av := a.(type) {
+	case time.Time:
+		if bt, ok := toTime(b); ok {
+			return av.Compare(bt), true
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv), true
+		}
+		if bv, ok := b.(time.Time); ok {
+			if at, ok := toTime(av); ok {
+				return at.Compare(bv), true
+			}
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			switch {
+			case av == bv:
+				return 0, true
+			case !av:
+				return -1, true
+			}
+			return 1, true
+		}
+	case Comparable:
+		if bv, ok := b.(Comparable); ok {
+			return av.Compare(bv), true
+		}
+	}
+	return 0, false
+}
+
+// orderRank groups values by kind for ordering: nil < bool < number < string < time < everything else
+func orderRank(v interface{}) int {
+	if v == nil {
+		return 0
+	}
+	if _, ok := toFloat64(v); ok {
+		return 2
+	}
+	switch v.(type) {
+	case bool:
+		return 1
+	case string:
+		return 3
+	case time.Time:
+		return 4
+	}
+	return 5
+}
+
+// orderValues is a total order over field values of any kind. Values of the
+// same kind compare naturally; everything else falls back to its string form.
+func orderValues(a, b interface{}) int {
+	ra, rb := orderRank(a), orderRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	if ra == 0 {
+		return 0
+	}
+	if c, ok := compareValues(a, b); ok {
+		return c
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// toTime converts time.Time values and RFC 3339 strings to time.Time
+func toTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, t)
+		return parsed, err == nil
+	}
+	return time.Time{}, false
+}
+
+// entityFields returns all fields of an entity keyed by name
+func entityFields(entity Entity) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if isNilEntity(entity) {
+		return fields
+	}
+	if ge, ok := entity.(*GenericEntity); ok {
+		for k, v := range ge.Fields {
+			fields[k] = v
+		}
+		return fields
+	}
+	v := reflect.Indirect(reflect.ValueOf(entity))
+	if v.Kind() != reflect.Struct {
+		return fields
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			fields[t.Field(i).Name] = v.Field(i).Interface()
+		}
+	}
+	return fields
+}
+
+func getCurrentVersion(tx *Transaction, versionType string) (int, error) {
+	entity, ok := tx.Get(versionType, "current_version")
 	if !ok {
-		return 0, fmt.Errorf("invalid entity type for migration version")
+		return 0, nil
+	}
+	switch version := entity.(type) {
+	case *MigrationVersion:
+		return version.Version, nil
+	case *GenericEntity:
+		// Version records reload from disk as generic entities
+		if v, ok := toFloat64(version.Fields["version"]); ok {
+			return int(v), nil
+		}
 	}
-	return version.Version, nil
+	return 0, fmt.Errorf("invalid entity type for migration version")
 }
 
-func setCurrentVersion(tx *Transaction, version int) error {
-	return tx.Set("migration", &MigrationVersion{ID: "current_version", Version: version})
+func setCurrentVersion(tx *Transaction, versionType string, version int) error {
+	return tx.Set(versionType, &MigrationVersion{ID: "current_version", Version: version})
+}
+
+// migrationVersionType returns the type holding the version record for an
+// entity type's migrations, or the global record when entityType is empty
+func migrationVersionType(entityType string) string {
+	if entityType == "" {
+		return "migration"
+	}
+	return "migration:" + entityType
 }
 
 // MigrationVersion represents the current migration version
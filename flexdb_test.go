@@ -2,8 +2,12 @@ package flexdb
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestEntity is a sample entity for testing purposes
@@ -212,7 +216,7 @@ func TestMigrations(t *testing.T) {
 		return tx.Delete("test", "migration1")
 	})
 
-	err = db.Migrate(1)
+	_, err = db.Migrate(1)
 	if err != nil {
 		t.Fatalf("Migration failed: %v", err)
 	}
@@ -344,3 +348,1495 @@ func TestCaching(t *testing.T) {
 	}
 	readTx3.Rollback()
 }
+
+func TestSetInvalidEntities(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	writeTx := db.Transact(false)
+	defer writeTx.Rollback()
+
+	if err := writeTx.Set("test", nil); err != ErrNilEntity {
+		t.Errorf("Expected ErrNilEntity for nil entity, got %v", err)
+	}
+
+	var typedNil *TestEntity
+	if err := writeTx.Set("test", typedNil); err != ErrNilEntity {
+		t.Errorf("Expected ErrNilEntity for typed nil entity, got %v", err)
+	}
+
+	if err := writeTx.Set("test", &TestEntity{Name: "No ID"}); err != ErrEmptyID {
+		t.Errorf("Expected ErrEmptyID for entity without ID, got %v", err)
+	}
+
+	err := writeTx.BatchSet("test", []Entity{&TestEntity{ID: "1", Name: "Valid"}, nil})
+	if err != ErrNilEntity {
+		t.Errorf("Expected ErrNilEntity from BatchSet, got %v", err)
+	}
+}
+
+func TestDeleteReturning(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	writeTx := db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "1", Name: "Old", Value: 10})
+	writeTx.Set("test", &TestEntity{ID: "2", Name: "New", Value: 50})
+	writeTx.Set("test", &TestEntity{ID: "3", Name: "Old", Value: 20})
+	writeTx.Commit()
+
+	// Archive and delete the old entities in a single transaction
+	writeTx = db.Transact(false)
+	deleted, err := writeTx.DeleteReturning("test", func(e Entity) bool {
+		return e.(*TestEntity).Name == "Old"
+	})
+	if err != nil {
+		t.Fatalf("DeleteReturning failed: %v", err)
+	}
+	if len(deleted) != 2 {
+		t.Fatalf("Expected 2 deleted entities, got %d", len(deleted))
+	}
+	if err := writeTx.BatchSet("archive", deleted); err != nil {
+		t.Fatalf("Failed to archive deleted entities: %v", err)
+	}
+	if err := writeTx.Commit(); err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	if remaining := readTx.GetAll("test"); len(remaining) != 1 || remaining[0].GetID() != "2" {
+		t.Errorf("Unexpected remaining entities: %v", remaining)
+	}
+	for _, id := range []string{"1", "3"} {
+		archived, ok := readTx.Get("archive", id)
+		if !ok || archived.(*TestEntity).Name != "Old" {
+			t.Errorf("Entity %s was not archived", id)
+		}
+	}
+}
+
+func TestTransactionCount(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	writeTx := db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "1", Name: "Committed", Value: 1})
+	writeTx.Commit()
+
+	writeTx = db.Transact(false)
+	defer writeTx.Rollback()
+
+	writeTx.Set("test", &TestEntity{ID: "2", Name: "Pending", Value: 2})
+	writeTx.Set("test", &TestEntity{ID: "3", Name: "Pending", Value: 3})
+	writeTx.Delete("test", "1")
+	// Updating an existing entity does not change the count
+	writeTx.Set("test", &TestEntity{ID: "2", Name: "Updated", Value: 2})
+
+	if count := writeTx.Count("test"); count != 2 {
+		t.Errorf("Expected count of 2 within transaction, got %d", count)
+	}
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+	if count := readTx.Count("test"); count != 1 {
+		t.Errorf("Expected committed count of 1, got %d", count)
+	}
+}
+
+func TestGenericEntitySaveFormat(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	writeTx := db.Transact(false)
+	writeTx.Set("test", &GenericEntity{ID: "1", Fields: map[string]interface{}{"Name": "Generic", "Value": 7}})
+	if err := writeTx.Commit(); err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to read database file: %v", err)
+	}
+
+	// The saved shape decodes straight into the matching typed struct
+	var saved map[string]map[string]TestEntity
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("Failed to decode saved file: %v", err)
+	}
+	got := saved["test"]["1"]
+	if got.ID != "1" || got.Name != "Generic" || got.Value != 7 {
+		t.Errorf("Unexpected saved entity: %+v", got)
+	}
+
+	var raw map[string]map[string]map[string]interface{}
+	json.Unmarshal(data, &raw)
+	if _, ok := raw["test"]["1"]["Fields"]; ok {
+		t.Errorf("Expected flat field map, got nested Fields: %s", data)
+	}
+}
+
+func TestGenericEntityRoundTrip(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	// A file written with the old nested GenericEntity shape
+	legacy := `{"test": {"1": {"ID": "1", "Fields": {"Name": "Legacy", "Value": 3}}}}`
+	if err := os.WriteFile(dbPath, []byte(legacy), 0644); err != nil {
+		t.Fatalf("Failed to create initial database file: %v", err)
+	}
+
+	db, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to load legacy database: %v", err)
+	}
+	readTx := db.Transact(true)
+	entity, _ := readTx.Get("test", "1")
+	readTx.Rollback()
+	if name, _ := getField(entity, "Name"); name != "Legacy" {
+		t.Fatalf("Expected legacy fields to be flattened, got %+v", entity)
+	}
+
+	if err := db.save(); err != nil {
+		t.Fatalf("Failed to save database: %v", err)
+	}
+	first, _ := os.ReadFile(dbPath)
+
+	reloaded, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reload database: %v", err)
+	}
+	if err := reloaded.save(); err != nil {
+		t.Fatalf("Failed to save reloaded database: %v", err)
+	}
+	second, _ := os.ReadFile(dbPath)
+
+	if string(first) != string(second) {
+		t.Errorf("Save is not byte-stable across reloads:\n%s\n---\n%s", first, second)
+	}
+
+	var raw map[string]map[string]map[string]interface{}
+	if err := json.Unmarshal(second, &raw); err != nil {
+		t.Fatalf("Failed to decode saved file: %v", err)
+	}
+	want := map[string]interface{}{"ID": "1", "Name": "Legacy", "Value": 3.0}
+	if got := raw["test"]["1"]; len(got) != len(want) || got["ID"] != want["ID"] || got["Name"] != want["Name"] || got["Value"] != want["Value"] {
+		t.Errorf("Unexpected saved entity: got %v, want %v", got, want)
+	}
+}
+
+// BudgetEntity is a sample entity with two numeric fields of different kinds
+type BudgetEntity struct {
+	ID     string
+	Spent  float64
+	Budget int
+}
+
+func (b *BudgetEntity) GetID() string   { return b.ID }
+func (b *BudgetEntity) SetID(id string) { b.ID = id }
+
+func TestWhereFieldComparisons(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	writeTx := db.Transact(false)
+	writeTx.Set("budget", &BudgetEntity{ID: "over", Spent: 120.5, Budget: 100})
+	writeTx.Set("budget", &BudgetEntity{ID: "under", Spent: 50, Budget: 100})
+	writeTx.Set("budget", &BudgetEntity{ID: "exact", Spent: 100, Budget: 100})
+	writeTx.Set("budget", &GenericEntity{ID: "generic", Fields: map[string]interface{}{"Spent": 300.0, "Budget": 200.0}})
+	writeTx.Set("budget", &GenericEntity{ID: "missing", Fields: map[string]interface{}{"Spent": 300.0}})
+	writeTx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	ids := func(results []Entity) map[string]bool {
+		found := make(map[string]bool)
+		for _, r := range results {
+			found[r.GetID()] = true
+		}
+		return found
+	}
+
+	results, _ := readTx.NewQuery("budget").WhereFieldGt("Spent", "Budget").Execute()
+	if found := ids(results); len(found) != 2 || !found["over"] || !found["generic"] {
+		t.Errorf("WhereFieldGt returned unexpected results: %v", found)
+	}
+
+	results, _ = readTx.NewQuery("budget").WhereFieldLt("Spent", "Budget").Execute()
+	if found := ids(results); len(found) != 1 || !found["under"] {
+		t.Errorf("WhereFieldLt returned unexpected results: %v", found)
+	}
+
+	results, _ = readTx.NewQuery("budget").WhereFieldEq("Spent", "Budget").Execute()
+	if found := ids(results); len(found) != 1 || !found["exact"] {
+		t.Errorf("WhereFieldEq returned unexpected results: %v", found)
+	}
+}
+
+func TestMigrationOrdering(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	var applied []int
+	for _, version := range []int{3, 1, 2} {
+		version := version
+		db.AddMigration(version, func(tx *Transaction) error {
+			applied = append(applied, version)
+			return nil
+		}, nil)
+	}
+
+	if _, err := db.Migrate(3); err != nil {
+		t.Fatalf("Migration failed: %v", err)
+	}
+	if len(applied) != 3 || applied[0] != 1 || applied[1] != 2 || applied[2] != 3 {
+		t.Errorf("Migrations applied out of order: %v", applied)
+	}
+
+	// Duplicate versions are rejected before anything runs
+	db.AddMigration(4, func(tx *Transaction) error { return nil }, nil)
+	db.AddMigration(4, func(tx *Transaction) error { return nil }, nil)
+	if _, err := db.Migrate(4); err == nil {
+		t.Error("Expected an error for duplicate migration versions")
+	}
+}
+
+func TestMigrationObserver(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	var events []MigrationEvent
+	db.SetMigrationObserver(func(ev MigrationEvent) {
+		events = append(events, ev)
+	})
+
+	db.AddMigration(1, func(tx *Transaction) error { return nil }, func(tx *Transaction) error { return nil })
+	db.AddMigration(2, func(tx *Transaction) error { return fmt.Errorf("boom") }, nil)
+
+	if _, err := db.Migrate(2); err == nil {
+		t.Fatal("Expected migration 2 to fail")
+	}
+
+	if len(events) != 4 {
+		t.Fatalf("Expected 4 events, got %d: %+v", len(events), events)
+	}
+	expected := []MigrationEvent{
+		{Version: 1, Direction: DirectionUp},
+		{Version: 1, Direction: DirectionUp, Done: true},
+		{Version: 2, Direction: DirectionUp},
+		{Version: 2, Direction: DirectionUp, Done: true},
+	}
+	for i, want := range expected {
+		got := events[i]
+		if got.Version != want.Version || got.Direction != want.Direction || got.Done != want.Done {
+			t.Errorf("Event %d: got %+v, want %+v", i, got, want)
+		}
+	}
+	if events[1].Err != nil {
+		t.Errorf("Expected migration 1 to succeed, got %v", events[1].Err)
+	}
+	if events[3].Err == nil || events[3].Err.Error() != "boom" {
+		t.Errorf("Expected migration 2 failure in event, got %v", events[3].Err)
+	}
+
+	// Reverting reports the down direction
+	events = nil
+	if _, err := db.Migrate(1); err != nil {
+		t.Fatalf("Migration failed: %v", err)
+	}
+	events = nil
+	if _, err := db.MigrateDown(0); err != nil {
+		t.Fatalf("MigrateDown failed: %v", err)
+	}
+	if len(events) != 2 || events[0].Direction != DirectionDown || events[0].Version != 1 {
+		t.Errorf("Unexpected down events: %+v", events)
+	}
+}
+
+func TestIndexEntries(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.AddIndex("test", "Name")
+
+	writeTx := db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "1", Name: "Alice", Value: 30})
+	writeTx.Set("test", &TestEntity{ID: "2", Name: "Bob", Value: 25})
+	writeTx.Set("test", &TestEntity{ID: "3", Name: "Bob", Value: 35})
+	writeTx.Commit()
+
+	entries := db.IndexEntries("test", "Name")
+	if len(entries) != 2 || len(entries["Alice"]) != 1 || len(entries["Bob"]) != 2 {
+		t.Errorf("Unexpected index entries: %v", entries)
+	}
+
+	// Updates move the id to the new bucket and deletes remove it
+	writeTx = db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "2", Name: "Alice", Value: 25})
+	writeTx.Delete("test", "3")
+	writeTx.Commit()
+
+	entries = db.IndexEntries("test", "Name")
+	if len(entries) != 1 || len(entries["Alice"]) != 2 {
+		t.Errorf("Unexpected index entries after update: %v", entries)
+	}
+
+	// The returned map is a copy
+	entries["Alice"][0] = "tampered"
+	if db.IndexEntries("test", "Name")["Alice"][0] == "tampered" {
+		t.Error("IndexEntries exposed the internal index")
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	merges := 0
+	accumulate := func(existing, incoming Entity) Entity {
+		merges++
+		return &TestEntity{
+			ID:    incoming.GetID(),
+			Name:  incoming.(*TestEntity).Name,
+			Value: existing.(*TestEntity).Value + incoming.(*TestEntity).Value,
+		}
+	}
+
+	writeTx := db.Transact(false)
+	if err := writeTx.Upsert("test", &TestEntity{ID: "1", Name: "First", Value: 10}, accumulate); err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	writeTx.Commit()
+
+	writeTx = db.Transact(false)
+	if err := writeTx.Upsert("test", &TestEntity{ID: "1", Name: "Second", Value: 5}, accumulate); err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	writeTx.Commit()
+
+	if merges != 1 {
+		t.Errorf("Expected merge to be called once, got %d", merges)
+	}
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+	entity, _ := readTx.Get("test", "1")
+	if got := entity.(*TestEntity); got.Name != "Second" || got.Value != 15 {
+		t.Errorf("Unexpected upserted entity: %+v", got)
+	}
+}
+
+func TestCallbackPanics(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	db.RegisterHook("pre-set", func(tx *Transaction, entityType string, entity Entity) error {
+		if entity.GetID() == "bad" {
+			panic("hook exploded")
+		}
+		return nil
+	})
+
+	writeTx := db.Transact(false)
+	err := writeTx.Set("test", &TestEntity{ID: "bad", Name: "Bad"})
+	if !errors.Is(err, ErrCallbackPanic) {
+		t.Errorf("Expected ErrCallbackPanic from panicking hook, got %v", err)
+	}
+	writeTx.Rollback()
+
+	// The database keeps working, including taking the write lock
+	writeTx = db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "good", Name: "Good"})
+	if err := writeTx.Commit(); err != nil {
+		t.Fatalf("Commit after panicking hook failed: %v", err)
+	}
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	_, err = readTx.NewQuery("test").WhereFunc(func(e Entity) bool {
+		panic("predicate exploded")
+	}).Execute()
+	if !errors.Is(err, ErrCallbackPanic) {
+		t.Errorf("Expected ErrCallbackPanic from panicking predicate, got %v", err)
+	}
+
+	writeTx = db.Transact(false)
+	defer writeTx.Rollback()
+	err = writeTx.Upsert("test", &TestEntity{ID: "good"}, func(existing, incoming Entity) Entity {
+		panic("merge exploded")
+	})
+	if !errors.Is(err, ErrCallbackPanic) {
+		t.Errorf("Expected ErrCallbackPanic from panicking merge, got %v", err)
+	}
+	_, err = writeTx.DeleteReturning("test", func(e Entity) bool {
+		panic("delete predicate exploded")
+	})
+	if !errors.Is(err, ErrCallbackPanic) {
+		t.Errorf("Expected ErrCallbackPanic from panicking delete predicate, got %v", err)
+	}
+}
+
+func TestCorruptedCacheEntry(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	writeTx := db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "1", Name: "Stored", Value: 1})
+	writeTx.Commit()
+
+	// Corrupt the cached value
+	db.cache.Set(getCacheKey("test", "1"), "not an entity")
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	entity, err := readTx.GetErr("test", "1")
+	if err != nil {
+		t.Fatalf("Expected entity to be recovered from data, got %v", err)
+	}
+	if entity.(*TestEntity).Name != "Stored" {
+		t.Errorf("Unexpected entity: %+v", entity)
+	}
+	if cached, _ := db.cache.Get(getCacheKey("test", "1")); cached != entity {
+		t.Error("Expected the cache to be repopulated with the stored entity")
+	}
+
+	if _, err := readTx.GetErr("test", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestOrderByMixedTypes(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	writeTx := db.Transact(false)
+	writeTx.Set("mixed", &GenericEntity{ID: "string-b", Fields: map[string]interface{}{"Score": "b"}})
+	writeTx.Set("mixed", &GenericEntity{ID: "number-3", Fields: map[string]interface{}{"Score": 3}})
+	writeTx.Set("mixed", &GenericEntity{ID: "missing", Fields: map[string]interface{}{}})
+	writeTx.Set("mixed", &GenericEntity{ID: "string-a", Fields: map[string]interface{}{"Score": "a"}})
+	writeTx.Set("mixed", &GenericEntity{ID: "bool", Fields: map[string]interface{}{"Score": true}})
+	writeTx.Set("mixed", &GenericEntity{ID: "number-1.5", Fields: map[string]interface{}{"Score": 1.5}})
+	writeTx.Set("mixed", &GenericEntity{ID: "object", Fields: map[string]interface{}{"Score": map[string]interface{}{"x": 1}}})
+	writeTx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	results, err := readTx.NewQuery("mixed").OrderBy("Score", false).Execute()
+	if err != nil {
+		t.Fatalf("Ordering mixed types failed: %v", err)
+	}
+
+	expected := []string{"missing", "bool", "number-1.5", "number-3", "string-a", "string-b", "object"}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+	}
+	for i, id := range expected {
+		if results[i].GetID() != id {
+			t.Errorf("Position %d: got %s, want %s", i, results[i].GetID(), id)
+		}
+	}
+
+	results, _ = readTx.NewQuery("mixed").OrderBy("Score", true).Execute()
+	if results[0].GetID() != "object" || results[len(results)-1].GetID() != "missing" {
+		t.Errorf("Unexpected descending order: first %s, last %s", results[0].GetID(), results[len(results)-1].GetID())
+	}
+}
+
+func TestReindex(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.AddIndex("test", "Name")
+	db.AddIndex("test", "Value")
+
+	writeTx := db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "1", Name: "Alice", Value: 30})
+	writeTx.Set("test", &TestEntity{ID: "2", Name: "Bob", Value: 30})
+	writeTx.Commit()
+
+	// Corrupt the indexes with duplicate and stale entries
+	db.mu.Lock()
+	db.indexes["test"]["Name"]["Alice"] = []string{"1", "1", "2"}
+	db.indexes["test"]["Value"]["99"] = []string{"3"}
+	db.mu.Unlock()
+
+	if len(db.Verify()) == 0 {
+		t.Fatal("Expected Verify to report the corrupted indexes")
+	}
+
+	db.Reindex("test")
+
+	if issues := db.Verify(); len(issues) != 0 {
+		t.Errorf("Expected clean indexes after Reindex, got %v", issues)
+	}
+	names := db.IndexEntries("test", "Name")
+	if len(names) != 2 || len(names["Alice"]) != 1 || len(names["Bob"]) != 1 {
+		t.Errorf("Unexpected Name index after Reindex: %v", names)
+	}
+	values := db.IndexEntries("test", "Value")
+	if len(values) != 1 || len(values["30"]) != 2 {
+		t.Errorf("Unexpected Value index after Reindex: %v", values)
+	}
+}
+
+func TestHookV2(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	writeTx := db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "1", Name: "Before", Value: 1})
+	writeTx.Commit()
+
+	var events []HookEvent
+	record := func(tx *Transaction, ev HookEvent) error {
+		events = append(events, ev)
+		return nil
+	}
+	db.RegisterHookV2("pre-set", record)
+	db.RegisterHookV2("post-delete", record)
+
+	writeTx = db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "1", Name: "After", Value: 2})
+	writeTx.Set("test", &TestEntity{ID: "2", Name: "New", Value: 3})
+	writeTx.Commit()
+
+	writeTx = db.Transact(false)
+	writeTx.Delete("test", "2")
+	writeTx.Commit()
+
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 hook events, got %d", len(events))
+	}
+	update := events[0]
+	if update.Operation != "pre-set" || update.EntityType != "test" {
+		t.Errorf("Unexpected event: %+v", update)
+	}
+	if update.Old == nil || update.Old.(*TestEntity).Name != "Before" || update.New.(*TestEntity).Name != "After" {
+		t.Errorf("Expected Old to be the committed value and New the incoming one, got %+v", update)
+	}
+	if events[1].Old != nil || events[1].New.GetID() != "2" {
+		t.Errorf("Expected insert to have no Old value, got %+v", events[1])
+	}
+	if events[2].Operation != "post-delete" || events[2].Old.GetID() != "2" || events[2].New != nil {
+		t.Errorf("Unexpected delete event: %+v", events[2])
+	}
+}
+
+func TestHookV2OldIsStoredEntity(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.SetFieldDefault("doc", "status", "draft")
+	db.SetLoader("doc", func(id string) (Entity, bool, error) {
+		return &GenericEntity{ID: id, Fields: map[string]interface{}{"title": "Loaded"}}, true, nil
+	})
+
+	tx := db.Transact(false)
+	tx.Set("doc", &GenericEntity{ID: "1", Fields: map[string]interface{}{"title": "Stored"}})
+	tx.Commit()
+
+	var olds []Entity
+	db.RegisterHookV2("pre-set", func(tx *Transaction, ev HookEvent) error {
+		olds = append(olds, ev.Old)
+		return nil
+	})
+	tx = db.Transact(false)
+	tx.Set("doc", &GenericEntity{ID: "1", Fields: map[string]interface{}{"title": "Updated"}})
+	tx.Set("doc", &GenericEntity{ID: "2", Fields: map[string]interface{}{"title": "New"}})
+	tx.Commit()
+
+	if len(olds) != 2 {
+		t.Fatalf("Expected 2 pre-set events, got %d", len(olds))
+	}
+	if old, ok := olds[0].(*GenericEntity); !ok || old.Fields["title"] != "Stored" {
+		t.Errorf("Expected the stored entity as Old, got %#v", olds[0])
+	} else if _, padded := old.Fields["status"]; padded {
+		t.Errorf("Expected Old without read-time defaults, got %v", old.Fields)
+	}
+	if olds[1] != nil {
+		t.Errorf("Expected no Old for an insert even with a loader, got %#v", olds[1])
+	}
+}
+
+func TestQueryClone(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	writeTx := db.Transact(false)
+	for i := 1; i <= 5; i++ {
+		writeTx.Set("test", &TestEntity{ID: fmt.Sprint(i), Value: i * 10})
+	}
+	writeTx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	base := readTx.NewQuery("test").WhereFunc(func(e Entity) bool {
+		return e.(*TestEntity).Value > 10
+	})
+
+	clone := base.Clone().WhereFunc(func(e Entity) bool {
+		return e.(*TestEntity).Value < 40
+	}).Limit(1)
+
+	baseResults, _ := base.Execute()
+	cloneResults, _ := clone.Execute()
+	if len(baseResults) != 4 {
+		t.Errorf("Expected base query to be unaffected and return 4 results, got %d", len(baseResults))
+	}
+	if len(cloneResults) != 1 {
+		t.Errorf("Expected clone to apply its own filter and limit, got %d", len(cloneResults))
+	}
+}
+
+func TestExecuteTotalOrder(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	for i := 0; i < 50; i++ {
+		tx.Set("test", &TestEntity{ID: fmt.Sprintf("%02d", i), Value: i % 2})
+	}
+	tx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	ids := func(q *Query) []string {
+		results, err := q.Execute()
+		if err != nil {
+			t.Fatalf("Failed to execute: %v", err)
+		}
+		out := make([]string, len(results))
+		for i, e := range results {
+			out[i] = e.GetID()
+		}
+		return out
+	}
+
+	first := ids(readTx.NewQuery("test").OrderBy("Value", true))
+	second := ids(readTx.NewQuery("test").OrderBy("Value", true))
+	if fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Errorf("Expected identical ordering across calls:\n%v\n%v", first, second)
+	}
+	// Value 1 sorts first when descending, and ties are in ID order
+	if first[0] != "01" || first[1] != "03" || first[25] != "00" {
+		t.Errorf("Expected ties broken by ID, got %v", first)
+	}
+
+	unordered := ids(readTx.NewQuery("test").Limit(3))
+	if fmt.Sprint(unordered) != "[00 01 02]" {
+		t.Errorf("Expected unordered queries to fall back to ID order, got %v", unordered)
+	}
+}
+
+func TestQueryHydrate(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "alice", Value: 2})
+	tx.Set("test", &TestEntity{ID: "2", Name: "bob", Value: 3})
+	tx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	results, err := readTx.NewQuery("test").OrderBy("ID", false).Hydrate(func(e Entity) error {
+		te := e.(*TestEntity)
+		te.Name = strings.ToUpper(te.Name)
+		return nil
+	}).Hydrate(func(e Entity) error {
+		e.(*TestEntity).Value *= 10
+		return nil
+	}).Execute()
+	if err != nil {
+		t.Fatalf("Failed to execute: %v", err)
+	}
+	if first := results[0].(*TestEntity); first.Name != "ALICE" || first.Value != 20 {
+		t.Errorf("Expected hydrated ALICE/20, got %s/%d", first.Name, first.Value)
+	}
+	if stored, _ := readTx.Get("test", "1"); stored.(*TestEntity).Name != "alice" {
+		t.Error("Expected hydration not to change the stored entity")
+	}
+
+	errHydrate := errors.New("enrichment failed")
+	calls := 0
+	_, err = readTx.NewQuery("test").Hydrate(func(Entity) error {
+		calls++
+		return errHydrate
+	}).Execute()
+	if !errors.Is(err, errHydrate) || calls != 1 {
+		t.Errorf("Expected the first hydration error to stop Execute, got %v after %d calls", err, calls)
+	}
+}
+
+func TestDeleteWhere(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		dbPath := "./test_db.json"
+		os.Remove(dbPath)
+
+		db, _ := NewDatabase(dbPath)
+		if indexed {
+			db.AddIndex("test", "Name")
+		}
+		tx := db.Transact(false)
+		for i := 0; i < 10; i++ {
+			name := "keep"
+			if i%2 == 0 {
+				name = "drop"
+			}
+			tx.Set("test", &TestEntity{ID: fmt.Sprint(i), Name: name})
+		}
+		tx.Commit()
+
+		tx = db.Transact(false)
+		// Pending changes are seen: one new match, and one committed match renamed away
+		tx.Set("test", &TestEntity{ID: "new", Name: "drop"})
+		tx.Set("test", &TestEntity{ID: "0", Name: "renamed"})
+		n, err := tx.DeleteWhere("test", "Name", "drop")
+		if err != nil {
+			t.Fatalf("DeleteWhere failed: %v", err)
+		}
+		tx.Commit()
+
+		if n != 5 {
+			t.Errorf("indexed=%v: expected 5 deletions, got %d", indexed, n)
+		}
+		readTx := db.Transact(true)
+		if count := readTx.Count("test"); count != 6 {
+			t.Errorf("indexed=%v: expected 6 remaining, got %d", indexed, count)
+		}
+		if _, ok := readTx.Get("test", "0"); !ok {
+			t.Errorf("indexed=%v: expected renamed entity to survive", indexed)
+		}
+		readTx.Rollback()
+		os.Remove(dbPath)
+	}
+}
+
+func BenchmarkDeleteWhere(b *testing.B) {
+	for _, indexed := range []bool{false, true} {
+		b.Run(fmt.Sprintf("indexed=%v", indexed), func(b *testing.B) {
+			dbPath := "./bench_db.json"
+			defer os.Remove(dbPath)
+
+			db, _ := NewDatabase(dbPath, WithSyncMode(SyncNever))
+			if indexed {
+				db.AddIndex("session", "Name")
+			}
+			tx := db.Transact(false)
+			for i := 0; i < 5000; i++ {
+				tx.Set("session", &TestEntity{ID: fmt.Sprint(i), Name: fmt.Sprint("user", i%500)})
+			}
+			tx.Commit()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tx := db.Transact(false)
+				tx.DeleteWhere("session", "Name", "user7")
+				tx.Rollback()
+			}
+		})
+	}
+}
+
+func TestTypeMigrations(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	var ran []string
+	for _, entityType := range []string{"user", "order"} {
+		entityType := entityType
+		for v := 1; v <= 3; v++ {
+			v := v
+			db.AddTypeMigration(entityType, v, func(tx *Transaction) error {
+				ran = append(ran, fmt.Sprintf("%s@%d", entityType, v))
+				return nil
+			}, nil)
+		}
+	}
+
+	result, err := db.MigrateType("user", 3)
+	if err != nil {
+		t.Fatalf("MigrateType user failed: %v", err)
+	}
+	if fmt.Sprint(result.Applied) != "[1 2 3]" || result.ToVersion != 3 {
+		t.Errorf("Expected user migrations 1 to 3 to be reported, got %+v", result)
+	}
+	if _, err := db.MigrateType("order", 1); err != nil {
+		t.Fatalf("MigrateType order failed: %v", err)
+	}
+	if len(ran) != 4 {
+		t.Errorf("Expected 4 migrations to run, got %v", ran)
+	}
+
+	// Versions are tracked per type and survive a reload
+	reloaded, _ := NewDatabase(dbPath)
+	for entityType, want := range map[string]int{"user": 3, "order": 1, "": 0} {
+		got, err := reloaded.TypeVersion(entityType)
+		if err != nil {
+			t.Fatalf("TypeVersion %q failed: %v", entityType, err)
+		}
+		if got != want {
+			t.Errorf("Expected %q at version %d, got %d", entityType, want, got)
+		}
+	}
+}
+
+func TestWhereFieldExists(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("doc", &GenericEntity{ID: "set", Fields: map[string]interface{}{"nickname": "Al"}})
+	tx.Set("doc", &GenericEntity{ID: "nil", Fields: map[string]interface{}{"nickname": nil}})
+	tx.Set("doc", &GenericEntity{ID: "absent", Fields: map[string]interface{}{"other": 1}})
+	tx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	ids := func(results []Entity) map[string]bool {
+		found := make(map[string]bool)
+		for _, e := range results {
+			found[e.GetID()] = true
+		}
+		return found
+	}
+
+	exists, _ := readTx.NewQuery("doc").WhereFieldExists("nickname").Execute()
+	if found := ids(exists); len(found) != 2 || !found["set"] || !found["nil"] {
+		t.Errorf("Expected set and nil to have the field, got %v", found)
+	}
+
+	null, _ := readTx.NewQuery("doc").WhereNull("nickname").Execute()
+	if found := ids(null); len(found) != 2 || !found["nil"] || !found["absent"] {
+		t.Errorf("Expected nil and absent to be null, got %v", found)
+	}
+}
+
+func TestUpdateWhere(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.AddIndex("test", "Name")
+	tx := db.Transact(false)
+	for i := 0; i < 6; i++ {
+		name := "pending"
+		if i%3 == 0 {
+			name = "shipped"
+		}
+		tx.Set("test", &TestEntity{ID: fmt.Sprint(i), Name: name, Value: i})
+	}
+	tx.Commit()
+
+	hookCalls := 0
+	db.RegisterHook("post-set", func(tx *Transaction, entityType string, entity Entity) error {
+		hookCalls++
+		return nil
+	})
+
+	tx = db.Transact(false)
+	n, err := tx.UpdateWhere("test", func(e Entity) bool {
+		return e.(*TestEntity).Name == "pending"
+	}, func(e Entity) {
+		e.(*TestEntity).Name = "cancelled"
+	})
+	if err != nil {
+		t.Fatalf("UpdateWhere failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	if n != 4 || hookCalls != 4 {
+		t.Errorf("Expected 4 updates and 4 hook calls, got %d and %d", n, hookCalls)
+	}
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+	for _, e := range readTx.GetAll("test") {
+		te := e.(*TestEntity)
+		want := "cancelled"
+		if te.Value%3 == 0 {
+			want = "shipped"
+		}
+		if te.Name != want {
+			t.Errorf("Expected %s to be %s, got %s", te.ID, want, te.Name)
+		}
+	}
+	if ids := db.IndexEntries("test", "Name")["cancelled"]; len(ids) != 4 {
+		t.Errorf("Expected the index to reflect 4 cancelled entities, got %v", ids)
+	}
+}
+
+func TestReplaceCollection(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.AddIndex("test", "Name")
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "old", Name: "stale"})
+	tx.Set("test", &TestEntity{ID: "kept", Name: "stale"})
+	tx.Commit()
+
+	tx = db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "pending", Name: "stale"})
+	err := tx.ReplaceCollection("test", []Entity{
+		&TestEntity{ID: "kept", Name: "fresh"},
+		&TestEntity{ID: "new", Name: "fresh"},
+	})
+	if err != nil {
+		t.Fatalf("ReplaceCollection failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	reloaded, _ := NewDatabase(dbPath)
+	reloaded.AddIndex("test", "Name")
+	for _, db := range []*Database{db, reloaded} {
+		ids := make(map[string]bool)
+		for _, e := range db.GetAll("test") {
+			ids[e.GetID()] = true
+		}
+		if len(ids) != 2 || !ids["kept"] || !ids["new"] {
+			t.Errorf("Expected only kept and new to remain, got %v", ids)
+		}
+		index := db.IndexEntries("test", "Name")
+		if len(index["stale"]) != 0 || len(index["fresh"]) != 2 {
+			t.Errorf("Expected the index to hold only the new set, got %v", index)
+		}
+	}
+}
+
+func TestWhereTupleIn(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "a", Value: 1})
+	tx.Set("test", &TestEntity{ID: "2", Name: "a", Value: 2})
+	tx.Set("test", &TestEntity{ID: "3", Name: "b", Value: 1})
+	tx.Set("test", &TestEntity{ID: "4", Name: "b", Value: 2})
+	tx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	results, err := readTx.NewQuery("test").
+		WhereTupleIn([]string{"Name", "Value"}, [][]interface{}{{"a", 1}, {"b", 2}, {"c"}}).
+		OrderBy("ID", false).
+		Execute()
+	if err != nil {
+		t.Fatalf("Failed to execute tuple query: %v", err)
+	}
+	if len(results) != 2 || results[0].GetID() != "1" || results[1].GetID() != "4" {
+		t.Errorf("Expected only exact combinations 1 and 4, got %v", results)
+	}
+}
+
+func TestFailedCommitKeepsMemoryAndDiskInAgreement(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.RemoveAll(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.AddIndex("test", "Name")
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "committed", Value: 1})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	// A non-empty directory in place of the file makes the final rename fail
+	os.Remove(dbPath)
+	os.MkdirAll(dbPath+"/locked", 0755)
+
+	tx = db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "lost", Value: 2})
+	tx.Delete("test", "1")
+	tx.Set("test", &TestEntity{ID: "2", Name: "lost", Value: 3})
+	if err := tx.Commit(); err == nil {
+		t.Fatal("Expected the commit to fail")
+	}
+
+	if e, ok := db.Get("test", "1"); !ok || e.(*TestEntity).Name != "committed" {
+		t.Errorf("Expected Get to return the pre-commit value, got %v", e)
+	}
+	if all := db.GetAll("test"); len(all) != 1 {
+		t.Errorf("Expected 1 entity after the failed commit, got %d", len(all))
+	}
+	if lost, _ := db.Query("test").Where("Name", "lost").Execute(); len(lost) != 0 {
+		t.Errorf("Expected no entities from the failed commit, got %v", lost)
+	}
+
+	// Once storage recovers, a later commit persists only its own changes
+	os.RemoveAll(dbPath)
+	tx = db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "3", Name: "later", Value: 4})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit after recovery: %v", err)
+	}
+
+	reloaded, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	ids := make(map[string]bool)
+	for _, e := range reloaded.GetAll("test") {
+		ids[e.GetID()] = true
+	}
+	if len(ids) != 2 || !ids["1"] || !ids["3"] {
+		t.Errorf("Expected the reloaded database to hold 1 and 3, got %v", ids)
+	}
+}
+
+func TestWhereNested(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("order", &GenericEntity{ID: "o1", Fields: map[string]interface{}{
+		"lineItems": []map[string]interface{}{{"sku": "A1", "qty": 2}, {"sku": "B2", "qty": 1}},
+	}})
+	tx.Set("order", &GenericEntity{ID: "o2", Fields: map[string]interface{}{
+		"lineItems": []map[string]interface{}{{"sku": "C3", "qty": 2}},
+	}})
+	tx.Set("order", &GenericEntity{ID: "o3", Fields: map[string]interface{}{"lineItems": "B2"}})
+	tx.Commit()
+
+	// Reloaded line items decode as []interface{} of maps and still match
+	reloaded, _ := NewDatabase(dbPath)
+	for _, db := range []*Database{db, reloaded} {
+		results, err := db.Query("order").WhereNested("lineItems", "sku", "B2").Execute()
+		if err != nil {
+			t.Fatalf("Failed to execute: %v", err)
+		}
+		if len(results) != 1 || results[0].GetID() != "o1" {
+			t.Errorf("Expected only o1 to contain sku B2, got %v", results)
+		}
+		byQty, _ := db.Query("order").WhereNested("lineItems", "qty", 2).Execute()
+		if len(byQty) != 2 {
+			t.Errorf("Expected 2 orders with a qty 2 line item, got %d", len(byQty))
+		}
+	}
+}
+
+func TestDeletePrunesEveryIndexBucket(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.AddIndex("test", "Name")
+	db.AddIndex("test", "Value")
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "indexed", Value: 7})
+	tx.Set("test", &TestEntity{ID: "2", Name: "indexed", Value: 7})
+	tx.Commit()
+
+	// Change the stored entity in place so its current values no longer match its buckets
+	stored, _ := db.Get("test", "1")
+	stored.(*TestEntity).Name = "drifted"
+	stored.(*TestEntity).Value = 8
+
+	tx = db.Transact(false)
+	tx.Delete("test", "1")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	for _, field := range []string{"Name", "Value"} {
+		for key, ids := range db.IndexEntries("test", field) {
+			for _, id := range ids {
+				if id == "1" {
+					t.Errorf("Expected the deleted id to be gone from %s bucket %q", field, key)
+				}
+			}
+		}
+	}
+	if ids := db.IndexEntries("test", "Name")["indexed"]; len(ids) != 1 || ids[0] != "2" {
+		t.Errorf("Expected the other entity to stay indexed, got %v", ids)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.AddIndex("test", "Name")
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "kept"})
+	tx.Commit()
+
+	db.Reserve("test", 1000)
+	db.AddIndex("test", "Value")
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+	if _, ok := readTx.Get("test", "1"); !ok {
+		t.Error("Expected Reserve to keep existing entities")
+	}
+	if ids := db.IndexEntries("test", "Name")["kept"]; len(ids) != 1 {
+		t.Errorf("Expected Reserve to keep existing index entries, got %v", ids)
+	}
+}
+
+// BenchmarkReserve fills the entity and index maps the way a commit does,
+// leaving out the cost of saving the file so the map growth is visible
+func BenchmarkReserve(b *testing.B) {
+	const n = 20000
+	for _, reserve := range []bool{false, true} {
+		b.Run(fmt.Sprintf("reserve=%v", reserve), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				db := &Database{
+					data:        make(map[string]map[string]Entity),
+					indexes:     make(map[string]map[string]map[string][]string),
+					collections: make(map[string]*collection),
+				}
+				if reserve {
+					db.Reserve("bulk", n)
+				}
+				db.AddIndex("bulk", "Name")
+				entities := db.data["bulk"]
+				if entities == nil {
+					entities = make(map[string]Entity)
+					db.data["bulk"] = entities
+				}
+				index := db.indexes["bulk"]["Name"]
+				for j := 0; j < n; j++ {
+					id := fmt.Sprint(j)
+					entities[id] = &TestEntity{ID: id, Name: id}
+					index[id] = append(index[id], id)
+				}
+			}
+		})
+	}
+}
+
+func TestCommitTypes(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("user", &UserEntity{ID: "u1", Email: "staged@example.com"})
+	tx.Set("order", &OrderEntity{ID: "o1", UserID: "u1"})
+
+	if err := tx.CommitTypes("user"); err != nil {
+		t.Fatalf("CommitTypes failed: %v", err)
+	}
+
+	reloaded, _ := NewDatabase(dbPath)
+	readTx := reloaded.Transact(true)
+	if _, ok := readTx.Get("user", "u1"); !ok {
+		t.Error("Expected the committed type to be saved")
+	}
+	if _, ok := readTx.Get("order", "o1"); ok {
+		t.Error("Expected the other type to stay pending")
+	}
+	readTx.Rollback()
+
+	// The remaining changes are still visible to the transaction and commit later
+	if _, ok := tx.Get("order", "o1"); !ok {
+		t.Error("Expected the pending order to remain in the transaction")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	readTx = db.Transact(true)
+	defer readTx.Rollback()
+	if _, ok := readTx.Get("order", "o1"); !ok {
+		t.Error("Expected the order to be committed")
+	}
+}
+
+func TestWhereDeepEqual(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("person", &GenericEntity{ID: "1", Fields: map[string]interface{}{
+		"address": map[string]interface{}{"city": "Sydney", "zip": "2000"},
+		"tags":    []interface{}{"a", "b"},
+	}})
+	tx.Set("person", &GenericEntity{ID: "2", Fields: map[string]interface{}{
+		"address": map[string]interface{}{"city": "Sydney", "zip": "2001"},
+		"tags":    []interface{}{"a"},
+	}})
+	tx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	results, err := readTx.NewQuery("person").
+		Where("address", map[string]interface{}{"city": "Sydney", "zip": "2000"}).
+		Execute()
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if len(results) != 1 || results[0].GetID() != "1" {
+		t.Errorf("Expected only person 1 to match the nested map, got %v", results)
+	}
+
+	results, _ = readTx.NewQuery("person").WhereIn("tags", []interface{}{[]interface{}{"a"}}).Execute()
+	if len(results) != 1 || results[0].GetID() != "2" {
+		t.Errorf("Expected only person 2 to match the slice, got %v", results)
+	}
+}
+
+func TestUpdateAndView(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	err := db.Update(func(tx *Transaction) error {
+		return tx.Set("test", &TestEntity{ID: "1", Name: "Kept"})
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	failure := errors.New("validation failed")
+	err = db.Update(func(tx *Transaction) error {
+		tx.Set("test", &TestEntity{ID: "2", Name: "Discarded"})
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the callback error, got %v", err)
+	}
+
+	err = db.Update(func(tx *Transaction) error {
+		tx.Set("test", &TestEntity{ID: "3", Name: "Panicked"})
+		panic("boom")
+	})
+	if !errors.Is(err, ErrCallbackPanic) {
+		t.Errorf("Expected ErrCallbackPanic, got %v", err)
+	}
+
+	err = db.View(func(tx *Transaction) error {
+		if _, ok := tx.Get("test", "1"); !ok {
+			t.Error("Expected the committed entity")
+		}
+		for _, id := range []string{"2", "3"} {
+			if _, ok := tx.Get("test", id); ok {
+				t.Errorf("Expected entity %s to be rolled back", id)
+			}
+		}
+		return tx.Set("test", &TestEntity{ID: "4"})
+	})
+	if err == nil {
+		t.Error("Expected writes in View to fail")
+	}
+	if stats := db.TxStats(); stats.OpenReadTx != 0 || stats.OpenWriteTx != 0 {
+		t.Errorf("Expected every transaction to be closed, got %+v", stats)
+	}
+}
+
+func TestDatabaseReadFacade(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.Update(func(tx *Transaction) error {
+		tx.Set("test", &TestEntity{ID: "1", Name: "One", Value: 1})
+		return tx.Set("test", &TestEntity{ID: "2", Name: "Two", Value: 2})
+	})
+
+	entity, ok := db.Get("test", "1")
+	if !ok || entity.(*TestEntity).Name != "One" {
+		t.Errorf("Expected db.Get to return entity 1, got %v", entity)
+	}
+	if _, ok := db.Get("test", "missing"); ok {
+		t.Error("Expected db.Get to miss")
+	}
+	if all := db.GetAll("test"); len(all) != 2 {
+		t.Errorf("Expected 2 entities from db.GetAll, got %d", len(all))
+	}
+	results, err := db.Query("test").Where("Name", "Two").Execute()
+	if err != nil || len(results) != 1 {
+		t.Errorf("Expected db.Query to find entity 2, got %v, %v", results, err)
+	}
+	if stats := db.TxStats(); stats.OpenReadTx != 0 {
+		t.Errorf("Expected no open read transactions, got %d", stats.OpenReadTx)
+	}
+}
+
+func TestEmptyCommitSkipsSave(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "Saved"})
+	tx.Commit()
+
+	before, err := os.Stat(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to stat database file: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	var observed int
+	db.SetCommitObserver(func(CommitMetrics) { observed++ })
+	if err := db.Transact(false).Commit(); err != nil {
+		t.Fatalf("Expected empty commit to succeed, got %v", err)
+	}
+
+	after, _ := os.Stat(dbPath)
+	if !after.ModTime().Equal(before.ModTime()) {
+		t.Error("Expected an empty commit to leave the file untouched")
+	}
+	if observed != 0 {
+		t.Errorf("Expected no commit metrics for an empty commit, got %d", observed)
+	}
+}
+
+func TestMigrationResult(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "old", Name: "Old"})
+	tx.Set("test", &TestEntity{ID: "keep", Name: "Keep"})
+	tx.Commit()
+
+	db.AddMigration(1, func(tx *Transaction) error {
+		tx.Set("test", &TestEntity{ID: "new1", Name: "New"})
+		return tx.Set("test", &TestEntity{ID: "new2", Name: "New"})
+	}, func(tx *Transaction) error {
+		tx.Delete("test", "new1")
+		return tx.Delete("test", "new2")
+	})
+	db.AddMigration(2, func(tx *Transaction) error {
+		tx.Delete("test", "old")
+		return tx.Set("test", &TestEntity{ID: "keep", Name: "Kept", Value: 1})
+	}, func(tx *Transaction) error {
+		return tx.Set("test", &TestEntity{ID: "old", Name: "Old"})
+	})
+
+	result, err := db.Migrate(2)
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if result.FromVersion != 0 || result.ToVersion != 2 || fmt.Sprint(result.Applied) != "[1 2]" {
+		t.Errorf("Unexpected versions in result: %+v", result)
+	}
+	if result.Created != 2 || result.Updated != 1 || result.Deleted != 1 {
+		t.Errorf("Expected 2 created, 1 updated and 1 deleted, got %+v", result)
+	}
+
+	result, err = db.MigrateDown(0)
+	if err != nil {
+		t.Fatalf("MigrateDown failed: %v", err)
+	}
+	if result.FromVersion != 2 || result.ToVersion != 0 || fmt.Sprint(result.Applied) != "[2 1]" {
+		t.Errorf("Unexpected versions in down result: %+v", result)
+	}
+	if result.Created != 1 || result.Updated != 0 || result.Deleted != 2 {
+		t.Errorf("Expected 1 created and 2 deleted, got %+v", result)
+	}
+
+	// Nothing to run leaves the version where it was
+	result, _ = db.MigrateDown(0)
+	if len(result.Applied) != 0 || result.FromVersion != 0 || result.ToVersion != 0 {
+		t.Errorf("Expected an empty result, got %+v", result)
+	}
+}
+
+func TestWhereRangeComparisons(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	base := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	for i, value := range []int{10, 20, 30, 40, 50} {
+		id := fmt.Sprint(i)
+		tx.Set("test", &TestEntity{ID: id, Name: "n" + id, Value: value})
+		tx.Set("users", &UserEntity{ID: id, CreatedAt: base.AddDate(0, 0, i)})
+	}
+	tx.Commit()
+
+	check := func(db *Database, label string) {
+		t.Helper()
+		readTx := db.Transact(true)
+		defer readTx.Rollback()
+
+		cases := []struct {
+			query *Query
+			want  int
+		}{
+			{readTx.NewQuery("test").WhereGreaterThan("Value", 30), 2},
+			{readTx.NewQuery("test").WhereGreaterOrEqual("Value", 30), 3},
+			{readTx.NewQuery("test").WhereLessThan("Value", 30.5), 3},
+			{readTx.NewQuery("test").WhereLessOrEqual("Value", int64(20)), 2},
+			{readTx.NewQuery("test").WhereGreaterThan("Value", 15).WhereLessThan("Value", 45), 3},
+			{readTx.NewQuery("users").WhereGreaterOrEqual("CreatedAt", base.AddDate(0, 0, 3)), 2},
+			{readTx.NewQuery("users").WhereLessThan("CreatedAt", base.AddDate(0, 0, 1)), 1},
+			// Values of a different kind never match rather than panicking
+			{readTx.NewQuery("test").WhereGreaterThan("Name", 5), 0},
+			{readTx.NewQuery("test").WhereLessThan("Missing", 5), 0},
+		}
+		for _, c := range cases {
+			results, err := c.query.Execute()
+			if err != nil {
+				t.Fatalf("%s: %s failed: %v", label, c.query, err)
+			}
+			if len(results) != c.want {
+				t.Errorf("%s: %s returned %d results, want %d", label, c.query, len(results), c.want)
+			}
+		}
+	}
+
+	check(db, "in memory")
+	reloaded, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	check(reloaded, "after reload")
+}
@@ -0,0 +1,134 @@
+package flexdb
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Aggregate summarises a group of entities. Sum, Min, Max and Avg are
+// computed over the field passed to GroupedQuery.Aggregate and ignore
+// entities whose value is missing or not numeric. DecimalSum is the exact
+// sum of the values rounded to cents, for money fields.
+type Aggregate struct {
+	Count      int
+	Sum        float64
+	Min        float64
+	Max        float64
+	Avg        float64
+	DecimalSum Decimal
+}
+
+// Group is one result of a grouped query
+type Group struct {
+	Key       interface{}
+	Aggregate Aggregate
+	Entities  []Entity
+}
+
+// GroupedQuery groups the results of a query by a field
+type GroupedQuery struct {
+	query    *Query
+	field    string
+	aggField string
+	having   []func(key interface{}, agg Aggregate) bool
+}
+
+// GroupBy groups the query results by the value of field. Entities without the field are grouped under a nil key.
+func (q *Query) GroupBy(field string) *GroupedQuery {
+	return &GroupedQuery{query: q, field: field}
+}
+
+// Aggregate sets the numeric field summarised in each group's Aggregate
+func (g *GroupedQuery) Aggregate(field string) *GroupedQuery {
+	g.aggField = field
+	return g
+}
+
+// Having keeps only the groups for which fn returns true, after aggregation
+func (g *GroupedQuery) Having(fn func(key interface{}, agg Aggregate) bool) *GroupedQuery {
+	g.having = append(g.having, fn)
+	return g
+}
+
+// Execute runs the query and returns its groups ordered by key
+func (g *GroupedQuery) Execute() ([]Group, error) {
+	entities, err := g.query.Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]*Group)
+	var groups []*Group
+	for _, entity := range entities {
+		key, _ := getField(entity, g.field)
+		// Group on the printed value so that unhashable keys such as maps still work
+		k := fmt.Sprintf("%T:%v", key, key)
+		group, ok := byKey[k]
+		if !ok {
+			group = &Group{Key: key}
+			byKey[k] = group
+			groups = append(groups, group)
+		}
+		group.Entities = append(group.Entities, entity)
+	}
+
+	var results []Group
+	err = safeCall("group having", func() error {
+		for _, group := range groups {
+			group.Aggregate = g.aggregate(group.Entities)
+			keep := true
+			for _, fn := range g.having {
+				if !fn(group.Key, group.Aggregate) {
+					keep = false
+					break
+				}
+			}
+			if keep {
+				results = append(results, *group)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return orderValues(results[i].Key, results[j].Key) < 0
+	})
+	return results, nil
+}
+
+// aggregate computes the summary of a group's entities
+func (g *GroupedQuery) aggregate(entities []Entity) Aggregate {
+	agg := Aggregate{Count: len(entities)}
+	if g.aggField == "" {
+		return agg
+	}
+	n := 0
+	for _, entity := range entities {
+		v, ok := getField(entity, g.aggField)
+		if !ok {
+			continue
+		}
+		f, ok := toFloat64(v)
+		if !ok {
+			continue
+		}
+		if n == 0 || f < agg.Min {
+			agg.Min = f
+		}
+		if n == 0 || f > agg.Max {
+			agg.Max = f
+		}
+		agg.Sum += f
+		if d, ok := toDecimal(v); ok {
+			agg.DecimalSum += d
+		}
+		n++
+	}
+	if n > 0 {
+		agg.Avg = agg.Sum / float64(n)
+	}
+	return agg
+}
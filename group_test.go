@@ -0,0 +1,70 @@
+package flexdb
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestGroupByHaving(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	statuses := map[string]int{"open": 12, "closed": 3, "pending": 11}
+	n := 0
+	for status, count := range statuses {
+		for i := 0; i < count; i++ {
+			n++
+			tx.Set("order", &OrderEntity{ID: strconv.Itoa(n), UserID: "u", Status: status})
+		}
+	}
+	tx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	groups, err := readTx.NewQuery("order").
+		GroupBy("Status").
+		Having(func(key interface{}, agg Aggregate) bool { return agg.Count > 10 }).
+		Execute()
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups above the threshold, got %d", len(groups))
+	}
+	if groups[0].Key != "open" || groups[0].Aggregate.Count != 12 || len(groups[0].Entities) != 12 {
+		t.Errorf("Unexpected first group: key=%v count=%d", groups[0].Key, groups[0].Aggregate.Count)
+	}
+	if groups[1].Key != "pending" || groups[1].Aggregate.Count != 11 {
+		t.Errorf("Unexpected second group: key=%v count=%d", groups[1].Key, groups[1].Aggregate.Count)
+	}
+}
+
+func TestGroupByAggregate(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "a", Value: 10})
+	tx.Set("test", &TestEntity{ID: "2", Name: "a", Value: 30})
+	tx.Set("test", &TestEntity{ID: "3", Name: "b", Value: 5})
+	tx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	groups, _ := readTx.NewQuery("test").GroupBy("Name").Aggregate("Value").
+		Having(func(key interface{}, agg Aggregate) bool { return agg.Sum >= 40 }).
+		Execute()
+	if len(groups) != 1 {
+		t.Fatalf("Expected 1 group, got %d", len(groups))
+	}
+	agg := groups[0].Aggregate
+	if agg.Count != 2 || agg.Sum != 40 || agg.Min != 10 || agg.Max != 30 || agg.Avg != 20 {
+		t.Errorf("Unexpected aggregate: %+v", agg)
+	}
+}
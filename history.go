@@ -0,0 +1,159 @@
+package flexdb
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// HistoryEntry records a single committed version of an entity
+type HistoryEntry struct {
+	ID        string
+	EntityID  string
+	Version   int
+	Timestamp time.Time
+	Deleted   bool
+	Entity    Entity
+}
+
+func (he *HistoryEntry) GetID() string   { return he.ID }
+func (he *HistoryEntry) SetID(id string) { he.ID = id }
+
+// historyType returns the name of the collection holding the history of an entity type
+func historyType(entityType string) string {
+	return "history:" + entityType
+}
+
+// EnableHistory records every committed Set and Delete of the entity type so
+// earlier versions can be read back with GetVersion
+func (db *Database) EnableHistory(entityType string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c := db.collectionFor(entityType)
+	c.history = true
+}
+
+// SetHistoryLimit keeps at most maxVersions history entries per entity,
+// pruning the oldest on write. A limit of zero or less keeps every version.
+func (db *Database) SetHistoryLimit(entityType string, maxVersions int) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.collectionFor(entityType).historyLimit = maxVersions
+}
+
+// appendHistory adds a version of an entity to its history collection. The caller must hold the write lock.
+func (db *Database) appendHistory(entityType, id string, entity Entity, at time.Time) {
+	hType := historyType(entityType)
+	if db.data[hType] == nil {
+		db.data[hType] = make(map[string]Entity)
+	}
+	c := db.collectionFor(entityType)
+	if c.versions == nil {
+		c.versions = make(map[string][]int)
+	}
+
+	versions := c.versions[id]
+	version := 1
+	if len(versions) > 0 {
+		version = versions[len(versions)-1] + 1
+	}
+
+	entry := &HistoryEntry{
+		ID:        historyID(id, version),
+		EntityID:  id,
+		Version:   version,
+		Timestamp: at,
+		Deleted:   entity == nil,
+	}
+	if entity != nil {
+		entry.Entity = copyEntity(entity)
+	}
+	db.data[hType][entry.ID] = entry
+	versions = append(versions, version)
+
+	if c.historyLimit > 0 && len(versions) > c.historyLimit {
+		pruned := len(versions) - c.historyLimit
+		for _, v := range versions[:pruned] {
+			delete(db.data[hType], historyID(id, v))
+			db.cache.Delete(getCacheKey(hType, historyID(id, v)))
+		}
+		versions = versions[pruned:]
+	}
+	c.versions[id] = versions
+}
+
+// historyID returns the ID of the history record of one version of an entity
+func historyID(id string, version int) string {
+	return fmt.Sprintf("%s@%d", id, version)
+}
+
+// indexHistory rebuilds the version index of an entity type from its history
+// collection. The caller must hold the write lock.
+func (db *Database) indexHistory(entityType string) {
+	versions := make(map[string][]int)
+	for _, e := range db.data[historyType(entityType)] {
+		if entry, ok := historyEntryFrom(e); ok {
+			versions[entry.EntityID] = append(versions[entry.EntityID], entry.Version)
+		}
+	}
+	for _, v := range versions {
+		sort.Ints(v)
+	}
+	db.collectionFor(entityType).versions = versions
+}
+
+// historyEntryFrom converts a stored history record, which is a GenericEntity
+// once loaded from disk, back into a HistoryEntry
+func historyEntryFrom(e Entity) (*HistoryEntry, bool) {
+	switch entity := e.(type) {
+	case *HistoryEntry:
+		return entity, true
+	case *GenericEntity:
+		entry := &HistoryEntry{ID: entity.ID}
+		entry.EntityID, _ = entity.Fields["EntityID"].(string)
+		if version, ok := toFloat64(entity.Fields["Version"]); ok {
+			entry.Version = int(version)
+		}
+		if ts, ok := entity.Fields["Timestamp"].(string); ok {
+			parsed, err := time.Parse(time.RFC3339Nano, ts)
+			if err != nil {
+				return nil, false
+			}
+			entry.Timestamp = parsed
+		}
+		entry.Deleted, _ = entity.Fields["Deleted"].(bool)
+		if fields, ok := entity.Fields["Entity"].(map[string]interface{}); ok {
+			entry.Entity = &GenericEntity{ID: entry.EntityID, Fields: fields}
+		}
+		return entry, true
+	}
+	return nil, false
+}
+
+// GetVersion returns an entity as it was committed at the given point in time.
+// History must be enabled for the entity type.
+func (tx *Transaction) GetVersion(entityType, id string, at time.Time) (Entity, bool) {
+	entityType = tx.db.typeName(entityType)
+
+	tx.db.mu.RLock()
+	defer tx.db.mu.RUnlock()
+
+	c := tx.db.collections[entityType]
+	if c == nil {
+		return nil, false
+	}
+	versions := c.versions[id]
+	for i := len(versions) - 1; i >= 0; i-- {
+		entry, ok := historyEntryFrom(tx.db.data[historyType(entityType)][historyID(id, versions[i])])
+		if !ok || entry.Timestamp.After(at) {
+			continue
+		}
+		if entry.Deleted {
+			return nil, false
+		}
+		return entry.Entity, true
+	}
+	return nil, false
+}
@@ -0,0 +1,159 @@
+package flexdb
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.EnableHistory("test")
+
+	writeTx := db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "1", Name: "First", Value: 1})
+	writeTx.Commit()
+	afterFirst := time.Now()
+
+	writeTx = db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "1", Name: "Second", Value: 2})
+	writeTx.Commit()
+	afterSecond := time.Now()
+
+	writeTx = db.Transact(false)
+	writeTx.Delete("test", "1")
+	writeTx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	entity, ok := readTx.GetVersion("test", "1", afterFirst)
+	if !ok || entity.(*TestEntity).Name != "First" {
+		t.Errorf("Expected first version, got %v", entity)
+	}
+
+	entity, ok = readTx.GetVersion("test", "1", afterSecond)
+	if !ok || entity.(*TestEntity).Name != "Second" {
+		t.Errorf("Expected second version, got %v", entity)
+	}
+
+	if _, ok := readTx.GetVersion("test", "1", time.Now()); ok {
+		t.Error("Expected entity to be absent after delete")
+	}
+
+	if _, ok := readTx.GetVersion("test", "1", afterFirst.Add(-time.Hour)); ok {
+		t.Error("Expected no version before the entity was created")
+	}
+
+	// History survives a reload
+	reloaded, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reload database: %v", err)
+	}
+	reloadTx := reloaded.Transact(true)
+	defer reloadTx.Rollback()
+
+	entity, ok = reloadTx.GetVersion("test", "1", afterFirst)
+	if !ok {
+		t.Fatal("Expected first version after reload")
+	}
+	if name, _ := getField(entity, "Name"); name != "First" {
+		t.Errorf("Expected first version after reload, got %v", entity)
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.EnableHistory("test")
+	db.SetHistoryLimit("test", 3)
+
+	for i := 1; i <= 5; i++ {
+		tx := db.Transact(false)
+		tx.Set("test", &TestEntity{ID: "1", Value: i})
+		tx.Commit()
+	}
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	entries := readTx.GetAll(historyType("test"))
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 history entries, got %d", len(entries))
+	}
+	for _, e := range entries {
+		entry, _ := historyEntryFrom(e)
+		if entry.Version < 3 {
+			t.Errorf("Expected versions 1 and 2 to be pruned, found version %d", entry.Version)
+		}
+	}
+}
+
+func TestHistoryIndexAfterReloadAndFailedSave(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.EnableHistory("test")
+	for i := 1; i <= 2; i++ {
+		tx := db.Transact(false)
+		tx.Set("test", &TestEntity{ID: "1", Value: i})
+		tx.Commit()
+	}
+
+	// Versions continue from the stored history after a reload
+	storage := &slowStorage{files: make(map[string][]byte)}
+	reloaded, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	reloaded.EnableHistory("test")
+	reloaded.SetHistoryLimit("test", 2)
+	reloaded.storage = storage
+	tx := reloaded.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Value: 3})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	readTx := reloaded.Transact(true)
+	if _, ok := readTx.Get(historyType("test"), "1@1"); ok {
+		t.Error("Expected version 1 to be pruned")
+	}
+	if _, ok := readTx.Get(historyType("test"), "1@3"); !ok {
+		t.Error("Expected the new version to be numbered 3")
+	}
+	readTx.Rollback()
+
+	// A failed save leaves the version index as it was
+	storage.writeErr = errors.New("disk full")
+	tx = reloaded.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Value: 4})
+	if err := tx.Commit(); err == nil {
+		t.Fatal("Expected the commit to fail")
+	}
+	storage.writeErr = nil
+	tx = reloaded.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Value: 4})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	readTx = reloaded.Transact(true)
+	defer readTx.Rollback()
+	if _, ok := readTx.Get(historyType("test"), "1@4"); !ok {
+		t.Error("Expected the version after the failed commit to be numbered 4")
+	}
+	if _, ok := readTx.Get(historyType("test"), "1@2"); ok {
+		t.Error("Expected version 2 to be pruned")
+	}
+	entity, ok := readTx.GetVersion("test", "1", time.Now())
+	if !ok || entity.(*TestEntity).Value != 4 {
+		t.Errorf("Expected the latest version to hold 4, got %v", entity)
+	}
+}
@@ -0,0 +1,150 @@
+package flexdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MergeStrategy decides what ImportMerge does when a record exists in both databases
+type MergeStrategy int
+
+const (
+	// MergeSkip keeps the existing record
+	MergeSkip MergeStrategy = iota
+	// MergeOverwrite replaces the existing record with the imported one
+	MergeOverwrite
+	// MergeNewerWins keeps whichever record has the later UpdatedAt. Records
+	// without a comparable UpdatedAt are left as they are.
+	MergeNewerWins
+)
+
+// ImportMerge reads another database file and upserts its records into this
+// database in a single transaction, resolving conflicting ids with strategy.
+// Records go through the usual Set path, so hooks, validation and indexes
+// apply. The other file is read through this database's Storage and I/O
+// timeout. Its migration versions are not imported.
+func (db *Database) ImportMerge(path string, strategy MergeStrategy) error {
+	if err := db.statStorage(path); err != nil {
+		return err
+	}
+	opts := []Option{WithStorage(db.storage), WithIOTimeout(db.ioTimeout)}
+	if db.codec != nil {
+		opts = append(opts, WithCodec(db.codec))
+	}
+	source, err := NewDatabase(path, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	entityTypes := make([]string, 0, len(source.data))
+	for entityType := range source.data {
+		if entityType != migrationVersionType("") && !strings.HasPrefix(entityType, migrationVersionType("")+":") {
+			entityTypes = append(entityTypes, entityType)
+		}
+	}
+	sort.Strings(entityTypes)
+
+	tx := db.Transact(false)
+	for _, entityType := range entityTypes {
+		ids := make([]string, 0, len(source.data[entityType]))
+		for id := range source.data[entityType] {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		for _, id := range ids {
+			incoming := source.data[entityType][id]
+			if existing, ok := tx.lookup(entityType, id); ok && !incomingWins(existing, incoming, strategy) {
+				continue
+			}
+			if err := tx.Set(entityType, incoming); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to import %s %s: %w", entityType, id, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// incomingWins reports whether an imported record should replace an existing one
+func incomingWins(existing, incoming Entity, strategy MergeStrategy) bool {
+	switch strategy {
+	case MergeOverwrite:
+		return true
+	case MergeNewerWins:
+		current, ok := getField(existing, "UpdatedAt")
+		if !ok {
+			return false
+		}
+		candidate, ok := getField(incoming, "UpdatedAt")
+		if !ok {
+			return false
+		}
+		c, ok := compareValues(candidate, current)
+		return ok && c > 0
+	}
+	return false
+}
+
+// ImportOptions controls how ImportBatch handles records that fail to import
+type ImportOptions struct {
+	// ContinueOnError skips failing records and imports the rest. Without it
+	// the first failure undoes the whole batch.
+	ContinueOnError bool
+}
+
+// ImportFailure is a record ImportBatch could not write
+type ImportFailure struct {
+	// Index is the position of the record in the batch
+	Index int
+	ID    string
+	Err   error
+}
+
+// ImportReport summarises an ImportBatch call
+type ImportReport struct {
+	Imported int
+	Failed   []ImportFailure
+}
+
+// ImportBatch writes each entity with Set, so hooks, validation, unique and
+// relation checks apply, and reports the records that failed. With
+// opts.ContinueOnError every pending change a failed record made, including
+// those of its hooks, is undone and the rest of the batch is still written,
+// ready to be committed with the transaction; otherwise the first failure
+// restores the pending changes to what they were before the call and is
+// returned as an error.
+func (tx *Transaction) ImportBatch(entityType string, entities []Entity, opts ImportOptions) (ImportReport, error) {
+	var report ImportReport
+	if tx.readOnly {
+		return report, fmt.Errorf("cannot modify data in a read-only transaction")
+	}
+	entityType = tx.db.typeName(entityType)
+
+	batch := tx.savepoint()
+	for i, entity := range entities {
+		record := tx.savepoint()
+		err := tx.Set(entityType, entity)
+		if err == nil {
+			tx.release(record)
+			report.Imported++
+			continue
+		}
+		// A post-set hook can fail after changes were recorded
+		tx.rollbackTo(record)
+
+		var id string
+		if !isNilEntity(entity) {
+			id = entity.GetID()
+		}
+		report.Failed = append(report.Failed, ImportFailure{Index: i, ID: id, Err: err})
+		if !opts.ContinueOnError {
+			tx.rollbackTo(batch)
+			report.Imported = 0
+			return report, fmt.Errorf("failed to import %s %s: %w", entityType, id, err)
+		}
+	}
+	tx.release(batch)
+	return report, nil
+}
@@ -0,0 +1,171 @@
+package flexdb
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestImportMerge(t *testing.T) {
+	dbPath := "./test_db.json"
+	sourcePath := "./test_import.json"
+	defer os.Remove(dbPath)
+	defer os.Remove(sourcePath)
+
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(24 * time.Hour)
+
+	source, _ := NewDatabase(sourcePath)
+	tx := source.Transact(false)
+	tx.Set("user", &UserEntity{ID: "stale", Email: "stale@import", UpdatedAt: older})
+	tx.Set("user", &UserEntity{ID: "fresh", Email: "fresh@import", UpdatedAt: newer})
+	tx.Set("user", &UserEntity{ID: "only-import", Email: "new@import", UpdatedAt: newer})
+	tx.Commit()
+
+	tests := []struct {
+		name     string
+		strategy MergeStrategy
+		stale    string
+		fresh    string
+	}{
+		{"skip", MergeSkip, "stale@local", "fresh@local"},
+		{"overwrite", MergeOverwrite, "stale@import", "fresh@import"},
+		{"newer wins", MergeNewerWins, "stale@local", "fresh@import"},
+	}
+
+	for _, tt := range tests {
+		os.Remove(dbPath)
+		db, _ := NewDatabase(dbPath)
+		tx := db.Transact(false)
+		tx.Set("user", &UserEntity{ID: "stale", Email: "stale@local", UpdatedAt: newer})
+		tx.Set("user", &UserEntity{ID: "fresh", Email: "fresh@local", UpdatedAt: older})
+		tx.Commit()
+
+		if err := db.ImportMerge(sourcePath, tt.strategy); err != nil {
+			t.Fatalf("%s: ImportMerge failed: %v", tt.name, err)
+		}
+
+		readTx := db.Transact(true)
+		for id, want := range map[string]string{"stale": tt.stale, "fresh": tt.fresh, "only-import": "new@import"} {
+			entity, ok := readTx.Get("user", id)
+			if !ok {
+				t.Errorf("%s: expected %s to exist", tt.name, id)
+				continue
+			}
+			if email, _ := getField(entity, "Email"); email != want {
+				t.Errorf("%s: expected %s email %s, got %v", tt.name, id, want, email)
+			}
+		}
+		readTx.Rollback()
+	}
+
+	db, _ := NewDatabase(dbPath)
+	if err := db.ImportMerge("./missing.json", MergeSkip); err == nil {
+		t.Error("Expected an error importing a missing file")
+	}
+}
+
+func TestImportBatch(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.Configure("users", CollectionConfig{Unique: []string{"Email"}})
+
+	tx := db.Transact(false)
+	tx.Set("users", &UserEntity{ID: "existing", Email: "taken@example.com"})
+	tx.Commit()
+
+	batch := []Entity{
+		&UserEntity{ID: "1", Email: "one@example.com"},
+		&UserEntity{ID: "2", Email: "taken@example.com"},
+		&UserEntity{ID: "3", Email: "three@example.com"},
+	}
+
+	// Without ContinueOnError the duplicate undoes the whole batch
+	tx = db.Transact(false)
+	report, err := tx.ImportBatch("users", batch, ImportOptions{})
+	if !errors.Is(err, ErrUniqueViolation) {
+		t.Fatalf("Expected a unique violation, got %v", err)
+	}
+	if report.Imported != 0 || len(report.Failed) != 1 || tx.Count("users") != 1 {
+		t.Errorf("Expected nothing staged after an aborted batch, got %+v", report)
+	}
+	tx.Rollback()
+
+	tx = db.Transact(false)
+	report, err = tx.ImportBatch("users", batch, ImportOptions{ContinueOnError: true})
+	if err != nil {
+		t.Fatalf("ImportBatch failed: %v", err)
+	}
+	if report.Imported != 2 || len(report.Failed) != 1 {
+		t.Fatalf("Expected 2 imported and 1 failed, got %+v", report)
+	}
+	failure := report.Failed[0]
+	if failure.Index != 1 || failure.ID != "2" || !errors.Is(failure.Err, ErrUniqueViolation) {
+		t.Errorf("Expected record 2 flagged as a duplicate, got %+v", failure)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+	if count := readTx.Count("users"); count != 3 {
+		t.Errorf("Expected the successes to commit, got %d users", count)
+	}
+	if _, ok := readTx.Get("users", "2"); ok {
+		t.Error("Expected the duplicate not to be committed")
+	}
+}
+
+func TestImportBatchDiscardsHookWrites(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.RegisterDerivedCollection("user_by_email", "users", func(e Entity) (string, Entity, bool) {
+		user := e.(*UserEntity)
+		return user.Email, &GenericEntity{Fields: map[string]interface{}{"userID": user.ID}}, true
+	})
+	// Rejects a record after the derived write has been staged
+	rejected := errors.New("rejected")
+	db.RegisterHookV2("post-set", func(tx *Transaction, ev HookEvent) error {
+		if ev.EntityType == "users" && ev.New.(*UserEntity).Status == "banned" {
+			return rejected
+		}
+		return nil
+	})
+
+	batch := []Entity{
+		&UserEntity{ID: "1", Email: "one@example.com"},
+		&UserEntity{ID: "2", Email: "two@example.com", Status: "banned"},
+	}
+
+	tx := db.Transact(false)
+	report, err := tx.ImportBatch("users", batch, ImportOptions{ContinueOnError: true})
+	if err != nil {
+		t.Fatalf("ImportBatch failed: %v", err)
+	}
+	if report.Imported != 1 || len(report.Failed) != 1 || !errors.Is(report.Failed[0].Err, rejected) {
+		t.Fatalf("Expected 1 imported and 1 rejected, got %+v", report)
+	}
+	if _, ok := tx.Get("user_by_email", "two@example.com"); ok {
+		t.Error("Expected the rejected record's derived write to be discarded")
+	}
+	if _, ok := tx.Get("user_by_email", "one@example.com"); !ok {
+		t.Error("Expected the imported record's derived write to stay")
+	}
+	tx.Rollback()
+
+	// Without ContinueOnError the hook writes of the whole batch are discarded
+	tx = db.Transact(false)
+	defer tx.Rollback()
+	if _, err := tx.ImportBatch("users", batch, ImportOptions{}); !errors.Is(err, rejected) {
+		t.Fatalf("Expected the rejection, got %v", err)
+	}
+	if count := tx.Count("user_by_email"); count != 0 {
+		t.Errorf("Expected no derived records after an aborted batch, got %d", count)
+	}
+}
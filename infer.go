@@ -0,0 +1,142 @@
+package flexdb
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// JSON kinds reported by InferSchema
+const (
+	KindString = "string"
+	KindNumber = "number"
+	KindBool   = "bool"
+	KindObject = "object"
+	KindArray  = "array"
+	KindNull   = "null"
+)
+
+// InferredSchema describes the fields observed across an entity type
+type InferredSchema struct {
+	EntityType string
+	// Sampled is the number of entities inspected
+	Sampled int
+	// Fields lists every observed field, ordered by name
+	Fields []InferredField
+}
+
+// InferredField describes one field as seen in the stored JSON
+type InferredField struct {
+	Name string
+	// Kinds lists the JSON kinds the field was seen with, sorted
+	Kinds []string
+	// Present is the number of entities that have the field
+	Present int
+	// Nulls is the number of entities where the field is null
+	Nulls int
+	// NullFrequency is Nulls divided by the number of entities sampled
+	NullFrequency float64
+	// Type is a suggested SetFieldType declaration, empty when the field
+	// was seen with more than one non-null kind or is always null
+	Type FieldType
+}
+
+// InferSchema inspects the committed entities of a type in their JSON form
+// and reports each field with the kinds it holds and how often it is null.
+// The result can seed SetFieldType declarations for an existing file.
+func (db *Database) InferSchema(entityType string) InferredSchema {
+	entities := db.GetAll(entityType)
+	schema := InferredSchema{EntityType: db.typeName(entityType), Sampled: len(entities)}
+
+	type observed struct {
+		kinds   map[string]bool
+		present int
+		nulls   int
+		dates   int
+	}
+	fields := make(map[string]*observed)
+	for _, entity := range entities {
+		raw, err := json.Marshal(entity)
+		if err != nil {
+			continue
+		}
+		var doc map[string]interface{}
+		if err := decodeJSON(raw, &doc); err != nil {
+			continue
+		}
+		for name, value := range doc {
+			o := fields[name]
+			if o == nil {
+				o = &observed{kinds: make(map[string]bool)}
+				fields[name] = o
+			}
+			o.present++
+			kind := jsonKind(value)
+			o.kinds[kind] = true
+			if kind == KindNull {
+				o.nulls++
+			}
+			if _, ok := toTime(value); ok {
+				o.dates++
+			}
+		}
+	}
+
+	for name, o := range fields {
+		field := InferredField{Name: name, Present: o.present, Nulls: o.nulls}
+		for kind := range o.kinds {
+			field.Kinds = append(field.Kinds, kind)
+		}
+		sort.Strings(field.Kinds)
+		if schema.Sampled > 0 {
+			field.NullFrequency = float64(o.nulls) / float64(schema.Sampled)
+		}
+		field.Type = suggestFieldType(o.kinds, o.dates == o.present-o.nulls)
+		schema.Fields = append(schema.Fields, field)
+	}
+	sort.Slice(schema.Fields, func(i, j int) bool { return schema.Fields[i].Name < schema.Fields[j].Name })
+	return schema
+}
+
+// jsonKind returns the JSON kind of a decoded value
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return KindNull
+	case string:
+		return KindString
+	case bool:
+		return KindBool
+	case map[string]interface{}:
+		return KindObject
+	case []interface{}:
+		return KindArray
+	}
+	return KindNumber
+}
+
+// suggestFieldType maps the single non-null kind of a field to a FieldType.
+// Strings that always parse as RFC 3339 times are suggested as dates.
+func suggestFieldType(kinds map[string]bool, allDates bool) FieldType {
+	var only string
+	for kind := range kinds {
+		if kind == KindNull {
+			continue
+		}
+		if only != "" {
+			return ""
+		}
+		only = kind
+	}
+	switch only {
+	case KindString:
+		if allDates {
+			return FieldDate
+		}
+		return FieldString
+	case KindNumber:
+		return FieldNumber
+	case KindBool:
+		return FieldBool
+	}
+	return ""
+}
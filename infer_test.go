@@ -0,0 +1,44 @@
+package flexdb
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInferSchema(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("item", &GenericEntity{ID: "1", Fields: map[string]interface{}{
+		"name": "widget", "price": 9.5, "tags": []interface{}{"a"}, "added": time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	}})
+	tx.Set("item", &GenericEntity{ID: "2", Fields: map[string]interface{}{
+		"name": "gadget", "price": "free", "tags": nil, "meta": map[string]interface{}{"color": "red"},
+	}})
+	tx.Set("item", &GenericEntity{ID: "3", Fields: map[string]interface{}{
+		"name": "doohickey", "price": 3, "active": true,
+	}})
+	tx.Commit()
+
+	schema := db.InferSchema("item")
+	if schema.Sampled != 3 {
+		t.Fatalf("Expected 3 entities sampled, got %d", schema.Sampled)
+	}
+
+	want := []InferredField{
+		{Name: "ID", Kinds: []string{KindString}, Present: 3, Type: FieldString},
+		{Name: "active", Kinds: []string{KindBool}, Present: 1, Type: FieldBool},
+		{Name: "added", Kinds: []string{KindString}, Present: 1, Type: FieldDate},
+		{Name: "meta", Kinds: []string{KindObject}, Present: 1},
+		{Name: "name", Kinds: []string{KindString}, Present: 3, Type: FieldString},
+		{Name: "price", Kinds: []string{KindNumber, KindString}, Present: 3},
+		{Name: "tags", Kinds: []string{KindArray, KindNull}, Present: 2, Nulls: 1, NullFrequency: 1.0 / 3},
+	}
+	if !reflect.DeepEqual(schema.Fields, want) {
+		t.Errorf("Unexpected inferred fields:\n got %+v\nwant %+v", schema.Fields, want)
+	}
+}
@@ -0,0 +1,61 @@
+package flexdb
+
+import "time"
+
+// SetLoader registers a function that computes entities of a type on demand.
+// When Get misses, the loader is called and a found entity is committed like
+// any other write, with history, change events and replication, so later
+// reads are served from the database.
+func (db *Database) SetLoader(entityType string, load func(id string) (Entity, bool, error)) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.collectionFor(entityType).loader = load
+}
+
+// loadThrough calls the loader for a missing entity and stores the result
+func (db *Database) loadThrough(entityType, id string, load func(id string) (Entity, bool, error)) (Entity, bool) {
+	var entity Entity
+	var found bool
+	err := safeCall("loader", func() error {
+		var err error
+		entity, found, err = load(id)
+		return err
+	})
+	if err != nil || !found || isNilEntity(entity) {
+		return nil, false
+	}
+
+	stored, events, metrics, err := db.commitLoaded(entityType, id, entity)
+	if err != nil {
+		return nil, false
+	}
+	if events == nil {
+		return stored, true
+	}
+
+	// Notify watchers once the write lock has been released
+	db.publish(events)
+	db.notifyCommit(metrics)
+	return stored, true
+}
+
+// commitLoaded commits a loaded entity through the normal commit path, so it
+// gets history, change events and replication like any other write. A failed
+// commit leaves memory as it was.
+func (db *Database) commitLoaded(entityType, id string, entity Entity) (Entity, []ChangeEvent, CommitMetrics, error) {
+	start := time.Now()
+	db.lockForWrite()
+	defer db.mu.Unlock()
+
+	// Another reader may have loaded the entity while the loader ran
+	if existing, ok := db.data[entityType][id]; ok {
+		return existing, nil, CommitMetrics{}, nil
+	}
+	defer func() { db.stats.committed(time.Since(start)) }()
+
+	tx := db.snapshotTx()
+	tx.readOnly = false
+	events, metrics, err := tx.applyLocked(map[string]map[string]Entity{entityType: {id: entity}}, start)
+	return entity, events, metrics, err
+}
@@ -0,0 +1,160 @@
+package flexdb
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLoader(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	calls := 0
+	db.SetLoader("test", func(id string) (Entity, bool, error) {
+		calls++
+		if id == "absent" {
+			return nil, false, nil
+		}
+		return &TestEntity{ID: id, Name: "Loaded " + id, Value: 1}, true, nil
+	})
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	entity, ok := readTx.Get("test", "1")
+	if !ok || entity.(*TestEntity).Name != "Loaded 1" {
+		t.Fatalf("Expected loader to provide entity, got %v", entity)
+	}
+	if _, ok := readTx.Get("test", "1"); !ok || calls != 1 {
+		t.Errorf("Expected second read to be served from storage, loader called %d times", calls)
+	}
+
+	if _, ok := readTx.Get("test", "absent"); ok {
+		t.Error("Expected absent entity to stay missing")
+	}
+
+	// Loaded entities are persisted
+	reloaded, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reload database: %v", err)
+	}
+	reloadTx := reloaded.Transact(true)
+	defer reloadTx.Rollback()
+	if _, ok := reloadTx.Get("test", "1"); !ok {
+		t.Error("Loaded entity was not persisted")
+	}
+}
+
+func TestLoaderNotUsedByWriteChecks(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	calls := 0
+	loader := func(id string) (Entity, bool, error) {
+		calls++
+		return &TestEntity{ID: id, Name: "Loaded " + id}, true, nil
+	}
+	db.SetLoader("test", loader)
+	db.SetLoader("log", loader)
+	db.SetAppendOnly("log")
+
+	tx := db.Transact(false)
+	if err := tx.Set("log", &TestEntity{ID: "new", Name: "Appended"}); err != nil {
+		t.Errorf("Expected a new id in an append-only type to be accepted, got %v", err)
+	}
+	tx.Set("test", &TestEntity{ID: "a", Name: "Renamed"})
+	if err := tx.Rename("test", "a", "b"); err != nil {
+		t.Errorf("Expected rename to a free id to succeed, got %v", err)
+	}
+	if err := tx.Upsert("test", &TestEntity{ID: "c", Name: "Inserted"}, func(existing, incoming Entity) Entity {
+		t.Error("Expected no existing entity to merge with")
+		return incoming
+	}); err != nil {
+		t.Errorf("Upsert failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("Expected write checks not to call the loader, called %d times", calls)
+	}
+}
+
+func TestLoaderFailedSaveLeavesMemoryUnchanged(t *testing.T) {
+	storage := &slowStorage{files: make(map[string][]byte)}
+	db, _ := NewDatabase("memory.json", WithStorage(storage))
+	db.AddIndex("test", "Name")
+	db.SetLoader("test", func(id string) (Entity, bool, error) {
+		return &TestEntity{ID: id, Name: "Loaded"}, true, nil
+	})
+
+	storage.writeErr = errors.New("disk full")
+	readTx := db.Transact(true)
+	if _, ok := readTx.Get("test", "x"); ok {
+		t.Error("Expected Get to miss when the loaded entity cannot be saved")
+	}
+	readTx.Rollback()
+	if _, ok := db.data["test"]["x"]; ok {
+		t.Error("Expected the failed load to be dropped from memory")
+	}
+	if _, found := db.cache.Get(getCacheKey("test", "x")); found {
+		t.Error("Expected the failed load not to be cached")
+	}
+	if ids := db.IndexEntries("test", "Name")["Loaded"]; len(ids) != 0 {
+		t.Errorf("Expected the failed load not to be indexed, got %v", ids)
+	}
+
+	// The next successful save does not persist it either
+	storage.writeErr = nil
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "y", Name: "Stored"})
+	tx.Commit()
+	reloaded, _ := NewDatabase("memory.json", WithStorage(storage))
+	if _, ok := reloaded.data["test"]["x"]; ok {
+		t.Error("Expected the failed load to stay off disk")
+	}
+}
+
+func TestLoaderCommitsLikeWrites(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.EnableHistory("test")
+	var replicated []ChangeEvent
+	db.SetReplicationSink(func(changes []ChangeEvent) error {
+		replicated = append(replicated, changes...)
+		return nil
+	})
+	events := db.WatchType("test")
+	defer db.Unwatch(events)
+	db.SetLoader("test", func(id string) (Entity, bool, error) {
+		return &TestEntity{ID: id, Name: "Loaded " + id}, true, nil
+	})
+
+	if _, ok := db.Get("test", "1"); !ok {
+		t.Fatal("Expected loader to provide entity")
+	}
+
+	if len(replicated) != 1 || replicated[0].ID != "1" || replicated[0].Operation != OpSet {
+		t.Errorf("Expected the loaded entity to be replicated, got %v", replicated)
+	}
+	select {
+	case ev := <-events:
+		if ev.ID != "1" || ev.Operation != OpSet {
+			t.Errorf("Unexpected change event %v", ev)
+		}
+	default:
+		t.Error("Expected watchers to see the loaded entity")
+	}
+	tx := db.Transact(true)
+	defer tx.Rollback()
+	if version, ok := tx.GetVersion("test", "1", time.Now()); !ok || version.(*TestEntity).Name != "Loaded 1" {
+		t.Errorf("Expected the loaded entity to be recorded in history, got %v", version)
+	}
+}
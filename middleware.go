@@ -0,0 +1,47 @@
+package flexdb
+
+// TxFunc is a unit of work run inside a transaction
+type TxFunc func(tx *Transaction) error
+
+// Middleware wraps the execution of a transaction started by Do
+type Middleware func(next TxFunc) TxFunc
+
+// Use registers middleware around every transaction run with Do. Middleware
+// registered first is outermost.
+func (db *Database) Use(middleware Middleware) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.middleware = append(db.middleware, middleware)
+}
+
+// Do runs fn in a write transaction wrapped by the registered middleware.
+// The transaction is committed when fn returns nil and rolled back
+// otherwise. The commit happens inside the middleware chain, so middleware
+// observes its result. A panic in fn or in middleware rolls the transaction
+// back and is returned as an error wrapping ErrCallbackPanic; a panic in fn
+// reaches middleware as that error.
+func (db *Database) Do(fn TxFunc) error {
+	db.mu.RLock()
+	chain := append([]Middleware(nil), db.middleware...)
+	db.mu.RUnlock()
+
+	handler := func(tx *Transaction) error {
+		if err := safeCall("do", func() error { return fn(tx) }); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	tx := db.Transact(false)
+	err := safeCall("middleware", func() error {
+		for i := len(chain) - 1; i >= 0; i-- {
+			handler = chain[i](handler)
+		}
+		return handler(tx)
+	})
+	if !tx.closed {
+		tx.Rollback()
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package flexdb
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	var events []string
+	record := func(name string) Middleware {
+		return func(next TxFunc) TxFunc {
+			return func(tx *Transaction) error {
+				events = append(events, name+" start")
+				err := next(tx)
+				events = append(events, name+" end")
+				return err
+			}
+		}
+	}
+	db.Use(record("outer"))
+	db.Use(record("inner"))
+
+	err := db.Do(func(tx *Transaction) error {
+		events = append(events, "work")
+		return tx.Set("test", &TestEntity{ID: "1", Name: "Done"})
+	})
+	if err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+
+	want := []string{"outer start", "inner start", "work", "inner end", "outer end"}
+	if len(events) != len(want) {
+		t.Fatalf("Expected events %v, got %v", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("Expected events %v, got %v", want, events)
+			break
+		}
+	}
+
+	readTx := db.Transact(true)
+	if _, ok := readTx.Get("test", "1"); !ok {
+		t.Error("Expected Do to commit the transaction")
+	}
+	readTx.Rollback()
+
+	// A failing unit of work is rolled back
+	failure := errors.New("boom")
+	err = db.Do(func(tx *Transaction) error {
+		tx.Set("test", &TestEntity{ID: "2"})
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected Do to return the work's error, got %v", err)
+	}
+	readTx = db.Transact(true)
+	defer readTx.Rollback()
+	if _, ok := readTx.Get("test", "2"); ok {
+		t.Error("Expected failed work to be rolled back")
+	}
+	if stats := db.TxStats(); stats.OpenWriteTx != 0 {
+		t.Errorf("Expected no open write transactions, got %d", stats.OpenWriteTx)
+	}
+}
+
+func TestMiddlewarePanics(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	var seen error
+	db.Use(func(next TxFunc) TxFunc {
+		return func(tx *Transaction) error {
+			seen = next(tx)
+			return seen
+		}
+	})
+
+	// A panicking unit of work reaches middleware as an error and is rolled back
+	err := db.Do(func(tx *Transaction) error {
+		tx.Set("test", &TestEntity{ID: "1"})
+		panic("boom")
+	})
+	if !errors.Is(err, ErrCallbackPanic) {
+		t.Errorf("Expected ErrCallbackPanic, got %v", err)
+	}
+	if !errors.Is(seen, ErrCallbackPanic) {
+		t.Errorf("Expected middleware to observe the panic, got %v", seen)
+	}
+
+	// A panicking middleware rolls back too
+	db.Use(func(next TxFunc) TxFunc {
+		return func(tx *Transaction) error {
+			tx.Set("test", &TestEntity{ID: "2"})
+			panic("middleware")
+		}
+	})
+	err = db.Do(func(tx *Transaction) error { return nil })
+	if !errors.Is(err, ErrCallbackPanic) {
+		t.Errorf("Expected ErrCallbackPanic, got %v", err)
+	}
+
+	if stats := db.TxStats(); stats.OpenWriteTx != 0 {
+		t.Errorf("Expected no open write transactions, got %d", stats.OpenWriteTx)
+	}
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+	if _, ok := readTx.Get("test", "1"); ok {
+		t.Error("Expected panicking work to be rolled back")
+	}
+	if _, ok := readTx.Get("test", "2"); ok {
+		t.Error("Expected panicking middleware to be rolled back")
+	}
+}
@@ -0,0 +1,71 @@
+package flexdb
+
+// Namespaced scopes entity types under a prefix so several tenants can share one database
+type Namespaced struct {
+	db     *Database
+	prefix string
+}
+
+// Namespace returns a view of the database whose entity types are prefixed with prefix + "/"
+func (db *Database) Namespace(prefix string) *Namespaced {
+	return &Namespaced{db: db, prefix: prefix}
+}
+
+// Type returns the underlying entity type name for an entity type in the namespace
+func (n *Namespaced) Type(entityType string) string {
+	return n.prefix + "/" + entityType
+}
+
+// Transact starts a new transaction scoped to the namespace
+func (n *Namespaced) Transact(readOnly bool) *NamespacedTx {
+	return &NamespacedTx{tx: n.db.Transact(readOnly), ns: n}
+}
+
+// Get retrieves a committed entity from the namespace by type and ID
+func (n *Namespaced) Get(entityType, id string) (Entity, bool) {
+	tx := n.db.Transact(true)
+	defer tx.Rollback()
+	return tx.Get(n.Type(entityType), id)
+}
+
+// Query creates a query over the committed entities of a type in the namespace
+func (n *Namespaced) Query(entityType string) *Query {
+	return n.db.snapshotTx().NewQuery(n.Type(entityType))
+}
+
+// NamespacedTx is a transaction whose entity types are scoped to a namespace
+type NamespacedTx struct {
+	tx *Transaction
+	ns *Namespaced
+}
+
+// Commit applies the transaction changes
+func (ntx *NamespacedTx) Commit() error { return ntx.tx.Commit() }
+
+// Rollback discards the transaction changes
+func (ntx *NamespacedTx) Rollback() { ntx.tx.Rollback() }
+
+// Get retrieves an entity by type and ID
+func (ntx *NamespacedTx) Get(entityType, id string) (Entity, bool) {
+	return ntx.tx.Get(ntx.ns.Type(entityType), id)
+}
+
+// GetAll retrieves all entities of a given type
+func (ntx *NamespacedTx) GetAll(entityType string) []Entity {
+	return ntx.tx.GetAll(ntx.ns.Type(entityType))
+}
+
+// Set adds or updates an entity
+func (ntx *NamespacedTx) Set(entityType string, entity Entity) error {
+	return ntx.tx.Set(ntx.ns.Type(entityType), entity)
+}
+
+// Delete removes an entity
+func (ntx *NamespacedTx) Delete(entityType, id string) error {
+	return ntx.tx.Delete(ntx.ns.Type(entityType), id)
+}
+
+// NewQuery creates a new query for the given entity type
+func (ntx *NamespacedTx) NewQuery(entityType string) *Query {
+	return ntx.tx.NewQuery(ntx.ns.Type(entityType))
+}
@@ -0,0 +1,55 @@
+package flexdb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestNamespace(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	acme := db.Namespace("acme")
+	globex := db.Namespace("globex")
+
+	writeTx := acme.Transact(false)
+	writeTx.Set("user", &TestEntity{ID: "1", Name: "Acme user", Value: 1})
+	if err := writeTx.Commit(); err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+
+	writeTx = globex.Transact(false)
+	writeTx.Set("user", &TestEntity{ID: "2", Name: "Globex user", Value: 2})
+	if err := writeTx.Commit(); err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+
+	if entity, ok := acme.Get("user", "1"); !ok || entity.(*TestEntity).Name != "Acme user" {
+		t.Errorf("Expected acme user, got %v", entity)
+	}
+	if _, ok := acme.Get("user", "2"); ok {
+		t.Error("Globex user leaked into acme namespace")
+	}
+	if _, ok := globex.Get("user", "1"); ok {
+		t.Error("Acme user leaked into globex namespace")
+	}
+
+	results, err := globex.Query("user").Execute()
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 1 || results[0].GetID() != "2" {
+		t.Errorf("Unexpected globex query results: %v", results)
+	}
+
+	// Namespaced types are ordinary types in the underlying database
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+	if _, ok := readTx.Get("acme/user", "1"); !ok {
+		t.Error("Expected acme user under the prefixed type")
+	}
+	if _, ok := readTx.Get("user", "1"); ok {
+		t.Error("Namespaced entity visible under the unprefixed type")
+	}
+}
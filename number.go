@@ -0,0 +1,90 @@
+package flexdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+)
+
+// maxExactFloat is the largest integer magnitude float64 holds without loss
+const maxExactFloat = 1 << 53
+
+// decodeJSON unmarshals data keeping numbers as json.Number, then turns every
+// number float64 represents exactly back into a float64. Integers beyond 2^53
+// stay json.Number so big IDs and counters survive a reload unchanged.
+func decodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	normalizeNumbers(reflect.ValueOf(v))
+	return nil
+}
+
+// normalizeNumbers walks decoded maps and slices, replacing json.Number values
+// with float64 unless that would lose precision
+func normalizeNumbers(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			normalizeNumbers(v.Elem())
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			elem := v.MapIndex(key)
+			if n, ok := elem.Interface().(json.Number); ok {
+				v.SetMapIndex(key, reflect.ValueOf(numberValue(n)))
+				continue
+			}
+			normalizeNumbers(elem)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			if n, ok := elem.Interface().(json.Number); ok {
+				elem.Set(reflect.ValueOf(numberValue(n)))
+				continue
+			}
+			normalizeNumbers(elem)
+		}
+	}
+}
+
+// numberValue returns n as a float64, or n itself for integers too large for
+// float64 to hold exactly
+func numberValue(n json.Number) interface{} {
+	if i, err := n.Int64(); err == nil && (i > maxExactFloat || i < -maxExactFloat) {
+		return n
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return n
+}
+
+// toInt64 returns v as an int64 when it is an integer value that fits,
+// including json.Number integers
+func toInt64(v interface{}) (int64, bool) {
+	if n, ok := v.(json.Number); ok {
+		i, err := n.Int64()
+		return i, err == nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u <= 1<<63-1 {
+			return int64(u), true
+		}
+	}
+	return 0, false
+}
+
+// isJSONNumber reports whether either value is a json.Number
+func isJSONNumber(a, b interface{}) bool {
+	_, okA := a.(json.Number)
+	_, okB := b.(json.Number)
+	return okA || okB
+}
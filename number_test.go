@@ -0,0 +1,55 @@
+package flexdb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLargeIntegerPrecision(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	const big = int64(9007199254740993) // 2^53 + 1, not representable as float64
+
+	db, _ := NewDatabase(dbPath)
+	db.AddIndex("counter", "Value")
+	tx := db.Transact(false)
+	tx.Set("counter", &GenericEntity{ID: "c1", Fields: map[string]interface{}{
+		"Value":   big,
+		"History": []interface{}{big, 1},
+		"Small":   42,
+	}})
+	tx.Set("counter", &GenericEntity{ID: "c2", Fields: map[string]interface{}{"Value": big - 1}})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	reloaded, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	reloaded.AddIndex("counter", "Value")
+	readTx := reloaded.Transact(true)
+	defer readTx.Rollback()
+
+	results, _ := readTx.NewQuery("counter").Where("Value", big).Execute()
+	if len(results) != 1 || results[0].GetID() != "c1" {
+		t.Fatalf("Expected exactly c1 to match %d, got %v", big, results)
+	}
+	if ids := reloaded.IndexEntries("counter", "Value")["9007199254740993"]; len(ids) != 1 || ids[0] != "c1" {
+		t.Errorf("Expected the index to keep the exact value, got %v", ids)
+	}
+
+	fields := results[0].(*GenericEntity).Fields
+	if _, ok := fields["Small"].(float64); !ok {
+		t.Errorf("Expected small numbers to still decode as float64, got %T", fields["Small"])
+	}
+	if history := fields["History"].([]interface{}); !valuesEqual(history[0], big) {
+		t.Errorf("Expected nested values to keep precision, got %v", history[0])
+	}
+
+	greater, _ := readTx.NewQuery("counter").WhereCond(Gt("Value", big-1)).Execute()
+	if len(greater) != 1 || greater[0].GetID() != "c1" {
+		t.Errorf("Expected only c1 to be greater than %d, got %v", big-1, greater)
+	}
+}
@@ -0,0 +1,24 @@
+package flexdb
+
+// Option configures optional behaviour of a Database
+type Option func(*Database)
+
+// WithJSONOptions controls how the database file is encoded. escapeHTML
+// toggles escaping of <, > and & inside strings, and indent is the
+// per-level indentation (an empty string writes compact JSON).
+func WithJSONOptions(escapeHTML bool, indent string) Option {
+	return func(db *Database) {
+		db.escapeHTML = escapeHTML
+		db.indent = indent
+	}
+}
+
+// WithCaseInsensitiveTypes treats entity type names case-insensitively by
+// lowercasing them, so "User" and "user" name the same collection. Types
+// read from an existing file are lowercased too, merging any that differ
+// only in case.
+func WithCaseInsensitiveTypes() Option {
+	return func(db *Database) {
+		db.foldTypes = true
+	}
+}
@@ -0,0 +1,159 @@
+package flexdb
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithJSONOptions(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath, WithJSONOptions(false, "\t"))
+
+	writeTx := db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "1", Name: "<a href=\"https://example.com?a=1&b=2\">", Value: 1})
+	if err := writeTx.Commit(); err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to read database file: %v", err)
+	}
+	if !strings.Contains(string(data), `<a href=\"https://example.com?a=1&b=2\">`) {
+		t.Errorf("Expected HTML to be written unescaped, got %s", data)
+	}
+	if !strings.Contains(string(data), "\n\t\"test\"") {
+		t.Errorf("Expected tab indentation, got %s", data)
+	}
+
+	// The default keeps escaping HTML
+	os.Remove(dbPath)
+	db, _ = NewDatabase(dbPath)
+	writeTx = db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "1", Name: "<b>", Value: 1})
+	writeTx.Commit()
+
+	data, _ = os.ReadFile(dbPath)
+	if !strings.Contains(string(data), `\u003cb\u003e`) {
+		t.Errorf("Expected HTML to be escaped by default, got %s", data)
+	}
+}
+
+func TestCaseInsensitiveTypes(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath, WithCaseInsensitiveTypes())
+	db.AddIndex("USER", "Name")
+	tx := db.Transact(false)
+	tx.Set("User", &TestEntity{ID: "1", Name: "Alice"})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	if _, ok := db.Get("user", "1"); !ok {
+		t.Error("Expected an entity written to User to be read from user")
+	}
+	results, _ := db.Query("uSeR").Where("Name", "Alice").Execute()
+	if len(results) != 1 {
+		t.Errorf("Expected the query to find 1 entity, got %d", len(results))
+	}
+	if ids := db.IndexEntries("user", "Name")["Alice"]; len(ids) != 1 {
+		t.Errorf("Expected the index added as USER to cover user, got %v", ids)
+	}
+
+	readTx := db.Transact(true)
+	if got := readTx.MultiGet([]EntityRef{{"User", "1"}}); len(got) != 1 {
+		t.Errorf("Expected MultiGet to fold the type name, got %v", got)
+	}
+	readTx.Rollback()
+
+	destPath := "./test_db_copy.json"
+	defer os.Remove(destPath)
+	dest, _ := NewDatabase(destPath)
+	if n, err := db.CopyTo(dest, "User", nil); err != nil || n != 1 {
+		t.Errorf("Expected CopyTo to fold the type name, copied %d (%v)", n, err)
+	}
+
+	// DeleteWhere on the indexed field finds the entity whatever the case
+	tx = db.Transact(false)
+	tx.Set("User", &TestEntity{ID: "2", Name: "Bob"})
+	if n, err := tx.DeleteWhere("USER", "Name", "Bob"); err != nil || n != 1 {
+		t.Errorf("Expected DeleteWhere to delete 1 entity, got %d (%v)", n, err)
+	}
+	tx.Rollback()
+
+	reloaded, _ := NewDatabase(dbPath)
+	if _, ok := reloaded.Get("User", "1"); ok {
+		t.Error("Expected type names to stay case-sensitive without the option")
+	}
+	if _, ok := reloaded.Get("user", "1"); !ok {
+		t.Error("Expected the entity to be stored under the lowercased type")
+	}
+}
+
+func TestCaseInsensitiveTypesEntryPoints(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath, WithCaseInsensitiveTypes())
+	db.EnableHistory("Team")
+	db.AddIndex("Team", "Name")
+	db.AddRelation("Member", "TeamID", "TEAM")
+	migrated := 0
+	db.AddTypeMigration("Team", 1, func(tx *Transaction) error {
+		migrated++
+		return nil
+	}, nil)
+
+	tx := db.Transact(false)
+	tx.Set("team", &TestEntity{ID: "t1", Name: "Core"})
+	tx.Set("member", &GenericEntity{ID: "m1", Fields: map[string]interface{}{"TeamID": "t1"}})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	readTx := db.Transact(true)
+	if _, ok := readTx.GetVersion("TEAM", "t1", time.Now()); !ok {
+		t.Error("Expected GetVersion to fold the type name")
+	}
+	scanned := 0
+	readTx.ScanIndex("TEAM", "Name", "A", "Z")(func(Entity) bool {
+		scanned++
+		return true
+	})
+	if scanned != 1 {
+		t.Errorf("Expected ScanIndex to fold the type name, got %d entities", scanned)
+	}
+	readTx.Rollback()
+
+	if n := db.RebuildCache("Team"); n != 1 {
+		t.Errorf("Expected RebuildCache to fold the type name, cached %d", n)
+	}
+	if issues := db.Verify(); len(issues) != 0 {
+		t.Errorf("Expected the relation to resolve under the folded name, got %v", issues)
+	}
+
+	tx = db.Transact(false)
+	if err := tx.Rename("Team", "t1", "t2"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	member, _ := db.Get("Member", "m1")
+	if ref, _ := getField(member, "TeamID"); ref != "t2" {
+		t.Errorf("Expected Rename to update references through the folded name, got %v", ref)
+	}
+
+	if _, err := db.MigrateType("team", 1); err != nil {
+		t.Fatalf("MigrateType failed: %v", err)
+	}
+	if version, _ := db.TypeVersion("TEAM"); migrated != 1 || version != 1 {
+		t.Errorf("Expected the type migration to run under the folded name, ran %d and at version %d", migrated, version)
+	}
+}
@@ -0,0 +1,190 @@
+package flexdb
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// ErrPaginationExpired is returned for a stable pagination token that is unknown or has expired
+var ErrPaginationExpired = errors.New("pagination token expired or invalid")
+
+// ErrInvalidPageToken is returned for a keyset pagination token that cannot be decoded
+var ErrInvalidPageToken = errors.New("invalid pagination token")
+
+// stablePageTTL is how long a stable pagination session is kept after its last page request
+const stablePageTTL = 10 * time.Minute
+
+// StablePage returns one page of the query's results from a frozen snapshot
+// of the matching ids. An empty token runs the query and snapshots its ids;
+// later calls with the returned token read the following page from the same
+// snapshot, so rows inserted or reordered in the meantime do not cause
+// duplicates or skips. Entities deleted since the snapshot are left out.
+// An empty nextToken means the last page has been served.
+func (q *Query) StablePage(token string, pageSize int) (results []Entity, nextToken string, err error) {
+	if pageSize <= 0 {
+		return nil, "", fmt.Errorf("page size must be positive, got %d", pageSize)
+	}
+	sessions := q.tx.db.pageSessions()
+
+	var session string
+	var ids []string
+	offset := 0
+	if token == "" {
+		matches, err := q.Clone().Offset(0).Limit(0).Execute()
+		if err != nil {
+			return nil, "", err
+		}
+		ids = make([]string, len(matches))
+		for i, entity := range matches {
+			ids[i] = entity.GetID()
+		}
+		if session, err = newSessionID(); err != nil {
+			return nil, "", err
+		}
+	} else {
+		var offsetStr string
+		var ok bool
+		session, offsetStr, ok = strings.Cut(token, ":")
+		if offset, err = strconv.Atoi(offsetStr); !ok || err != nil || offset < 0 {
+			return nil, "", ErrPaginationExpired
+		}
+		cached, found := sessions.Get(session)
+		if !found {
+			return nil, "", ErrPaginationExpired
+		}
+		ids = cached.([]string)
+	}
+
+	end := offset + pageSize
+	if end > len(ids) {
+		end = len(ids)
+	}
+	for _, id := range ids[min(offset, end):end] {
+		if entity, ok := q.tx.Get(q.entityType, id); ok {
+			results = append(results, entity)
+		}
+	}
+
+	if end >= len(ids) {
+		sessions.Delete(session)
+		return results, "", nil
+	}
+	sessions.Set(session, ids, stablePageTTL)
+	return results, fmt.Sprintf("%s:%d", session, end), nil
+}
+
+// pageSessions returns the store of stable pagination snapshots, creating it on first use
+func (db *Database) pageSessions() *cache.Cache {
+	db.pageOnce.Do(func() {
+		db.pages = cache.New(stablePageTTL, time.Minute)
+	})
+	return db.pages
+}
+
+// newSessionID returns a random identifier for a pagination session
+func newSessionID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Batches runs the query and calls fn with successive slices of at most size
+// results, in query order. It stops at the first error fn returns. Each batch
+// is a fresh slice, so fn may keep it after returning.
+func (q *Query) Batches(size int, fn func(batch []Entity) error) error {
+	if size <= 0 {
+		return fmt.Errorf("batch size must be positive, got %d", size)
+	}
+	results, err := q.Execute()
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(results); start += size {
+		end := start + size
+		if end > len(results) {
+			end = len(results)
+		}
+		batch := append([]Entity(nil), results[start:end]...)
+		if err := fn(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pageCursor is the position a keyset pagination token encodes: the sort key
+// and ID of the last result served
+type pageCursor struct {
+	Key interface{} `json:"k,omitempty"`
+	ID  string      `json:"id"`
+	// Time marks a time.Time key, which JSON would otherwise turn into a string
+	Time bool `json:"t,omitempty"`
+}
+
+// PaginateToken returns the page of results following the position encoded
+// in token, using keyset pagination over the query's ordering. Tokens are
+// opaque base64 strings holding the last sort key and ID served, so no state
+// is kept between calls and entities added or removed meanwhile never cause
+// duplicates or skips. An empty token starts at the first page and an empty
+// nextToken means the last page has been served. Offset and Limit are ignored.
+func (q *Query) PaginateToken(token string, pageSize int) (results []Entity, nextToken string, err error) {
+	if pageSize <= 0 {
+		return nil, "", fmt.Errorf("page size must be positive, got %d", pageSize)
+	}
+	var after *pageCursor
+	if token != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrInvalidPageToken, err)
+		}
+		after = &pageCursor{}
+		if err := decodeJSON(raw, after); err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrInvalidPageToken, err)
+		}
+		if after.Time {
+			t, ok := toTime(after.Key)
+			if !ok {
+				return nil, "", fmt.Errorf("%w: bad time key %v", ErrInvalidPageToken, after.Key)
+			}
+			after.Key = t
+		}
+	}
+
+	matches, err := q.Clone().Offset(0).Limit(0).Execute()
+	if err != nil {
+		return nil, "", err
+	}
+	start := 0
+	if after != nil {
+		// Results are totally ordered, so skip everything up to and including the cursor
+		start = sort.Search(len(matches), func(i int) bool {
+			return q.compareKeys(q.sortKey(matches[i]), matches[i].GetID(), after.Key, after.ID) > 0
+		})
+	}
+	end := start + pageSize
+	if end >= len(matches) {
+		return matches[start:], "", nil
+	}
+
+	results = matches[start:end]
+	last := results[len(results)-1]
+	cursor := pageCursor{Key: q.sortKey(last), ID: last.GetID()}
+	_, cursor.Time = cursor.Key.(time.Time)
+	raw, err := json.Marshal(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	return results, base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,186 @@
+package flexdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStablePage(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	for i := 0; i < 10; i++ {
+		tx.Set("test", &TestEntity{ID: fmt.Sprint("orig", i), Value: i * 10})
+	}
+	tx.Commit()
+
+	seen := make(map[string]bool)
+	token := ""
+	pages := 0
+	for {
+		readTx := db.Transact(true)
+		results, next, err := readTx.NewQuery("test").OrderBy("Value", false).StablePage(token, 3)
+		readTx.Rollback()
+		if err != nil {
+			t.Fatalf("StablePage failed: %v", err)
+		}
+		pages++
+		for _, e := range results {
+			if seen[e.GetID()] {
+				t.Errorf("Duplicate entity %s on page %d", e.GetID(), pages)
+			}
+			seen[e.GetID()] = true
+		}
+
+		// Insert rows that sort before everything between page requests
+		writeTx := db.Transact(false)
+		writeTx.Set("test", &TestEntity{ID: fmt.Sprint("new", pages), Value: -pages})
+		writeTx.Commit()
+
+		if next == "" {
+			break
+		}
+		token = next
+	}
+
+	if pages != 4 {
+		t.Errorf("Expected 4 pages, got %d", pages)
+	}
+	if len(seen) != 10 {
+		t.Errorf("Expected the 10 original entities, got %d", len(seen))
+	}
+	for id := range seen {
+		if id[:4] != "orig" {
+			t.Errorf("Unexpected entity %s inserted after the snapshot", id)
+		}
+	}
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+	if _, _, err := readTx.NewQuery("test").StablePage(token, 3); !errors.Is(err, ErrPaginationExpired) {
+		t.Errorf("Expected a finished session to be released, got %v", err)
+	}
+}
+
+func TestBatches(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	for i := 0; i < 30; i++ {
+		tx.Set("test", &TestEntity{ID: fmt.Sprintf("%02d", i), Value: i})
+	}
+	tx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	var sizes []int
+	var ids []string
+	err := readTx.NewQuery("test").WhereFunc(func(e Entity) bool {
+		return e.(*TestEntity).Value < 25
+	}).OrderBy("ID", false).Batches(10, func(batch []Entity) error {
+		sizes = append(sizes, len(batch))
+		for _, e := range batch {
+			ids = append(ids, e.GetID())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Batches failed: %v", err)
+	}
+	if fmt.Sprint(sizes) != "[10 10 5]" {
+		t.Errorf("Expected batch sizes [10 10 5], got %v", sizes)
+	}
+	if len(ids) != 25 || ids[0] != "00" || ids[24] != "24" {
+		t.Errorf("Expected ids 00 to 24 in order, got %v", ids)
+	}
+
+	errStop := errors.New("stop")
+	calls := 0
+	err = readTx.NewQuery("test").Batches(10, func([]Entity) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || calls != 1 {
+		t.Errorf("Expected the first error to stop batching, got %v after %d calls", err, calls)
+	}
+}
+
+func TestPaginateToken(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	for i := 0; i < 23; i++ {
+		tx.Set("test", &TestEntity{ID: fmt.Sprintf("%02d", i), Value: i % 5})
+	}
+	tx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+	query := readTx.NewQuery("test").OrderBy("Value", true)
+	all, _ := query.Execute()
+
+	var paged []string
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("Expected pagination to finish within 5 pages")
+		}
+		results, next, err := query.PaginateToken(token, 5)
+		if err != nil {
+			t.Fatalf("PaginateToken failed: %v", err)
+		}
+		for _, e := range results {
+			paged = append(paged, e.GetID())
+		}
+		if next == "" {
+			break
+		}
+		token = next
+	}
+
+	if len(paged) != len(all) {
+		t.Fatalf("Expected %d results across pages, got %d", len(all), len(paged))
+	}
+	for i, e := range all {
+		if paged[i] != e.GetID() {
+			t.Fatalf("Expected contiguous, non-overlapping pages matching Execute, got %v", paged)
+		}
+	}
+
+	if _, _, err := query.PaginateToken("not a token!", 5); !errors.Is(err, ErrInvalidPageToken) {
+		t.Errorf("Expected ErrInvalidPageToken, got %v", err)
+	}
+}
+
+func TestPaginateTokenTimeKeys(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tx := db.Transact(false)
+	for i := 0; i < 4; i++ {
+		tx.Set("user", &UserEntity{ID: fmt.Sprint("u", i), CreatedAt: base.Add(time.Duration(i) * time.Hour)})
+	}
+	tx.Commit()
+
+	query := db.Query("user").OrderBy("CreatedAt", false)
+	first, token, _ := query.PaginateToken("", 3)
+	second, next, err := query.PaginateToken(token, 3)
+	if err != nil {
+		t.Fatalf("PaginateToken failed: %v", err)
+	}
+	if len(first) != 3 || len(second) != 1 || second[0].GetID() != "u3" || next != "" {
+		t.Errorf("Expected pages of 3 and 1 ending with u3, got %v and %v", first, second)
+	}
+}
@@ -0,0 +1,181 @@
+package flexdb
+
+import (
+	"fmt"
+	"time"
+)
+
+// Granularity is the length of the periods a time partition buckets entities by
+type Granularity int
+
+const (
+	GranularityHour Granularity = iota
+	GranularityDay
+	GranularityMonth
+	GranularityYear
+)
+
+// timePartition buckets the IDs of an entity type by the period their time
+// field falls in. Periods are keyed by their start in Unix seconds, UTC.
+type timePartition struct {
+	field       string
+	granularity Granularity
+	buckets     map[int64]map[string]struct{}
+	// periods maps each partitioned ID to its bucket so it can be moved or removed
+	periods map[string]int64
+}
+
+// timeRange is a WhereTimeRange filter, kept so Execute can prune partitions
+type timeRange struct {
+	field    string
+	from, to time.Time
+}
+
+// SetTimePartition buckets the entities of a type by the period their time
+// field falls in, so queries with a WhereTimeRange on that field only scan
+// the buckets overlapping the range. The field may hold a time.Time or an
+// RFC 3339 string; entities without one are left out of every bucket, as no
+// time range can match them. Setting a partition again replaces it.
+func (db *Database) SetTimePartition(entityType, field string, granularity Granularity) {
+	entityType = db.typeName(entityType)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.buildPartition(entityType, field, granularity)
+}
+
+// buildPartition (re)creates the partition of a type from committed data. The caller must hold the write lock.
+func (db *Database) buildPartition(entityType, field string, granularity Granularity) {
+	p := &timePartition{
+		field:       field,
+		granularity: granularity,
+		buckets:     make(map[int64]map[string]struct{}),
+		periods:     make(map[string]int64, len(db.data[entityType])),
+	}
+	for id, entity := range db.data[entityType] {
+		p.add(id, entity)
+	}
+	db.partitions[entityType] = p
+}
+
+// partitionUpdate moves a committed entity to the bucket of its current
+// period, or drops it when entity is nil. The caller must hold the write lock.
+func (db *Database) partitionUpdate(entityType, id string, entity Entity) {
+	p := db.partitions[entityType]
+	if p == nil {
+		return
+	}
+	p.remove(id)
+	if entity != nil {
+		p.add(id, entity)
+	}
+}
+
+// add places an ID in the bucket of the entity's period
+func (p *timePartition) add(id string, entity Entity) {
+	value, ok := getField(entity, p.field)
+	if !ok {
+		return
+	}
+	t, ok := toTime(value)
+	if !ok {
+		return
+	}
+	start := p.periodStart(t).Unix()
+	if p.buckets[start] == nil {
+		p.buckets[start] = make(map[string]struct{})
+	}
+	p.buckets[start][id] = struct{}{}
+	p.periods[id] = start
+}
+
+// remove takes an ID out of its bucket, dropping the bucket once it is empty
+func (p *timePartition) remove(id string) {
+	start, ok := p.periods[id]
+	if !ok {
+		return
+	}
+	delete(p.periods, id)
+	delete(p.buckets[start], id)
+	if len(p.buckets[start]) == 0 {
+		delete(p.buckets, start)
+	}
+}
+
+// periodStart returns the start of the period containing t
+func (p *timePartition) periodStart(t time.Time) time.Time {
+	t = t.UTC()
+	switch p.granularity {
+	case GranularityHour:
+		return t.Truncate(time.Hour)
+	case GranularityDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case GranularityMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// periodEnd returns the start of the period following the one starting at start
+func (p *timePartition) periodEnd(start time.Time) time.Time {
+	switch p.granularity {
+	case GranularityHour:
+		return start.Add(time.Hour)
+	case GranularityDay:
+		return start.AddDate(0, 0, 1)
+	case GranularityMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(1, 0, 0)
+	}
+}
+
+// overlaps reports whether the bucket starting at start can hold times in [from, to)
+func (p *timePartition) overlaps(start int64, from, to time.Time) bool {
+	begin := time.Unix(start, 0).UTC()
+	return begin.Before(to) && p.periodEnd(begin).After(from)
+}
+
+// WhereTimeRange filters to entities whose time field falls in [from, to).
+// The field may hold a time.Time or an RFC 3339 string. When the type is
+// partitioned on the field, only the overlapping partitions are scanned.
+func (q *Query) WhereTimeRange(field string, from, to time.Time) *Query {
+	q.timeRanges = append(q.timeRanges, timeRange{field, from, to})
+	desc := fmt.Sprintf("%s IN [%s, %s)", field, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	q.addFilter(desc, func(e Entity) bool {
+		value, ok := getField(e, field)
+		if !ok {
+			return false
+		}
+		t, ok := toTime(value)
+		return ok && !t.Before(from) && t.Before(to)
+	})
+	return q
+}
+
+// partitionIDs returns the committed IDs in the partitions overlapping a time
+// range on the partitioned field. It returns false when the query cannot be
+// served by a partition. The caller must hold the read lock.
+func (q *Query) partitionIDs() ([]string, bool) {
+	p := q.tx.db.partitions[q.entityType]
+	if p == nil {
+		return nil, false
+	}
+	for _, r := range q.timeRanges {
+		if r.field != p.field {
+			continue
+		}
+		var ids []string
+		for start, bucket := range p.buckets {
+			if p.overlaps(start, r.from, r.to) {
+				for id := range bucket {
+					ids = append(ids, id)
+				}
+			}
+		}
+		return ids, true
+	}
+	return nil, false
+}
@@ -0,0 +1,71 @@
+package flexdb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTimePartitionPrunesQueries(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.SetTimePartition("users", "CreatedAt", GranularityMonth)
+
+	tx := db.Transact(false)
+	for month := 1; month <= 6; month++ {
+		for day := 1; day <= 5; day++ {
+			tx.Set("users", &UserEntity{
+				ID:        fmt.Sprintf("u-%d-%d", month, day),
+				CreatedAt: time.Date(2024, time.Month(month), day*5, 12, 0, 0, 0, time.UTC),
+			})
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	from := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+	scanned := 0
+	readTx := db.Transact(true)
+	results, err := readTx.NewQuery("users").
+		WhereFunc(func(Entity) bool { scanned++; return true }).
+		WhereTimeRange("CreatedAt", from, to).
+		Execute()
+	readTx.Rollback()
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 5 {
+		t.Errorf("Expected 5 entities created in March, got %d", len(results))
+	}
+	if scanned != 5 {
+		t.Errorf("Expected only the March partition to be scanned, scanned %d", scanned)
+	}
+
+	// Moving an entity to another month moves it between partitions, and
+	// pending changes are visible to the query
+	tx = db.Transact(false)
+	tx.Set("users", &UserEntity{ID: "u-1-1", CreatedAt: from.Add(time.Hour)})
+	tx.Delete("users", "u-3-1")
+	results, _ = tx.NewQuery("users").WhereTimeRange("CreatedAt", from, to).Execute()
+	if len(results) != 5 {
+		t.Errorf("Expected pending changes to apply, got %d results", len(results))
+	}
+	tx.Commit()
+
+	readTx = db.Transact(true)
+	defer readTx.Rollback()
+	results, _ = readTx.NewQuery("users").WhereTimeRange("CreatedAt", from, to).Execute()
+	if len(results) != 5 || results[0].GetID() != "u-1-1" {
+		t.Errorf("Expected the moved entity in March after commit, got %v", results)
+	}
+	january := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	results, _ = readTx.NewQuery("users").WhereTimeRange("CreatedAt", january, january.AddDate(0, 1, 0)).Execute()
+	if len(results) != 4 {
+		t.Errorf("Expected 4 entities left in January, got %d", len(results))
+	}
+}
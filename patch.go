@@ -0,0 +1,77 @@
+package flexdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// ApplyMergePatch applies an RFC 7396 JSON merge patch to a stored entity.
+// Keys set to null are removed, objects are merged recursively and every
+// other value replaces the existing one. Typed entities are patched through
+// their JSON encoding. Numbers are decoded as decodeJSON does, so integers
+// beyond float64 precision survive the patch.
+func (tx *Transaction) ApplyMergePatch(entityType, id string, patch []byte) error {
+	var patchDoc interface{}
+	if err := decodeJSON(patch, &patchDoc); err != nil {
+		return fmt.Errorf("invalid merge patch: %w", err)
+	}
+	patchFields, ok := patchDoc.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid merge patch: must be a JSON object")
+	}
+
+	entity, ok := tx.lookup(entityType, id)
+	if !ok {
+		return fmt.Errorf("entity %s not found in %s", id, entityType)
+	}
+
+	if ge, ok := entity.(*GenericEntity); ok {
+		patched := copyEntity(ge).(*GenericEntity)
+		patched.Fields = mergePatch(patched.Fields, patchFields).(map[string]interface{})
+		return tx.Set(entityType, patched)
+	}
+
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	if err := decodeJSON(data, &doc); err != nil {
+		return err
+	}
+	merged, err := json.Marshal(mergePatch(doc, patchFields))
+	if err != nil {
+		return err
+	}
+	patched := reflect.New(reflect.TypeOf(entity).Elem()).Interface().(Entity)
+	if err := json.Unmarshal(merged, patched); err != nil {
+		return fmt.Errorf("failed to apply merge patch to %s: %w", id, err)
+	}
+	patched.SetID(id)
+	return tx.Set(entityType, patched)
+}
+
+// mergePatch merges patch into target following RFC 7396
+func mergePatch(target, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetMap, ok := target.(map[string]interface{})
+	result := make(map[string]interface{}, len(targetMap)+len(patchMap))
+	if ok {
+		for k, v := range targetMap {
+			result[k] = v
+		}
+	}
+	for k, v := range patchMap {
+		if v == nil {
+			delete(result, k)
+		} else {
+			result[k] = mergePatch(result[k], v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,91 @@
+package flexdb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	writeTx := db.Transact(false)
+	writeTx.Set("user", &GenericEntity{ID: "1", Fields: map[string]interface{}{
+		"name":     "Alice",
+		"nickname": "Al",
+		"address":  map[string]interface{}{"city": "Paris", "zip": "75001"},
+	}})
+	writeTx.Set("test", &TestEntity{ID: "2", Name: "Typed", Value: 1})
+	writeTx.Commit()
+
+	writeTx = db.Transact(false)
+	err := writeTx.ApplyMergePatch("user", "1", []byte(`{"name": "Alicia", "nickname": null, "address": {"zip": null, "country": "FR"}}`))
+	if err != nil {
+		t.Fatalf("ApplyMergePatch failed: %v", err)
+	}
+	if err := writeTx.ApplyMergePatch("test", "2", []byte(`{"Value": 5}`)); err != nil {
+		t.Fatalf("ApplyMergePatch on typed entity failed: %v", err)
+	}
+	if err := writeTx.ApplyMergePatch("user", "missing", []byte(`{}`)); err == nil {
+		t.Error("Expected an error patching a missing entity")
+	}
+	writeTx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	entity, _ := readTx.Get("user", "1")
+	fields := entity.(*GenericEntity).Fields
+	if fields["name"] != "Alicia" {
+		t.Errorf("Expected name to be updated, got %v", fields["name"])
+	}
+	if _, ok := fields["nickname"]; ok {
+		t.Error("Expected nickname to be removed")
+	}
+	address := fields["address"].(map[string]interface{})
+	if address["city"] != "Paris" || address["country"] != "FR" || address["zip"] != nil {
+		t.Errorf("Unexpected merged address: %v", address)
+	}
+
+	typed, _ := readTx.Get("test", "2")
+	if typed.(*TestEntity).Value != 5 || typed.(*TestEntity).Name != "Typed" {
+		t.Errorf("Unexpected patched typed entity: %+v", typed)
+	}
+}
+
+func TestApplyMergePatchLargeIntegers(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	const big = 1<<53 + 1
+	writeTx := db.Transact(false)
+	writeTx.Set("user", &GenericEntity{ID: "1", Fields: map[string]interface{}{"name": "Alice"}})
+	writeTx.Set("test", &TestEntity{ID: "2", Name: "Typed", Value: big})
+	writeTx.Commit()
+
+	writeTx = db.Transact(false)
+	if err := writeTx.ApplyMergePatch("user", "1", []byte(`{"counter": 9007199254740993}`)); err != nil {
+		t.Fatalf("ApplyMergePatch failed: %v", err)
+	}
+	if err := writeTx.ApplyMergePatch("test", "2", []byte(`{"Name": "Renamed"}`)); err != nil {
+		t.Fatalf("ApplyMergePatch on typed entity failed: %v", err)
+	}
+	writeTx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	entity, _ := readTx.Get("user", "1")
+	if counter := entity.(*GenericEntity).Fields["counter"]; fmt.Sprint(counter) != "9007199254740993" {
+		t.Errorf("Expected the patched integer to keep its precision, got %v", counter)
+	}
+	typed, _ := readTx.Get("test", "2")
+	if typed.(*TestEntity).Value != big || typed.(*TestEntity).Name != "Renamed" {
+		t.Errorf("Expected the stored integer to keep its precision, got %+v", typed)
+	}
+}
@@ -0,0 +1,149 @@
+package flexdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// prefixIndex keeps the string values of a field sorted so the IDs sharing
+// a prefix form one contiguous range
+type prefixIndex struct {
+	field   string
+	entries []prefixEntry
+	// values maps each indexed ID to its value so it can be found for removal
+	values map[string]string
+}
+
+// prefixEntry is one indexed value and the ID holding it
+type prefixEntry struct {
+	value string
+	id    string
+}
+
+// AddPrefixIndex keeps a sorted index of a string field so queries with a
+// WherePrefix on that field only scan entities whose value has the prefix.
+// Entities whose field is missing or not a string are not indexed.
+func (db *Database) AddPrefixIndex(entityType, field string) {
+	entityType = db.typeName(entityType)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.buildPrefixIndex(entityType, field)
+}
+
+// buildPrefixIndex (re)creates the prefix index for a field from committed data. The caller must hold the write lock.
+func (db *Database) buildPrefixIndex(entityType, field string) {
+	index := &prefixIndex{field: field, values: make(map[string]string, len(db.data[entityType]))}
+	for id, entity := range db.data[entityType] {
+		if value, ok := prefixValue(entity, field); ok {
+			index.entries = append(index.entries, prefixEntry{value, id})
+			index.values[id] = value
+		}
+	}
+	sort.Slice(index.entries, func(i, j int) bool {
+		return index.entries[i].less(index.entries[j])
+	})
+
+	if db.prefixes[entityType] == nil {
+		db.prefixes[entityType] = make(map[string]*prefixIndex)
+	}
+	db.prefixes[entityType][field] = index
+}
+
+// prefixUpdate brings the prefix indexes of a type in line with a committed
+// entity, or drops it when entity is nil. The caller must hold the write lock.
+func (db *Database) prefixUpdate(entityType, id string, entity Entity) {
+	for _, index := range db.prefixes[entityType] {
+		index.remove(id)
+		if entity == nil {
+			continue
+		}
+		if value, ok := prefixValue(entity, index.field); ok {
+			index.insert(prefixEntry{value, id})
+		}
+	}
+}
+
+// prefixValue returns the string value of a field
+func prefixValue(entity Entity, field string) (string, bool) {
+	value, ok := getField(entity, field)
+	if !ok {
+		return "", false
+	}
+	s, ok := value.(string)
+	return s, ok
+}
+
+func (e prefixEntry) less(other prefixEntry) bool {
+	if e.value != other.value {
+		return e.value < other.value
+	}
+	return e.id < other.id
+}
+
+// search returns the position of the first entry not less than e
+func (p *prefixIndex) search(e prefixEntry) int {
+	return sort.Search(len(p.entries), func(i int) bool {
+		return !p.entries[i].less(e)
+	})
+}
+
+func (p *prefixIndex) insert(e prefixEntry) {
+	i := p.search(e)
+	p.entries = append(p.entries, prefixEntry{})
+	copy(p.entries[i+1:], p.entries[i:])
+	p.entries[i] = e
+	p.values[e.id] = e.value
+}
+
+func (p *prefixIndex) remove(id string) {
+	value, ok := p.values[id]
+	if !ok {
+		return
+	}
+	delete(p.values, id)
+	if i := p.search(prefixEntry{value, id}); i < len(p.entries) && p.entries[i].id == id {
+		p.entries = append(p.entries[:i], p.entries[i+1:]...)
+	}
+}
+
+// withPrefix returns the IDs whose value starts with prefix, in value order
+func (p *prefixIndex) withPrefix(prefix string) []string {
+	var ids []string
+	for i := p.search(prefixEntry{value: prefix}); i < len(p.entries); i++ {
+		if !strings.HasPrefix(p.entries[i].value, prefix) {
+			break
+		}
+		ids = append(ids, p.entries[i].id)
+	}
+	return ids
+}
+
+// WherePrefix filters to entities whose string field starts with prefix.
+// When the field has a prefix index, only the matching range is scanned.
+func (q *Query) WherePrefix(field, prefix string) *Query {
+	q.startsWith = append(q.startsWith, fieldValue{field, prefix})
+	q.addFilter(fmt.Sprintf("%s STARTS WITH %q", field, prefix), func(e Entity) bool {
+		value, ok := getField(e, field)
+		if !ok {
+			return false
+		}
+		s, ok := value.(string)
+		return ok && strings.HasPrefix(s, prefix)
+	})
+	return q
+}
+
+// prefixIDs returns the committed IDs in the range of a prefix index matching
+// a WherePrefix filter, and the filtered field. It returns false when no
+// filtered field has a prefix index. The caller must hold the read lock.
+func (q *Query) prefixIDs() ([]string, string, bool) {
+	for _, p := range q.startsWith {
+		if index, ok := q.tx.db.prefixes[q.entityType][p.field]; ok {
+			return index.withPrefix(p.value.(string)), p.field, true
+		}
+	}
+	return nil, "", false
+}
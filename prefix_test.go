@@ -0,0 +1,58 @@
+package flexdb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPrefixIndex(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	for i, name := range []string{"alice", "alfred", "albert", "bob", "alan", "carol", "Alex"} {
+		tx.Set("test", &TestEntity{ID: string(rune('a' + i)), Name: name})
+	}
+	tx.Commit()
+	db.AddPrefixIndex("test", "Name")
+
+	scanned := 0
+	readTx := db.Transact(true)
+	results, err := readTx.NewQuery("test").
+		WhereFunc(func(Entity) bool { scanned++; return true }).
+		WherePrefix("Name", "al").
+		OrderBy("Name", false).
+		Execute()
+	readTx.Rollback()
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	var names []string
+	for _, e := range results {
+		names = append(names, e.(*TestEntity).Name)
+	}
+	if len(names) != 4 || names[0] != "alan" || names[3] != "alice" {
+		t.Errorf("Expected the four names starting with al, got %v", names)
+	}
+	if scanned != 4 {
+		t.Errorf("Expected only matching entities to be scanned, scanned %d", scanned)
+	}
+
+	// The index follows committed renames and deletes
+	tx = db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "d", Name: "albus"})
+	tx.Delete("test", "a")
+	tx.Commit()
+
+	readTx = db.Transact(true)
+	defer readTx.Rollback()
+	results, _ = readTx.NewQuery("test").WherePrefix("Name", "al").Execute()
+	if len(results) != 4 {
+		t.Errorf("Expected 4 entities after rename and delete, got %d", len(results))
+	}
+	results, _ = readTx.NewQuery("test").WherePrefix("Name", "b").Execute()
+	if len(results) != 0 {
+		t.Errorf("Expected no names starting with b, got %v", results)
+	}
+}
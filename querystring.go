@@ -0,0 +1,82 @@
+package flexdb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// String renders the query for debugging, e.g.
+//
+//	Query(user) WHERE Status = "active" AND <func> ORDER BY CreatedAt DESC LIMIT 10 OFFSET 20
+//
+// Filters added with WhereFunc render as <func>.
+func (q *Query) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Query(%s)", q.entityType)
+	if len(q.descriptions) > 0 {
+		b.WriteString(" WHERE ")
+		b.WriteString(strings.Join(q.descriptions, " AND "))
+	}
+	if q.orderBy != "" {
+		fmt.Fprintf(&b, " ORDER BY %s", q.orderBy)
+		if q.orderDesc {
+			b.WriteString(" DESC")
+		} else {
+			b.WriteString(" ASC")
+		}
+	}
+	if q.limit > 0 {
+		fmt.Fprintf(&b, " LIMIT %d", q.limit)
+	}
+	if q.offset > 0 {
+		fmt.Fprintf(&b, " OFFSET %d", q.offset)
+	}
+	return b.String()
+}
+
+// String renders the filter tree in the same form as Query.String
+func (f Filter) String() string {
+	switch f.Op {
+	case FilterOpAnd, FilterOpOr:
+		parts := make([]string, len(f.Filters))
+		for i, child := range f.Filters {
+			parts[i] = child.String()
+		}
+		return "(" + strings.Join(parts, " "+strings.ToUpper(f.Op)+" ") + ")"
+	case FilterOpNot:
+		parts := make([]string, len(f.Filters))
+		for i, child := range f.Filters {
+			parts[i] = child.String()
+		}
+		return "NOT " + strings.Join(parts, ", ")
+	case FilterOpEq:
+		return fmt.Sprintf("%s = %s", f.Field, describeValue(f.Value))
+	case FilterOpGt:
+		return fmt.Sprintf("%s > %s", f.Field, describeValue(f.Value))
+	case FilterOpLt:
+		return fmt.Sprintf("%s < %s", f.Field, describeValue(f.Value))
+	case FilterOpIn:
+		values, _ := f.Value.([]interface{})
+		return fmt.Sprintf("%s IN %s", f.Field, describeValues(values))
+	case FilterOpLike:
+		return fmt.Sprintf("%s LIKE %s", f.Field, describeValue(f.Value))
+	}
+	return fmt.Sprintf("%s %s %s", f.Field, f.Op, describeValue(f.Value))
+}
+
+// describeValue formats a filter value, quoting strings
+func describeValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprint(v)
+}
+
+// describeValues formats a list of filter values
+func describeValues(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = describeValue(v)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
@@ -0,0 +1,49 @@
+package flexdb
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestQueryString(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(true)
+	defer tx.Rollback()
+
+	q := tx.NewQuery("user").
+		Where("Status", "active").
+		WhereIn("Role", []interface{}{"admin", 2}).
+		WhereLike("Email", "@example.com").
+		WhereFunc(func(Entity) bool { return true }).
+		WhereFieldGt("Spent", "Budget").
+		Apply(FilterOr(FilterGt("Age", 18), FilterNot(FilterEq("Banned", true)))).
+		OrderBy("CreatedAt", true).
+		Limit(10).
+		Offset(20)
+
+	got := q.String()
+	for _, want := range []string{
+		"Query(user) WHERE ",
+		`Status = "active"`,
+		`Role IN ["admin", 2]`,
+		`Email LIKE "@example.com"`,
+		"<func>",
+		"Spent > Budget",
+		"(Age > 18 OR NOT Banned = true)",
+		"ORDER BY CreatedAt DESC",
+		"LIMIT 10",
+		"OFFSET 20",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in %s", want, got)
+		}
+	}
+
+	if s := tx.NewQuery("user").String(); s != "Query(user)" {
+		t.Errorf("Expected a bare query to render as Query(user), got %s", s)
+	}
+}
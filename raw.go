@@ -0,0 +1,60 @@
+package flexdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// GetRaw returns the JSON document of an entity, suitable for passing
+// straight through to a client. The entity is encoded the way it is written
+// to the database file, honouring the HTML escaping set with WithJSONOptions.
+func (tx *Transaction) GetRaw(entityType, id string) (json.RawMessage, bool) {
+	entity, ok := tx.Get(entityType, id)
+	if !ok {
+		return nil, false
+	}
+	raw, err := tx.db.marshalEntity(entity)
+	if err != nil {
+		return nil, false
+	}
+	return raw, true
+}
+
+// marshalEntity encodes a single entity as compact JSON
+func (db *Database) marshalEntity(entity Entity) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(db.escapeHTML)
+	if err := enc.Encode(entity); err != nil {
+		return nil, err
+	}
+	return json.RawMessage(bytes.TrimRight(buf.Bytes(), "\n")), nil
+}
+
+// WriteJSON runs the query and writes the results to w as a JSON array,
+// encoding one entity at a time rather than building the whole document first
+func (q *Query) WriteJSON(w io.Writer) error {
+	results, err := q.Execute()
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(q.tx.db.escapeHTML)
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i, entity := range results {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(entity); err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, "]")
+	return err
+}
@@ -0,0 +1,72 @@
+package flexdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestGetRaw(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "Raw", Value: 7})
+	tx.Commit()
+
+	reloaded, _ := NewDatabase(dbPath)
+	for name, d := range map[string]*Database{"typed": db, "reloaded": reloaded} {
+		readTx := d.Transact(true)
+		raw, ok := readTx.GetRaw("test", "1")
+		if !ok {
+			t.Fatalf("%s: expected raw JSON", name)
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			t.Fatalf("%s: raw JSON did not unmarshal: %v", name, err)
+		}
+		if doc["ID"] != "1" || doc["Name"] != "Raw" || doc["Value"] != float64(7) {
+			t.Errorf("%s: unexpected document %v", name, doc)
+		}
+		if _, ok := readTx.GetRaw("test", "missing"); ok {
+			t.Errorf("%s: expected no raw JSON for a missing entity", name)
+		}
+		readTx.Rollback()
+	}
+}
+
+func TestQueryWriteJSON(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "One", Value: 1})
+	tx.Set("test", &TestEntity{ID: "2", Name: "Two", Value: 2})
+	tx.Set("test", &TestEntity{ID: "3", Name: "Three", Value: 3})
+	tx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	var buf bytes.Buffer
+	err := readTx.NewQuery("test").WhereFieldExists("Value").OrderBy("Value", true).Limit(2).WriteJSON(&buf)
+	if err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var docs []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &docs); err != nil {
+		t.Fatalf("Output is not a JSON array: %v\n%s", err, buf.String())
+	}
+	if len(docs) != 2 || docs[0]["Name"] != "Three" || docs[1]["Name"] != "Two" {
+		t.Errorf("Unexpected documents: %v", docs)
+	}
+
+	buf.Reset()
+	readTx.NewQuery("missing").WriteJSON(&buf)
+	if buf.String() != "[]" {
+		t.Errorf("Expected an empty array, got %q", buf.String())
+	}
+}
@@ -0,0 +1,111 @@
+package flexdb
+
+import "fmt"
+
+// AddRelation declares that a field of an entity type holds the ID of an
+// entity of targetType. Set rejects values that do not reference an existing
+// entity, and Rename rewrites the field when the target's ID changes.
+func (db *Database) AddRelation(entityType, field, targetType string) {
+	targetType = db.typeName(targetType)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c := db.collectionFor(entityType)
+	if c.relations == nil {
+		c.relations = make(map[string]string)
+	}
+	c.relations[field] = targetType
+}
+
+// checkRelations ensures every relation field of an entity references an existing entity
+func (tx *Transaction) checkRelations(entity Entity, relations map[string]string) error {
+	for field, targetType := range relations {
+		value, ok := getField(entity, field)
+		if !ok || isZeroValue(value) {
+			continue
+		}
+		targetID := fmt.Sprint(value)
+		if _, exists := tx.lookup(targetType, targetID); !exists {
+			return fmt.Errorf("field %s references missing %s %s", field, targetType, targetID)
+		}
+	}
+	return nil
+}
+
+// referencingFields returns, per entity type, the relation fields that point at targetType
+func (db *Database) referencingFields(targetType string) map[string][]string {
+	targetType = db.typeName(targetType)
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	refs := make(map[string][]string)
+	for entityType, c := range db.collections {
+		for field, target := range c.relations {
+			if target == targetType {
+				refs[entityType] = append(refs[entityType], field)
+			}
+		}
+	}
+	return refs
+}
+
+// Rename moves an entity to a new ID, updating any entities that reference it
+// through a relation. It fails if an entity with newID already exists.
+func (tx *Transaction) Rename(entityType, oldID, newID string) error {
+	entityType = tx.db.typeName(entityType)
+
+	if tx.readOnly {
+		return fmt.Errorf("cannot modify data in a read-only transaction")
+	}
+	if newID == "" {
+		return ErrEmptyID
+	}
+
+	entity, ok := tx.lookup(entityType, oldID)
+	if !ok {
+		return fmt.Errorf("entity %s not found in %s", oldID, entityType)
+	}
+	if _, taken := tx.lookup(entityType, newID); taken {
+		return fmt.Errorf("entity %s already exists in %s", newID, entityType)
+	}
+
+	renamed := copyEntity(entity)
+	renamed.SetID(newID)
+	if ge, ok := renamed.(*GenericEntity); ok {
+		for _, key := range []string{"ID", "id"} {
+			if _, ok := ge.Fields[key]; ok {
+				ge.Fields[key] = newID
+			}
+		}
+	}
+
+	if err := tx.Delete(entityType, oldID); err != nil {
+		return err
+	}
+	if err := tx.Set(entityType, renamed); err != nil {
+		return err
+	}
+
+	for refType, fields := range tx.db.referencingFields(entityType) {
+		for _, ref := range tx.lookupAll(refType) {
+			var updated Entity
+			for _, field := range fields {
+				if value, ok := getField(ref, field); ok && fmt.Sprint(value) == oldID {
+					if updated == nil {
+						updated = copyEntity(ref)
+					}
+					setField(updated, field, newID)
+				}
+			}
+			if updated != nil {
+				if err := tx.Set(refType, updated); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
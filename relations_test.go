@@ -0,0 +1,85 @@
+package flexdb
+
+import (
+	"os"
+	"testing"
+)
+
+// OrderEntity is a sample entity referencing a UserEntity
+type OrderEntity struct {
+	ID     string
+	UserID string
+	Status string
+}
+
+func (o *OrderEntity) GetID() string   { return o.ID }
+func (o *OrderEntity) SetID(id string) { o.ID = id }
+
+func TestRelations(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.AddRelation("order", "UserID", "user")
+
+	writeTx := db.Transact(false)
+	defer writeTx.Rollback()
+
+	if err := writeTx.Set("order", &OrderEntity{ID: "o1", UserID: "missing"}); err == nil {
+		t.Error("Expected an error for an order referencing a missing user")
+	}
+
+	writeTx.Set("user", &UserEntity{ID: "u1", Email: "alice@example.com"})
+	if err := writeTx.Set("order", &OrderEntity{ID: "o1", UserID: "u1"}); err != nil {
+		t.Errorf("Failed to set order referencing an existing user: %v", err)
+	}
+}
+
+func TestRename(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.AddIndex("user", "Email")
+	db.AddRelation("order", "UserID", "user")
+
+	writeTx := db.Transact(false)
+	writeTx.Set("user", &UserEntity{ID: "u1", Email: "alice@example.com"})
+	writeTx.Set("user", &UserEntity{ID: "u3", Email: "carol@example.com"})
+	writeTx.Set("order", &OrderEntity{ID: "o1", UserID: "u1"})
+	writeTx.Set("order", &OrderEntity{ID: "o2", UserID: "u1"})
+	writeTx.Commit()
+
+	writeTx = db.Transact(false)
+	if err := writeTx.Rename("user", "u1", "u3"); err == nil {
+		t.Error("Expected an error when renaming onto an existing ID")
+	}
+	if err := writeTx.Rename("user", "u1", "u2"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if err := writeTx.Commit(); err != nil {
+		t.Fatalf("Failed to commit rename: %v", err)
+	}
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	if _, ok := readTx.Get("user", "u1"); ok {
+		t.Error("Old ID still exists after rename")
+	}
+	user, ok := readTx.Get("user", "u2")
+	if !ok || user.(*UserEntity).Email != "alice@example.com" {
+		t.Fatalf("Renamed entity not found: %v", user)
+	}
+
+	if ids := db.indexes["user"]["Email"]["alice@example.com"]; len(ids) != 1 || ids[0] != "u2" {
+		t.Errorf("Index not updated after rename: %v", ids)
+	}
+
+	for _, id := range []string{"o1", "o2"} {
+		order, _ := readTx.Get("order", id)
+		if order.(*OrderEntity).UserID != "u2" {
+			t.Errorf("Order %s still references old user ID %s", id, order.(*OrderEntity).UserID)
+		}
+	}
+}
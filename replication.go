@@ -0,0 +1,71 @@
+package flexdb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrReplicationFailed is returned by a commit whose changes a required
+// replication sink rejected
+var ErrReplicationFailed = errors.New("replication failed")
+
+// SetReplicationSink registers a function that receives the changes of every
+// commit once they have been written to disk, so they can be forwarded to a
+// replica and applied there with ApplyReplicated. The sink runs while the
+// commit holds the write lock. Unless SetReplicationRequired is enabled, sink
+// errors are ignored and the commit stands. Passing nil removes the sink.
+func (db *Database) SetReplicationSink(sink func(changes []ChangeEvent) error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.replicationSink = sink
+}
+
+// SetReplicationRequired makes a commit fail with ErrReplicationFailed when
+// the replication sink returns an error. The commit is then undone in memory
+// and the previous state is written back to disk.
+func (db *Database) SetReplicationRequired(required bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.replicationRequired = required
+}
+
+// replicate passes committed changes to the replication sink. It returns an
+// error only when replication is required. The caller must hold the write lock.
+func (db *Database) replicate(events []ChangeEvent) error {
+	if db.replicationSink == nil || len(events) == 0 {
+		return nil
+	}
+	err := safeCall("replication sink", func() error { return db.replicationSink(events) })
+	if err == nil || !db.replicationRequired {
+		return nil
+	}
+	return fmt.Errorf("%w: %v", ErrReplicationFailed, err)
+}
+
+// ApplyReplicated commits changes received from another database's
+// replication sink. Entities are stored as given, without running hooks,
+// validators or timestamps, so the replica ends up identical to the source.
+func (db *Database) ApplyReplicated(changes []ChangeEvent) error {
+	tx := db.Transact(false)
+	for _, change := range changes {
+		if tx.changes[change.EntityType] == nil {
+			tx.changes[change.EntityType] = make(map[string]Entity)
+		}
+		switch change.Operation {
+		case OpSet:
+			if isNilEntity(change.Entity) {
+				tx.Rollback()
+				return fmt.Errorf("replicated set of %s/%s has no entity", change.EntityType, change.ID)
+			}
+			tx.changes[change.EntityType][change.ID] = copyEntity(change.Entity)
+		case OpDelete:
+			tx.changes[change.EntityType][change.ID] = nil
+		default:
+			tx.Rollback()
+			return fmt.Errorf("unknown replicated operation %q", change.Operation)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,96 @@
+package flexdb
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"testing"
+)
+
+func TestReplicationSink(t *testing.T) {
+	dbPath := "./test_db.json"
+	replicaPath := "./test_replica.json"
+	defer os.Remove(dbPath)
+	defer os.Remove(replicaPath)
+
+	leader, _ := NewDatabase(dbPath)
+	replica, _ := NewDatabase(replicaPath)
+	leader.Configure("user", CollectionConfig{Timestamps: true})
+
+	var shipped int
+	leader.SetReplicationSink(func(changes []ChangeEvent) error {
+		shipped += len(changes)
+		return replica.ApplyReplicated(changes)
+	})
+
+	tx := leader.Transact(false)
+	tx.Set("user", &UserEntity{ID: "u1", Email: "alice@example.com", Status: "active"})
+	tx.Set("user", &UserEntity{ID: "u2", Email: "bob@example.com", Status: "active"})
+	tx.Set("test", &TestEntity{ID: "t1", Name: "one", Value: 1})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	tx = leader.Transact(false)
+	tx.Set("user", &UserEntity{ID: "u1", Email: "alice@example.com", Status: "disabled"})
+	tx.Delete("user", "u2")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	if shipped != 5 {
+		t.Errorf("Expected 5 replicated changes, got %d", shipped)
+	}
+	for _, entityType := range []string{"user", "test"} {
+		if got, want := snapshotJSON(t, replica, entityType), snapshotJSON(t, leader, entityType); got != want {
+			t.Errorf("Expected the replica to match the leader for %s:\n got %s\nwant %s", entityType, got, want)
+		}
+	}
+}
+
+func TestRequiredReplicationFailureUndoesCommit(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "kept"})
+	tx.Commit()
+
+	errReplica := errors.New("replica unreachable")
+	db.SetReplicationSink(func([]ChangeEvent) error { return errReplica })
+	db.SetReplicationRequired(true)
+
+	tx = db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "rejected"})
+	if err := tx.Commit(); !errors.Is(err, ErrReplicationFailed) {
+		t.Fatalf("Expected ErrReplicationFailed, got %v", err)
+	}
+	if e, _ := db.Get("test", "1"); e.(*TestEntity).Name != "kept" {
+		t.Errorf("Expected the commit to be undone in memory, got %q", e.(*TestEntity).Name)
+	}
+
+	reloaded, _ := NewDatabase(dbPath)
+	if e, _ := reloaded.Get("test", "1"); e.(*GenericEntity).Fields["Name"] != "kept" {
+		t.Errorf("Expected the commit to be undone on disk, got %v", e)
+	}
+
+	// Without the requirement the failure is ignored
+	db.SetReplicationRequired(false)
+	tx = db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "accepted"})
+	if err := tx.Commit(); err != nil {
+		t.Errorf("Expected best-effort replication not to fail the commit, got %v", err)
+	}
+}
+
+// snapshotJSON encodes every entity of a type in ID order
+func snapshotJSON(t *testing.T, db *Database, entityType string) string {
+	entities := db.GetAll(entityType)
+	sort.Slice(entities, func(i, j int) bool { return entities[i].GetID() < entities[j].GetID() })
+	data, err := json.Marshal(entities)
+	if err != nil {
+		t.Fatalf("Failed to encode %s: %v", entityType, err)
+	}
+	return string(data)
+}
@@ -0,0 +1,197 @@
+package flexdb
+
+import (
+	"fmt"
+	"os"
+)
+
+// tombstoneField marks a record in the main file that deletes an entity kept in a rotated file
+const tombstoneField = "_flexdb_deleted"
+
+// WithMaxFileSize caps the size of the database file. When a save would grow
+// the file past maxBytes, the current file is rotated to <path>.1 (shifting
+// older rotations up to <path>.2, <path>.3, ...) and the main file then only
+// holds changes made since, with deletions recorded as tombstones. Loading
+// reads the rotated files oldest first and applies the main file last, so
+// the option must also be set when opening a rotated database. A Storage set
+// with WithStorage must be a RotatingStorage.
+func WithMaxFileSize(maxBytes int64) Option {
+	return func(db *Database) {
+		db.maxFileSize = maxBytes
+	}
+}
+
+// rotatedPath returns the path of the nth rotated file
+func (db *Database) rotatedPath(n int) string {
+	return fmt.Sprintf("%s.%d", db.path, n)
+}
+
+// rotatedCount returns how many rotated files exist
+func (db *Database) rotatedCount() (int, error) {
+	n := 0
+	for {
+		if err := db.statStorage(db.rotatedPath(n + 1)); err != nil {
+			if os.IsNotExist(err) {
+				return n, nil
+			}
+			return 0, err
+		}
+		n++
+	}
+}
+
+// loadRotated loads the rotated files oldest first, then the main file
+func (db *Database) loadRotated() error {
+	count, err := db.rotatedCount()
+	if err != nil {
+		return err
+	}
+	for n := count; n >= 1; n-- {
+		docs, err := db.readFile(db.rotatedPath(n))
+		if err != nil {
+			return err
+		}
+		db.applyDocs(docs)
+	}
+	if count > 0 {
+		db.rotated = copyData(db.data)
+	}
+
+	docs, err := db.readFile(db.path)
+	if err != nil {
+		if os.IsNotExist(err) && count > 0 {
+			return nil
+		}
+		return err
+	}
+	db.lastDelta = db.applyDocs(docs)
+	for entityType, entities := range db.lastDelta {
+		for id := range entities {
+			db.markDirty(entityType, id, false)
+		}
+	}
+	return nil
+}
+
+// rotate shifts the rotated files up by one and moves the main file to
+// <path>.1. The caller must hold the write lock.
+func (db *Database) rotate() error {
+	count, err := db.rotatedCount()
+	if err != nil {
+		return err
+	}
+	for n := count; n >= 1; n-- {
+		if err := db.renameStorage(db.rotatedPath(n), db.rotatedPath(n+1)); err != nil {
+			return err
+		}
+	}
+	if err := db.renameStorage(db.path, db.rotatedPath(1)); err != nil {
+		return err
+	}
+
+	// Everything in the file just rotated is now part of the rotated state
+	if db.rotated == nil {
+		db.rotated = make(map[string]map[string]Entity)
+	}
+	for entityType, entities := range db.lastDelta {
+		if db.rotated[entityType] == nil {
+			db.rotated[entityType] = make(map[string]Entity)
+		}
+		for id, entity := range entities {
+			if entity == nil {
+				delete(db.rotated[entityType], id)
+			} else {
+				db.rotated[entityType][id] = entity
+			}
+		}
+	}
+	db.lastDelta = nil
+
+	// Only writes not saved yet can differ from the rotated files now
+	for entityType, ids := range db.dirty {
+		for id, unsaved := range ids {
+			if !unsaved {
+				delete(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			delete(db.dirty, entityType)
+		}
+	}
+	return nil
+}
+
+// markDirty records that an entity was written since the last rotation, so
+// the main file must hold it. unsaved is set until a save has written it.
+// The caller must hold the write lock.
+func (db *Database) markDirty(entityType, id string, unsaved bool) {
+	if db.dirty == nil {
+		db.dirty = make(map[string]map[string]bool)
+	}
+	if db.dirty[entityType] == nil {
+		db.dirty[entityType] = make(map[string]bool)
+	}
+	db.dirty[entityType][id] = unsaved
+}
+
+// markSaved records that every dirty entity has been written to the main file
+func (db *Database) markSaved() {
+	for _, ids := range db.dirty {
+		for id := range ids {
+			ids[id] = false
+		}
+	}
+}
+
+// persistedData returns what the main file should hold: everything, or once
+// files have been rotated, the entities written or created since plus
+// tombstones for those deleted since. Written entities are tracked by id
+// rather than compared with the rotated state, as an entity changed in place
+// is the same pointer before and after. The caller must hold the lock.
+func (db *Database) persistedData() map[string]map[string]Entity {
+	if db.rotated == nil {
+		return db.data
+	}
+
+	delta := make(map[string]map[string]Entity)
+	add := func(entityType, id string, entity Entity) {
+		if delta[entityType] == nil {
+			delta[entityType] = make(map[string]Entity)
+		}
+		delta[entityType][id] = entity
+	}
+	for entityType, entities := range db.data {
+		for id, entity := range entities {
+			_, rotated := db.rotated[entityType][id]
+			if _, written := db.dirty[entityType][id]; written || !rotated {
+				add(entityType, id, entity)
+			}
+		}
+	}
+	for entityType, entities := range db.rotated {
+		for id := range entities {
+			if _, ok := db.data[entityType][id]; !ok {
+				add(entityType, id, &GenericEntity{ID: id, Fields: map[string]interface{}{tombstoneField: true}})
+			}
+		}
+	}
+	return delta
+}
+
+// isTombstone reports whether a decoded document is a rotation tombstone
+func isTombstone(doc map[string]interface{}) bool {
+	deleted, _ := doc[tombstoneField].(bool)
+	return deleted
+}
+
+// copyData returns a copy of the type and id maps of data, sharing the entities
+func copyData(data map[string]map[string]Entity) map[string]map[string]Entity {
+	cp := make(map[string]map[string]Entity, len(data))
+	for entityType, entities := range data {
+		cp[entityType] = make(map[string]Entity, len(entities))
+		for id, entity := range entities {
+			cp[entityType][id] = entity
+		}
+	}
+	return cp
+}
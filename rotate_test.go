@@ -0,0 +1,117 @@
+package flexdb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestMaxFileSizeRotation(t *testing.T) {
+	dbPath := "./test_db.json"
+	cleanup := func() {
+		os.Remove(dbPath)
+		for n := 1; n <= 20; n++ {
+			os.Remove(fmt.Sprintf("%s.%d", dbPath, n))
+		}
+	}
+	cleanup()
+	defer cleanup()
+
+	const maxSize = 300
+	db, _ := NewDatabase(dbPath, WithMaxFileSize(maxSize))
+	for i := 0; i < 20; i++ {
+		tx := db.Transact(false)
+		tx.Set("test", &TestEntity{ID: fmt.Sprint(i), Name: "rotating", Value: i})
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+	}
+
+	if _, err := os.Stat(dbPath + ".1"); err != nil {
+		t.Fatalf("Expected a rotated file: %v", err)
+	}
+	for _, path := range []string{dbPath, dbPath + ".1", dbPath + ".2"} {
+		if info, err := os.Stat(path); err == nil && info.Size() > maxSize {
+			t.Errorf("Expected %s to stay under %d bytes, got %d", path, maxSize, info.Size())
+		}
+	}
+
+	// Update and delete entities that now live in rotated files
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "updated", Value: 100})
+	tx.Delete("test", "0")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	reloaded, err := NewDatabase(dbPath, WithMaxFileSize(maxSize))
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	readTx := reloaded.Transact(true)
+	defer readTx.Rollback()
+
+	if count := readTx.Count("test"); count != 19 {
+		t.Errorf("Expected 19 entities across rotated files, got %d", count)
+	}
+	if _, ok := readTx.Get("test", "0"); ok {
+		t.Error("Expected the deleted entity to stay deleted after reload")
+	}
+	updated, _ := readTx.Get("test", "1")
+	if name, _ := getField(updated, "Name"); name != "updated" {
+		t.Errorf("Expected the newest version to win, got %v", name)
+	}
+
+	// Writing after a reload keeps the rotated state intact
+	writeTx := reloaded.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "new", Name: "after reload"})
+	writeTx.Commit()
+	again, _ := NewDatabase(dbPath, WithMaxFileSize(maxSize))
+	againTx := again.Transact(true)
+	defer againTx.Rollback()
+	if count := againTx.Count("test"); count != 20 {
+		t.Errorf("Expected 20 entities after writing post-reload, got %d", count)
+	}
+}
+
+func TestMaxFileSizeRotationInPlaceChange(t *testing.T) {
+	dbPath := "./test_db.json"
+	cleanup := func() {
+		os.Remove(dbPath)
+		for n := 1; n <= 20; n++ {
+			os.Remove(fmt.Sprintf("%s.%d", dbPath, n))
+		}
+	}
+	cleanup()
+	defer cleanup()
+
+	db, _ := NewDatabase(dbPath, WithMaxFileSize(300))
+	for i := 0; i < 10; i++ {
+		tx := db.Transact(false)
+		tx.Set("test", &TestEntity{ID: fmt.Sprint(i), Name: "rotating"})
+		tx.Commit()
+	}
+	if _, err := os.Stat(dbPath + ".1"); err != nil {
+		t.Fatalf("Expected a rotated file: %v", err)
+	}
+
+	// Change an entity kept in a rotated file in place and write it back
+	tx := db.Transact(false)
+	entity, _ := tx.Get("test", "0")
+	entity.(*TestEntity).Name = "changed"
+	tx.Set("test", entity)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	reloaded, err := NewDatabase(dbPath, WithMaxFileSize(300))
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	readTx := reloaded.Transact(true)
+	defer readTx.Rollback()
+	got, _ := readTx.Get("test", "0")
+	if name, _ := getField(got, "Name"); name != "changed" {
+		t.Errorf("Expected the in-place change to survive a reload, got %v", name)
+	}
+}
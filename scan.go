@@ -0,0 +1,90 @@
+package flexdb
+
+import "sort"
+
+// ScanIndex returns an iterator over the entities whose field lies in the
+// inclusive range [from, to], in ascending field order with ties broken by
+// ID. A nil bound leaves that end of the range open. Candidates come from
+// the index on field when there is one, plus entities changed in this
+// transaction; without an index every entity of the type is checked.
+//
+// The iterator has the shape of iter.Seq[Entity], so modules on Go 1.23 or
+// later can range over it directly.
+func (tx *Transaction) ScanIndex(entityType, field string, from, to interface{}) func(yield func(Entity) bool) {
+	return func(yield func(Entity) bool) {
+		type match struct {
+			entity Entity
+			value  interface{}
+		}
+		var matches []match
+		for _, entity := range tx.scanCandidates(entityType, field) {
+			value, ok := getField(entity, field)
+			if !ok || !inRange(value, from, to) {
+				continue
+			}
+			matches = append(matches, match{entity, value})
+		}
+		sort.SliceStable(matches, func(i, j int) bool {
+			if c, ok := compareValues(matches[i].value, matches[j].value); ok && c != 0 {
+				return c < 0
+			}
+			return matches[i].entity.GetID() < matches[j].entity.GetID()
+		})
+
+		for _, m := range matches {
+			if !yield(m.entity) {
+				return
+			}
+		}
+	}
+}
+
+// scanCandidates returns the entities that may have field set: those in the
+// index on field together with any changed in this transaction, or every
+// entity of the type when the field is not indexed
+func (tx *Transaction) scanCandidates(entityType, field string) []Entity {
+	entityType = tx.db.typeName(entityType)
+
+	tx.db.mu.RLock()
+	index, ok := tx.db.indexes[entityType][field]
+	var ids []string
+	for _, bucket := range index {
+		ids = append(ids, bucket...)
+	}
+	tx.db.mu.RUnlock()
+	if !ok {
+		return tx.GetAll(entityType)
+	}
+
+	seen := make(map[string]bool, len(ids))
+	for id := range tx.changes[entityType] {
+		ids = append(ids, id)
+	}
+	entities := make([]Entity, 0, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if entity, ok := tx.Get(entityType, id); ok {
+			entities = append(entities, entity)
+		}
+	}
+	return entities
+}
+
+// inRange reports whether value lies within the inclusive bounds, treating a
+// nil bound as open and values that cannot be compared as out of range
+func inRange(value, from, to interface{}) bool {
+	if from != nil {
+		if c, ok := compareValues(value, from); !ok || c < 0 {
+			return false
+		}
+	}
+	if to != nil {
+		if c, ok := compareValues(value, to); !ok || c > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package flexdb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestScanIndex(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.AddIndex("test", "Value")
+	tx := db.Transact(false)
+	for i, v := range []int{50, 10, 30, 20, 40, 30} {
+		tx.Set("test", &TestEntity{ID: fmt.Sprint(i), Value: v})
+	}
+	tx.Commit()
+
+	tx = db.Transact(false)
+	defer tx.Rollback()
+	// Pending changes are scanned too
+	tx.Set("test", &TestEntity{ID: "new", Value: 25})
+	tx.Delete("test", "3")
+
+	var values []int
+	var ids []string
+	tx.ScanIndex("test", "Value", 15, 40)(func(e Entity) bool {
+		values = append(values, e.(*TestEntity).Value)
+		ids = append(ids, e.GetID())
+		return true
+	})
+	if fmt.Sprint(values) != "[25 30 30 40]" || fmt.Sprint(ids) != "[new 2 5 4]" {
+		t.Errorf("Expected values [25 30 30 40] with ids [new 2 5 4], got %v and %v", values, ids)
+	}
+
+	// Stopping early ends the scan
+	count := 0
+	tx.ScanIndex("test", "Value", nil, nil)(func(e Entity) bool {
+		count++
+		return count < 2
+	})
+	if count != 2 {
+		t.Errorf("Expected the scan to stop after 2 entities, got %d", count)
+	}
+}
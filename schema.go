@@ -0,0 +1,223 @@
+package flexdb
+
+import (
+	"fmt"
+	"sort"
+)
+
+// RenameField moves the value stored under oldName to newName on every
+// GenericEntity of the given type, overwriting any existing newName value.
+// Records without oldName are skipped. It is intended for use inside
+// migrations and returns the number of records changed.
+func (tx *Transaction) RenameField(entityType, oldName, newName string) (int, error) {
+	if tx.readOnly {
+		return 0, fmt.Errorf("cannot modify data in a read-only transaction")
+	}
+	if oldName == newName {
+		return 0, nil
+	}
+
+	entities := tx.lookupAll(entityType)
+	sort.Slice(entities, func(i, j int) bool { return entities[i].GetID() < entities[j].GetID() })
+
+	changed := 0
+	for _, entity := range entities {
+		ge, ok := entity.(*GenericEntity)
+		if !ok {
+			continue
+		}
+		value, ok := ge.Fields[oldName]
+		if !ok {
+			continue
+		}
+		renamed := copyEntity(ge).(*GenericEntity)
+		delete(renamed.Fields, oldName)
+		renamed.Fields[newName] = value
+		if err := tx.Set(entityType, renamed); err != nil {
+			return changed, fmt.Errorf("failed to rename %s on %s %s: %w", oldName, entityType, ge.ID, err)
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// SetFieldDefault sets a value returned for field when a GenericEntity of the
+// given type does not have it. Defaults are applied on read and never written
+// back to storage, so records added before a field existed read as if they had it.
+func (db *Database) SetFieldDefault(entityType, field string, value interface{}) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c := db.collectionFor(entityType)
+	if c.defaults == nil {
+		c.defaults = make(map[string]interface{})
+	}
+	c.defaults[field] = value
+}
+
+// applyDefaults fills in configured defaults missing from entity
+func (db *Database) applyDefaults(entityType string, entity Entity) Entity {
+	defaults := db.collectionConfig(entityType).defaults
+	if len(defaults) == 0 {
+		return entity
+	}
+	return withDefaults(entity, defaults)
+}
+
+// withDefaults returns a copy of a GenericEntity with missing fields set from
+// defaults, or the entity itself when nothing is missing
+func withDefaults(entity Entity, defaults map[string]interface{}) Entity {
+	ge, ok := entity.(*GenericEntity)
+	if !ok {
+		return entity
+	}
+	var filled *GenericEntity
+	for field, value := range defaults {
+		if _, ok := ge.Fields[field]; ok {
+			continue
+		}
+		if filled == nil {
+			filled = copyEntity(ge).(*GenericEntity)
+			if filled.Fields == nil {
+				filled.Fields = make(map[string]interface{})
+			}
+		}
+		filled.Fields[field] = value
+	}
+	if filled == nil {
+		return entity
+	}
+	return filled
+}
+
+// FieldType is a declared type hint for a field, e.g. for rendering forms
+type FieldType string
+
+// Field types accepted by SetFieldType
+const (
+	FieldString FieldType = "string"
+	FieldNumber FieldType = "number"
+	FieldBool   FieldType = "bool"
+	FieldDate   FieldType = "date"
+	// FieldRef marks a field holding the ID of another entity; the target
+	// type is taken from AddRelation when one is registered
+	FieldRef FieldType = "ref"
+)
+
+// FieldMeta describes a declared field
+type FieldMeta struct {
+	Name string
+	Type FieldType
+	// Target is the referenced entity type of a relation field
+	Target string
+}
+
+// SetFieldType declares the type of a field. Declarations are metadata only:
+// they are reported by Describe and Schema and are not enforced on write.
+func (db *Database) SetFieldType(entityType, field string, t FieldType) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c := db.collectionFor(entityType)
+	if c.fieldTypes == nil {
+		c.fieldTypes = make(map[string]FieldType)
+	}
+	c.fieldTypes[field] = t
+}
+
+// Describe returns the declared fields of an entity type, ordered by name
+func (tx *Transaction) Describe(entityType string) []FieldMeta {
+	cfg := tx.db.collectionConfig(entityType)
+	fields := make([]FieldMeta, 0, len(cfg.fieldTypes))
+	for name, t := range cfg.fieldTypes {
+		fields = append(fields, FieldMeta{Name: name, Type: t, Target: cfg.relations[name]})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields
+}
+
+// SchemaInfo describes the configuration of every entity type that has any
+type SchemaInfo struct {
+	Types map[string]TypeSchema
+}
+
+// TypeSchema describes the indexes and constraints configured for one entity type
+type TypeSchema struct {
+	// Indexes lists the indexed fields, sorted
+	Indexes []string
+	// Unique lists the fields with a unique constraint
+	Unique []string
+	// Required lists the fields a GenericEntity must have
+	Required []string
+	// Enums maps fields to their allowed values
+	Enums map[string][]interface{}
+	// Relations maps reference fields to the entity type they point at
+	Relations map[string]string
+	// Defaults maps fields to the value read when a record lacks them
+	Defaults map[string]interface{}
+	// FieldTypes maps fields to their declared type
+	FieldTypes map[string]FieldType
+	// Timestamps reports whether CreatedAt and UpdatedAt are maintained
+	Timestamps bool
+	// History reports whether previous versions are kept
+	History bool
+	// AppendOnly reports whether overwrites and deletes are rejected
+	AppendOnly bool
+}
+
+// Schema returns the indexes, constraints and relations configured for each
+// entity type. Internal types used for migrations and history are left out.
+func (db *Database) Schema() SchemaInfo {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	info := SchemaInfo{Types: make(map[string]TypeSchema)}
+	for entityType, indexes := range db.indexes {
+		if isInternalType(entityType) || len(indexes) == 0 {
+			continue
+		}
+		ts := info.Types[entityType]
+		for field := range indexes {
+			ts.Indexes = append(ts.Indexes, field)
+		}
+		sort.Strings(ts.Indexes)
+		info.Types[entityType] = ts
+	}
+	for entityType, c := range db.collections {
+		if isInternalType(entityType) {
+			continue
+		}
+		ts := info.Types[entityType]
+		ts.Unique = append([]string(nil), c.unique...)
+		ts.Required = append([]string(nil), c.required...)
+		if len(c.enums) > 0 {
+			ts.Enums = make(map[string][]interface{}, len(c.enums))
+			for field, values := range c.enums {
+				ts.Enums[field] = append([]interface{}(nil), values...)
+			}
+		}
+		if len(c.relations) > 0 {
+			ts.Relations = make(map[string]string, len(c.relations))
+			for field, target := range c.relations {
+				ts.Relations[field] = target
+			}
+		}
+		if len(c.defaults) > 0 {
+			ts.Defaults = make(map[string]interface{}, len(c.defaults))
+			for field, value := range c.defaults {
+				ts.Defaults[field] = value
+			}
+		}
+		if len(c.fieldTypes) > 0 {
+			ts.FieldTypes = make(map[string]FieldType, len(c.fieldTypes))
+			for field, t := range c.fieldTypes {
+				ts.FieldTypes[field] = t
+			}
+		}
+		ts.Timestamps = c.timestamps
+		ts.History = c.history
+		ts.AppendOnly = c.appendOnly
+		info.Types[entityType] = ts
+	}
+	return info
+}
@@ -0,0 +1,206 @@
+package flexdb
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRenameFieldMigration(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("person", &GenericEntity{ID: "1", Fields: map[string]interface{}{"name": "Alice"}})
+	tx.Set("person", &GenericEntity{ID: "2", Fields: map[string]interface{}{"name": "Bob"}})
+	tx.Set("person", &GenericEntity{ID: "3", Fields: map[string]interface{}{"nickname": "C"}})
+	tx.Commit()
+
+	var renamed int
+	db.AddMigration(1, func(tx *Transaction) error {
+		var err error
+		renamed, err = tx.RenameField("person", "name", "fullName")
+		return err
+	}, func(tx *Transaction) error {
+		_, err := tx.RenameField("person", "fullName", "name")
+		return err
+	})
+
+	if _, err := db.Migrate(1); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if renamed != 2 {
+		t.Errorf("Expected 2 records renamed, got %d", renamed)
+	}
+
+	reloaded, _ := NewDatabase(dbPath)
+	readTx := reloaded.Transact(true)
+	defer readTx.Rollback()
+
+	alice, _ := readTx.Get("person", "1")
+	fields := alice.(*GenericEntity).Fields
+	if fields["fullName"] != "Alice" {
+		t.Errorf("Expected fullName Alice, got %v", fields["fullName"])
+	}
+	if _, ok := fields["name"]; ok {
+		t.Error("Expected name to be removed")
+	}
+
+	carol, _ := readTx.Get("person", "3")
+	if _, ok := carol.(*GenericEntity).Fields["fullName"]; ok {
+		t.Error("Records without the old field should be left alone")
+	}
+
+	if _, err := readTx.RenameField("person", "fullName", "name"); err == nil {
+		t.Error("Expected RenameField to fail in a read-only transaction")
+	}
+}
+
+func TestSetFieldDefault(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("person", &GenericEntity{ID: "old", Fields: map[string]interface{}{"name": "Alice"}})
+	tx.Set("person", &GenericEntity{ID: "new", Fields: map[string]interface{}{"name": "Bob", "role": "admin"}})
+	tx.Commit()
+
+	db.SetFieldDefault("person", "role", "member")
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	old, _ := readTx.Get("person", "old")
+	if role := old.(*GenericEntity).Fields["role"]; role != "member" {
+		t.Errorf("Expected default role member, got %v", role)
+	}
+	current, _ := readTx.Get("person", "new")
+	if role := current.(*GenericEntity).Fields["role"]; role != "admin" {
+		t.Errorf("Expected stored role admin, got %v", role)
+	}
+
+	results, _ := readTx.NewQuery("person").WhereFunc(func(e Entity) bool {
+		role, _ := getField(e, "role")
+		return role == "member"
+	}).Execute()
+	if len(results) != 1 || results[0].GetID() != "old" {
+		t.Errorf("Expected queries to see the default, got %v", results)
+	}
+
+	// Storage is left untouched
+	if _, ok := db.data["person"]["old"].(*GenericEntity).Fields["role"]; ok {
+		t.Error("Default should not be written to storage")
+	}
+}
+
+func TestSetFieldDefaultNotStoredByWrites(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	for _, id := range []string{"patch", "update", "touch", "rename"} {
+		tx.Set("person", &GenericEntity{ID: id, Fields: map[string]interface{}{"name": id}})
+	}
+	tx.Commit()
+	db.SetFieldDefault("person", "role", "member")
+
+	tx = db.Transact(false)
+	if err := tx.ApplyMergePatch("person", "patch", []byte(`{"name":"patched"}`)); err != nil {
+		t.Fatalf("ApplyMergePatch failed: %v", err)
+	}
+	if _, err := tx.UpdateWhere("person", func(e Entity) bool {
+		role, _ := getField(e, "role")
+		return e.GetID() == "update" && role == "member"
+	}, func(e Entity) {
+		setField(e, "name", "updated")
+	}); err != nil {
+		t.Fatalf("UpdateWhere failed: %v", err)
+	}
+	if err := tx.Touch("person", "touch"); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+	if err := tx.Rename("person", "rename", "renamed"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	for _, id := range []string{"patch", "update", "touch", "renamed"} {
+		stored, ok := db.data["person"][id].(*GenericEntity)
+		if !ok {
+			t.Fatalf("Expected %s to be stored", id)
+		}
+		if _, ok := stored.Fields["role"]; ok {
+			t.Errorf("Expected the default not to be stored for %s", id)
+		}
+	}
+	if name := db.data["person"]["update"].(*GenericEntity).Fields["name"]; name != "updated" {
+		t.Errorf("Expected UpdateWhere to match on the default, got name %v", name)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.Configure("user", CollectionConfig{
+		Indexes:    []string{"Status", "Email"},
+		Unique:     []string{"Email"},
+		Enums:      map[string][]interface{}{"Status": {"active", "banned"}},
+		Timestamps: true,
+	})
+	db.AddRelation("order", "UserID", "user")
+	db.EnableHistory("order")
+	db.SetAppendOnly("audit")
+
+	schema := db.Schema()
+	want := map[string]TypeSchema{
+		"user": {
+			Indexes:    []string{"Email", "Status"},
+			Unique:     []string{"Email"},
+			Enums:      map[string][]interface{}{"Status": {"active", "banned"}},
+			Timestamps: true,
+		},
+		"order": {
+			Relations: map[string]string{"UserID": "user"},
+			History:   true,
+		},
+		"audit": {AppendOnly: true},
+	}
+	if !reflect.DeepEqual(schema.Types, want) {
+		t.Errorf("Unexpected schema:\n got %+v\nwant %+v", schema.Types, want)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.SetFieldType("order", "Total", FieldNumber)
+	db.SetFieldType("order", "PlacedAt", FieldDate)
+	db.SetFieldType("order", "UserID", FieldRef)
+	db.AddRelation("order", "UserID", "user")
+
+	tx := db.Transact(true)
+	defer tx.Rollback()
+	want := []FieldMeta{
+		{Name: "PlacedAt", Type: FieldDate},
+		{Name: "Total", Type: FieldNumber},
+		{Name: "UserID", Type: FieldRef, Target: "user"},
+	}
+	if got := tx.Describe("order"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected fields:\n got %+v\nwant %+v", got, want)
+	}
+	if got := tx.Describe("user"); len(got) != 0 {
+		t.Errorf("Expected no declared fields for user, got %+v", got)
+	}
+	if types := db.Schema().Types["order"].FieldTypes; types["Total"] != FieldNumber {
+		t.Errorf("Expected Schema to include field types, got %v", types)
+	}
+}
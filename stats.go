@@ -0,0 +1,169 @@
+package flexdb
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// histogramBounds are the upper bounds of the buckets used for latency histograms
+var histogramBounds = []time.Duration{
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	time.Duration(math.MaxInt64),
+}
+
+// HistogramBucket counts the observations less than or equal to UpperBound
+// and greater than the previous bucket's bound
+type HistogramBucket struct {
+	UpperBound time.Duration
+	Count      int64
+}
+
+// TxStats is a snapshot of transaction activity on a database
+type TxStats struct {
+	OpenReadTx        int
+	OpenWriteTx       int
+	WaitingWriters    int
+	LockWaits         int64
+	LockWaitHistogram []HistogramBucket
+	Commits           int64
+	TotalCommitTime   time.Duration
+	MaxCommitTime     time.Duration
+	CommitHistogram   []HistogramBucket
+}
+
+type txStats struct {
+	mu              sync.Mutex
+	openRead        int64
+	openWrite       int64
+	waitingWriters  int64
+	lockWaits       int64
+	lockWaitBuckets [7]int64
+	commits         int64
+	totalCommitTime time.Duration
+	maxCommitTime   time.Duration
+	commitBuckets   [7]int64
+}
+
+func observe(buckets *[7]int64, d time.Duration) {
+	for i, bound := range histogramBounds {
+		if d <= bound {
+			buckets[i]++
+			return
+		}
+	}
+}
+
+func snapshotHistogram(buckets [7]int64) []HistogramBucket {
+	histogram := make([]HistogramBucket, len(histogramBounds))
+	for i, bound := range histogramBounds {
+		histogram[i] = HistogramBucket{UpperBound: bound, Count: buckets[i]}
+	}
+	return histogram
+}
+
+// txOpened and txClosed use atomics rather than the stats mutex so that
+// concurrent read transactions do not serialize on bookkeeping
+func (s *txStats) txOpened(readOnly bool) {
+	if readOnly {
+		atomic.AddInt64(&s.openRead, 1)
+	} else {
+		atomic.AddInt64(&s.openWrite, 1)
+	}
+}
+
+func (s *txStats) txClosed(readOnly bool) {
+	if readOnly {
+		atomic.AddInt64(&s.openRead, -1)
+	} else {
+		atomic.AddInt64(&s.openWrite, -1)
+	}
+}
+
+func (s *txStats) lockWaited(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lockWaits++
+	observe(&s.lockWaitBuckets, d)
+}
+
+func (s *txStats) committed(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commits++
+	s.totalCommitTime += d
+	if d > s.maxCommitTime {
+		s.maxCommitTime = d
+	}
+	observe(&s.commitBuckets, d)
+}
+
+// lockForWrite acquires the write lock, recording how long the caller had to wait for it
+func (db *Database) lockForWrite() {
+	if db.mu.TryLock() {
+		return
+	}
+
+	atomic.AddInt64(&db.stats.waitingWriters, 1)
+	start := time.Now()
+	db.mu.Lock()
+	atomic.AddInt64(&db.stats.waitingWriters, -1)
+	db.stats.lockWaited(time.Since(start))
+}
+
+// TxStats returns a snapshot of open transactions, lock contention and commit durations
+func (db *Database) TxStats() TxStats {
+	s := &db.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return TxStats{
+		OpenReadTx:        int(atomic.LoadInt64(&s.openRead)),
+		OpenWriteTx:       int(atomic.LoadInt64(&s.openWrite)),
+		WaitingWriters:    int(atomic.LoadInt64(&s.waitingWriters)),
+		LockWaits:         s.lockWaits,
+		LockWaitHistogram: snapshotHistogram(s.lockWaitBuckets),
+		Commits:           s.commits,
+		TotalCommitTime:   s.totalCommitTime,
+		MaxCommitTime:     s.maxCommitTime,
+		CommitHistogram:   snapshotHistogram(s.commitBuckets),
+	}
+}
+
+// CommitMetrics describes the cost of a single commit
+type CommitMetrics struct {
+	// Entities is the number of entities set or deleted
+	Entities int
+	Sets     int
+	Deletes  int
+	// BytesWritten is the size of the file written to disk
+	BytesWritten int64
+	// FullRewrite is false when only the changes since the last file rotation were written
+	FullRewrite bool
+	Duration    time.Duration
+}
+
+// SetCommitObserver registers a callback invoked with the metrics of every
+// successful commit, after the write lock has been released
+func (db *Database) SetCommitObserver(observer func(CommitMetrics)) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.commitObserver = observer
+}
+
+func (db *Database) notifyCommit(metrics CommitMetrics) {
+	db.mu.RLock()
+	observer := db.commitObserver
+	db.mu.RUnlock()
+
+	if observer != nil {
+		observer(metrics)
+	}
+}
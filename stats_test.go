@@ -0,0 +1,109 @@
+package flexdb
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTxStats(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	readTx := db.Transact(true)
+	writeTx := db.Transact(false)
+	stats := db.TxStats()
+	if stats.OpenReadTx != 1 || stats.OpenWriteTx != 1 {
+		t.Errorf("Unexpected open transaction counts: read %d, write %d", stats.OpenReadTx, stats.OpenWriteTx)
+	}
+	readTx.Rollback()
+	writeTx.Rollback()
+
+	writers := make([]*Transaction, 3)
+	for i := range writers {
+		writers[i] = db.Transact(false)
+		writers[i].Set("test", &TestEntity{ID: string(rune('a' + i)), Name: "Writer"})
+	}
+
+	// Hold the write lock so the commits below have to wait for it
+	db.mu.Lock()
+
+	var wg sync.WaitGroup
+	for _, tx := range writers {
+		wg.Add(1)
+		go func(tx *Transaction) {
+			defer wg.Done()
+			if err := tx.Commit(); err != nil {
+				t.Errorf("Commit failed: %v", err)
+			}
+		}(tx)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for db.TxStats().WaitingWriters < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("Writers never started waiting on the lock")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	db.mu.Unlock()
+	wg.Wait()
+
+	stats = db.TxStats()
+	if stats.LockWaits != 3 {
+		t.Errorf("Expected 3 lock waits, got %d", stats.LockWaits)
+	}
+	if stats.Commits != 3 {
+		t.Errorf("Expected 3 commits, got %d", stats.Commits)
+	}
+	if stats.OpenReadTx != 0 || stats.OpenWriteTx != 0 || stats.WaitingWriters != 0 {
+		t.Errorf("Expected no open or waiting transactions, got %+v", stats)
+	}
+
+	var observed int64
+	for _, bucket := range stats.LockWaitHistogram {
+		observed += bucket.Count
+	}
+	if observed != 3 {
+		t.Errorf("Expected 3 observations in lock wait histogram, got %d", observed)
+	}
+}
+
+func TestCommitObserver(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	var metrics []CommitMetrics
+	db.SetCommitObserver(func(m CommitMetrics) {
+		metrics = append(metrics, m)
+	})
+
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1"})
+	tx.Set("test", &TestEntity{ID: "2"})
+	tx.Set("test", &TestEntity{ID: "3"})
+	tx.Commit()
+
+	tx = db.Transact(false)
+	tx.Delete("test", "1")
+	tx.Set("test", &TestEntity{ID: "2", Name: "updated"})
+	tx.Commit()
+
+	if len(metrics) != 2 {
+		t.Fatalf("Expected 2 commit metrics, got %d", len(metrics))
+	}
+	if m := metrics[0]; m.Entities != 3 || m.Sets != 3 || m.Deletes != 0 || !m.FullRewrite {
+		t.Errorf("Unexpected metrics for the first commit: %+v", m)
+	}
+	if m := metrics[1]; m.Entities != 2 || m.Sets != 1 || m.Deletes != 1 {
+		t.Errorf("Unexpected metrics for the second commit: %+v", m)
+	}
+	info, _ := os.Stat(dbPath)
+	if metrics[1].BytesWritten != info.Size() {
+		t.Errorf("Expected %d bytes written, got %d", info.Size(), metrics[1].BytesWritten)
+	}
+}
@@ -0,0 +1,187 @@
+package flexdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// ErrIOTimeout is returned when reading or writing the database file takes
+// longer than the limit set with WithIOTimeout
+var ErrIOTimeout = errors.New("database I/O timed out")
+
+// Storage reads and writes the database file. ReadFile must report a missing
+// file with an error for which os.IsNotExist holds, such as fs.ErrNotExist,
+// and WriteFile must replace the file atomically, flushing it to stable
+// storage when sync is set. File rotation also needs the storage to be a
+// RotatingStorage.
+type Storage interface {
+	ReadFile(path string) ([]byte, error)
+	WriteFile(path string, data []byte, sync bool) error
+}
+
+// RotatingStorage is a Storage that can also look up and rename files, as
+// WithMaxFileSize does to rotate the database file. Stat must report a
+// missing file the way ReadFile does.
+type RotatingStorage interface {
+	Storage
+	Stat(path string) (fs.FileInfo, error)
+	Rename(oldPath, newPath string) error
+}
+
+// fileStorage is the default Storage, backed by the local filesystem
+type fileStorage struct{}
+
+func (fileStorage) ReadFile(path string) ([]byte, error) { return os.ReadFile(path) }
+
+func (fileStorage) WriteFile(path string, data []byte, sync bool) error {
+	return writeFileAtomic(path, data, sync)
+}
+
+func (fileStorage) Stat(path string) (fs.FileInfo, error) { return os.Stat(path) }
+
+func (fileStorage) Rename(oldPath, newPath string) error { return os.Rename(oldPath, newPath) }
+
+// WithStorage replaces the filesystem access used to load and save the database
+func WithStorage(storage Storage) Option {
+	return func(db *Database) {
+		db.storage = storage
+	}
+}
+
+// WithIOTimeout bounds every read and write of the database file. An
+// operation that takes longer fails with ErrIOTimeout so a hung filesystem
+// cannot hold the write lock forever. A write cannot be cancelled, so until
+// a timed out write finishes every later write fails with ErrIOTimeout too;
+// once it does, the file is rewritten from memory if the write left it
+// holding changes that were rolled back.
+func WithIOTimeout(d time.Duration) Option {
+	return func(db *Database) {
+		db.ioTimeout = d
+	}
+}
+
+// readStorage reads a database file within the I/O timeout
+func (db *Database) readStorage(path string) ([]byte, error) {
+	var data []byte
+	err := db.withIOTimeout("reading "+path, func() error {
+		var err error
+		data, err = db.storage.ReadFile(path)
+		return err
+	}, nil)
+	if err != nil {
+		// After a timeout the abandoned read may still be setting data
+		return nil, err
+	}
+	return data, nil
+}
+
+// writeStorage writes a database file within the I/O timeout. The caller must hold the write lock.
+func (db *Database) writeStorage(path string, data []byte, sync bool) error {
+	if db.abandonedWrite {
+		return db.errWriteRunning("writing " + path)
+	}
+	write := func() error {
+		return db.storage.WriteFile(path, data, sync)
+	}
+	return db.withIOTimeout("writing "+path, write, func(done <-chan error) {
+		db.abandonedWrite = true
+		go db.restoreAfter(data, done)
+	})
+}
+
+// restoreAfter waits for a timed out write to finish and lets writes through
+// again. The commit that made the write was rolled back, so if it landed the
+// file is rewritten from memory.
+func (db *Database) restoreAfter(written []byte, done <-chan error) {
+	err := <-done
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.abandonedWrite = false
+	if err != nil {
+		// The write failed, so the file still holds what it did before
+		return
+	}
+	if current, err := db.encode(); err == nil && bytes.Equal(current, written) {
+		return
+	}
+	db.save()
+}
+
+// statStorage checks that a file exists within the I/O timeout. A Storage
+// that cannot look up files is asked to read it instead.
+func (db *Database) statStorage(path string) error {
+	rs, ok := db.storage.(RotatingStorage)
+	if !ok {
+		_, err := db.readStorage(path)
+		return err
+	}
+	return db.withIOTimeout("looking up "+path, func() error {
+		_, err := rs.Stat(path)
+		return err
+	}, nil)
+}
+
+// renameStorage renames a file within the I/O timeout. The storage must be a
+// RotatingStorage, and the caller must hold the write lock.
+func (db *Database) renameStorage(oldPath, newPath string) error {
+	if db.abandonedWrite {
+		return db.errWriteRunning("renaming " + oldPath)
+	}
+	rs := db.storage.(RotatingStorage)
+	rename := func() error {
+		return rs.Rename(oldPath, newPath)
+	}
+	return db.withIOTimeout("renaming "+oldPath, rename, func(done <-chan error) {
+		db.abandonedWrite = true
+		go db.undoRenameAfter(rs, oldPath, newPath, done)
+	})
+}
+
+// undoRenameAfter waits for a timed out rename to finish and moves the file
+// back if it landed, so the rotation that gave up leaves the files as they
+// were. Writes stay refused until the file is back.
+func (db *Database) undoRenameAfter(rs RotatingStorage, oldPath, newPath string, done <-chan error) {
+	if err := <-done; err == nil {
+		rs.Rename(newPath, oldPath)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.abandonedWrite = false
+}
+
+// errWriteRunning is returned for a write refused because a timed out write is still running
+func (db *Database) errWriteRunning(op string) error {
+	return fmt.Errorf("%w: %s while an earlier write is still running", ErrIOTimeout, op)
+}
+
+// withIOTimeout runs fn, giving up with ErrIOTimeout once the configured
+// timeout passes. When it gives up, abandoned, if set, is handed the channel
+// fn's result will arrive on.
+func (db *Database) withIOTimeout(op string, fn func() error, abandoned func(<-chan error)) error {
+	if db.ioTimeout <= 0 {
+		return fn()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	timer := time.NewTimer(db.ioTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		if abandoned != nil {
+			abandoned(done)
+		}
+		return fmt.Errorf("%w: %s after %v", ErrIOTimeout, op, db.ioTimeout)
+	}
+}
@@ -0,0 +1,234 @@
+package flexdb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// slowStorage is an in-memory Storage whose reads and writes can be delayed
+type slowStorage struct {
+	mu         sync.Mutex
+	files      map[string][]byte
+	readDelay  time.Duration
+	writeDelay time.Duration
+	// renameDelay delays renames on their own
+	renameDelay time.Duration
+	// writeErr, when set, fails every write
+	writeErr error
+}
+
+func (s *slowStorage) ReadFile(path string) ([]byte, error) {
+	time.Sleep(s.readDelay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[path]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return data, nil
+}
+
+func (s *slowStorage) WriteFile(path string, data []byte, sync bool) error {
+	time.Sleep(s.writeDelay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writeErr != nil {
+		return s.writeErr
+	}
+	s.files[path] = data
+	return nil
+}
+
+func (s *slowStorage) Stat(path string) (fs.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[path]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return fstest.MapFS{path: &fstest.MapFile{Data: data}}.Stat(path)
+}
+
+func (s *slowStorage) Rename(oldPath, newPath string) error {
+	time.Sleep(s.renameDelay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[oldPath]
+	if !ok {
+		return fs.ErrNotExist
+	}
+	delete(s.files, oldPath)
+	s.files[newPath] = data
+	return nil
+}
+
+// snapshot returns a copy of the stored files
+func (s *slowStorage) snapshot() map[string][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := make(map[string][]byte, len(s.files))
+	for path, data := range s.files {
+		files[path] = data
+	}
+	return files
+}
+
+func TestCustomStorage(t *testing.T) {
+	storage := &slowStorage{files: make(map[string][]byte)}
+	db, err := NewDatabase("memory.json", WithStorage(storage))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "stored"})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	reloaded, err := NewDatabase("memory.json", WithStorage(storage))
+	if err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if _, ok := reloaded.Get("test", "1"); !ok {
+		t.Error("Expected the entity to be read back from the storage")
+	}
+}
+
+func TestIOTimeout(t *testing.T) {
+	storage := &slowStorage{files: make(map[string][]byte), writeDelay: 200 * time.Millisecond}
+	db, err := NewDatabase("memory.json", WithStorage(storage), WithIOTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1"})
+	start := time.Now()
+	if err := tx.Commit(); !errors.Is(err, ErrIOTimeout) {
+		t.Fatalf("Expected ErrIOTimeout from a slow save, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("Expected the commit to give up at the timeout, took %v", elapsed)
+	}
+	if _, ok := db.Get("test", "1"); ok {
+		t.Error("Expected the timed out commit not to be applied")
+	}
+
+	storage.readDelay = 200 * time.Millisecond
+	if _, err := NewDatabase("memory.json", WithStorage(storage), WithIOTimeout(20*time.Millisecond)); !errors.Is(err, ErrIOTimeout) {
+		t.Errorf("Expected ErrIOTimeout from a slow load, got %v", err)
+	}
+}
+
+func TestIOTimeoutAbandonedWrite(t *testing.T) {
+	storage := &slowStorage{files: make(map[string][]byte), writeDelay: 100 * time.Millisecond}
+	db, err := NewDatabase("memory.json", WithStorage(storage), WithIOTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1"})
+	if err := tx.Commit(); !errors.Is(err, ErrIOTimeout) {
+		t.Fatalf("Expected ErrIOTimeout from a slow save, got %v", err)
+	}
+
+	// The first write is still running, so the next one must not start
+	tx = db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "2"})
+	start := time.Now()
+	if err := tx.Commit(); !errors.Is(err, ErrIOTimeout) {
+		t.Fatalf("Expected ErrIOTimeout while a timed out write is running, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 15*time.Millisecond {
+		t.Errorf("Expected the write to be refused without waiting, took %v", elapsed)
+	}
+
+	// Wait for the abandoned write and the rewrite that follows it
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		db.mu.Lock()
+		busy := db.abandonedWrite
+		db.mu.Unlock()
+		if !busy {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the abandoned write to finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	reopened, err := NewDatabase("memory.json", WithStorage(&slowStorage{files: storage.snapshot()}))
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	if _, ok := reopened.Get("test", "1"); ok {
+		t.Error("Expected the rolled back entity to be gone from the file")
+	}
+}
+
+func TestStorageRotation(t *testing.T) {
+	storage := &slowStorage{files: make(map[string][]byte)}
+	db, err := NewDatabase("memory.json", WithStorage(storage), WithMaxFileSize(300))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		tx := db.Transact(false)
+		tx.Set("test", &TestEntity{ID: fmt.Sprint(i), Name: "rotating"})
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+	}
+	if _, ok := storage.snapshot()["memory.json.1"]; !ok {
+		t.Fatal("Expected the file to be rotated within the storage")
+	}
+
+	reloaded, err := NewDatabase("memory.json", WithStorage(storage), WithMaxFileSize(300))
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if got := len(reloaded.data["test"]); got != 10 {
+		t.Errorf("Expected 10 entities after reload, got %d", got)
+	}
+
+	// A rotation whose rename times out is undone once the rename lands
+	db.ioTimeout = 20 * time.Millisecond
+	storage.renameDelay = 100 * time.Millisecond
+	var before map[string][]byte
+	for i := 10; ; i++ {
+		before = storage.snapshot()
+		tx := db.Transact(false)
+		tx.Set("test", &TestEntity{ID: fmt.Sprint(i), Name: "rotating"})
+		if err := tx.Commit(); err != nil {
+			if !errors.Is(err, ErrIOTimeout) || !strings.Contains(err.Error(), "renaming") {
+				t.Fatalf("Expected a rename to time out, got %v", err)
+			}
+			break
+		}
+	}
+	time.Sleep(300 * time.Millisecond)
+	db.mu.Lock()
+	busy := db.abandonedWrite
+	db.mu.Unlock()
+	if busy {
+		t.Fatal("Expected the timed out rename to have finished")
+	}
+	if !reflect.DeepEqual(storage.snapshot(), before) {
+		t.Error("Expected the files to be left as they were before the rotation")
+	}
+
+	// A Storage that cannot rename files cannot rotate them
+	plain := struct{ Storage }{storage}
+	if _, err := NewDatabase("memory.json", WithStorage(plain), WithMaxFileSize(300)); err == nil {
+		t.Error("Expected WithMaxFileSize to be rejected for a Storage without Rename")
+	}
+}
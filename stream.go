@@ -0,0 +1,38 @@
+package flexdb
+
+import "context"
+
+// Stream runs the query and emits the matching entities on the returned
+// channel, closing it once every result has been sent or ctx is cancelled.
+// A query error or the context's error is delivered on the error channel,
+// which is closed alongside the entity channel.
+func (q *Query) Stream(ctx context.Context) (<-chan Entity, <-chan error) {
+	out := make(chan Entity)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+		defer close(errs)
+
+		results, err := q.Execute()
+		if err != nil {
+			errs <- err
+			return
+		}
+		for _, entity := range results {
+			// Check first so a cancelled context wins over a ready receiver
+			if err := ctx.Err(); err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case out <- entity:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return out, errs
+}
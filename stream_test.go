@@ -0,0 +1,61 @@
+package flexdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestQueryStream(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	for i := 0; i < 10; i++ {
+		tx.Set("test", &TestEntity{ID: fmt.Sprint(i), Value: i})
+	}
+	tx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	entities, errs := readTx.NewQuery("test").OrderBy("Value", false).Stream(context.Background())
+	count := 0
+	for entity := range entities {
+		if entity.(*TestEntity).Value != count {
+			t.Errorf("Expected entities in order, got %v at %d", entity, count)
+		}
+		count++
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if count != 10 {
+		t.Errorf("Expected 10 entities, got %d", count)
+	}
+
+	// Cancelling mid-stream stops delivery and reports the context error
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entities, errs = readTx.NewQuery("test").Stream(ctx)
+	received := 0
+	for range entities {
+		received++
+		if received == 3 {
+			cancel()
+			break
+		}
+	}
+	for range entities {
+		received++
+	}
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if received >= 10 {
+		t.Errorf("Expected cancellation to stop the stream early, received %d", received)
+	}
+}
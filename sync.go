@@ -0,0 +1,123 @@
+package flexdb
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type syncKind int
+
+const (
+	syncAlways syncKind = iota
+	syncInterval
+	syncNever
+)
+
+// SyncMode controls how often saves are flushed to stable storage with fsync
+type SyncMode struct {
+	kind     syncKind
+	interval time.Duration
+}
+
+var (
+	// SyncAlways fsyncs the database file on every commit. This is the default.
+	SyncAlways = SyncMode{kind: syncAlways}
+	// SyncNever leaves flushing to the operating system
+	SyncNever = SyncMode{kind: syncNever}
+)
+
+// SyncInterval fsyncs at most once every d. Commits in between are written
+// but may be lost on power failure until the next synced commit.
+func SyncInterval(d time.Duration) SyncMode {
+	return SyncMode{kind: syncInterval, interval: d}
+}
+
+// WithSyncMode sets how often commits are flushed to disk
+func WithSyncMode(mode SyncMode) Option {
+	return func(db *Database) {
+		db.syncMode = mode
+	}
+}
+
+// WithSaveRetry retries a failed write of the database file up to attempts
+// more times, sleeping backoff before the first retry and doubling it after
+// each one. It rides out transient storage errors such as a network
+// filesystem hiccup; the write lock is held while waiting.
+func WithSaveRetry(attempts int, backoff time.Duration) Option {
+	return func(db *Database) {
+		db.saveRetries = attempts
+		db.saveBackoff = backoff
+	}
+}
+
+// writeWithRetry writes the database file, retrying as configured with WithSaveRetry
+func (db *Database) writeWithRetry(data []byte, sync bool) error {
+	err := db.writeStorage(db.path, data, sync)
+	backoff := db.saveBackoff
+	for attempt := 0; err != nil && attempt < db.saveRetries; attempt++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		err = db.writeStorage(db.path, data, sync)
+	}
+	return err
+}
+
+// shouldSync reports whether the next save should be fsynced. The caller must hold the write lock.
+func (db *Database) shouldSync(now time.Time) bool {
+	switch db.syncMode.kind {
+	case syncNever:
+		return false
+	case syncInterval:
+		if now.Sub(db.lastSync) < db.syncMode.interval {
+			return false
+		}
+		db.lastSync = now
+	}
+	return true
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place so readers never observe a partially written file. When sync is
+// set the file and its directory are flushed to stable storage.
+func writeFileAtomic(path string, data []byte, sync bool) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if sync {
+		if err := tmp.Sync(); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	if sync {
+		// Persist the rename itself; not every platform supports syncing directories
+		if d, err := os.Open(dir); err == nil {
+			d.Sync()
+			d.Close()
+		}
+	}
+	return nil
+}
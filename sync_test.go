@@ -0,0 +1,151 @@
+package flexdb
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSyncModes(t *testing.T) {
+	now := time.Now()
+
+	always := &Database{syncMode: SyncAlways}
+	if !always.shouldSync(now) || !always.shouldSync(now) {
+		t.Error("SyncAlways should sync every save")
+	}
+
+	never := &Database{syncMode: SyncNever}
+	if never.shouldSync(now) {
+		t.Error("SyncNever should never sync")
+	}
+
+	interval := &Database{syncMode: SyncInterval(time.Second)}
+	if !interval.shouldSync(now) {
+		t.Error("SyncInterval should sync the first save")
+	}
+	if interval.shouldSync(now.Add(500 * time.Millisecond)) {
+		t.Error("SyncInterval should skip saves within the interval")
+	}
+	if !interval.shouldSync(now.Add(time.Second)) {
+		t.Error("SyncInterval should sync once the interval has passed")
+	}
+
+	// Every mode still writes the data
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+	for _, mode := range []SyncMode{SyncAlways, SyncInterval(time.Hour), SyncNever} {
+		os.Remove(dbPath)
+		db, _ := NewDatabase(dbPath, WithSyncMode(mode))
+		writeTx := db.Transact(false)
+		writeTx.Set("test", &TestEntity{ID: "1", Name: "Synced"})
+		if err := writeTx.Commit(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+		reloaded, _ := NewDatabase(dbPath)
+		readTx := reloaded.Transact(true)
+		if _, ok := readTx.Get("test", "1"); !ok {
+			t.Errorf("Entity not persisted with sync mode %+v", mode)
+		}
+		readTx.Rollback()
+	}
+}
+
+func BenchmarkCommitSyncModes(b *testing.B) {
+	modes := map[string]SyncMode{
+		"always":   SyncAlways,
+		"interval": SyncInterval(100 * time.Millisecond),
+		"never":    SyncNever,
+	}
+	for name, mode := range modes {
+		b.Run(name, func(b *testing.B) {
+			dbPath := "./bench_db.json"
+			defer os.Remove(dbPath)
+
+			db, _ := NewDatabase(dbPath, WithSyncMode(mode))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tx := db.Transact(false)
+				tx.Set("bench", &TestEntity{ID: strconv.Itoa(i % 100), Value: i})
+				if err := tx.Commit(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestCommitSaveFailureLeavesMemoryUnchanged(t *testing.T) {
+	// A regular file where the database directory should be makes every write fail
+	blocker := "./test_blocked"
+	dbPath := blocker + "/db.json"
+	defer os.RemoveAll(blocker)
+
+	db, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.AddIndex("test", "Name")
+	db.EnableHistory("test")
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "before"})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	os.RemoveAll(blocker)
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatalf("Failed to create blocker: %v", err)
+	}
+
+	tx = db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "after"})
+	tx.Set("test", &TestEntity{ID: "2", Name: "new"})
+	if err := tx.Commit(); err == nil {
+		t.Fatal("Expected the commit to fail")
+	}
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+	if e, _ := readTx.Get("test", "1"); e.(*TestEntity).Name != "before" {
+		t.Errorf("Expected the pre-commit value, got %q", e.(*TestEntity).Name)
+	}
+	if _, ok := readTx.Get("test", "2"); ok {
+		t.Error("Expected the new entity to be absent")
+	}
+	index := db.IndexEntries("test", "Name")
+	if len(index["before"]) != 1 || len(index["after"]) != 0 || len(index["new"]) != 0 {
+		t.Errorf("Expected the index to be unchanged, got %v", index)
+	}
+	if versions := readTx.Count(historyType("test")); versions != 1 {
+		t.Errorf("Expected no history to be recorded, got %d versions", versions)
+	}
+}
+
+func TestSaveRetry(t *testing.T) {
+	blocker := "./test_blocked"
+	dbPath := blocker + "/db.json"
+	defer os.RemoveAll(blocker)
+
+	db, err := NewDatabase(dbPath, WithSaveRetry(5, 20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatalf("Failed to create blocker: %v", err)
+	}
+	// Clear the fault while the commit is backing off
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		os.Remove(blocker)
+	}()
+
+	tx := db.Transact(false)
+	tx.Set("test", &TestEntity{ID: "1", Name: "retried"})
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Expected the commit to succeed after retrying, got %v", err)
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		t.Errorf("Expected the database file to be written: %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package flexdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Collection provides typed read access to the entities of a single type.
+// T must be a pointer to a struct implementing Entity, e.g. *Todo.
+type Collection[T Entity] struct {
+	db         *Database
+	entityType string
+}
+
+// NewCollection returns a typed view of an entity type
+func NewCollection[T Entity](db *Database, entityType string) *Collection[T] {
+	return &Collection[T]{db: db, entityType: entityType}
+}
+
+// Get retrieves an entity by ID as T
+func (c *Collection[T]) Get(id string) (T, bool) {
+	tx := c.db.Transact(true)
+	defer tx.Rollback()
+
+	var zero T
+	entity, ok := tx.Get(c.entityType, id)
+	if !ok {
+		return zero, false
+	}
+	typed, err := decodeEntity[T](entity)
+	if err != nil {
+		return zero, false
+	}
+	return typed, true
+}
+
+// GetMany retrieves the entities with the given IDs as T. IDs that do not
+// exist, or cannot be decoded into T, are left out of the result.
+func (c *Collection[T]) GetMany(ids []string) map[string]T {
+	tx := c.db.Transact(true)
+	defer tx.Rollback()
+
+	results := make(map[string]T, len(ids))
+	for id, entity := range tx.GetMany(c.entityType, ids) {
+		if typed, err := decodeEntity[T](entity); err == nil {
+			results[id] = typed
+		}
+	}
+	return results
+}
+
+// GetMany retrieves several entities of a type by ID. Missing IDs are left out of the result.
+func (tx *Transaction) GetMany(entityType string, ids []string) map[string]Entity {
+	results := make(map[string]Entity, len(ids))
+	for _, id := range ids {
+		if entity, ok := tx.Get(entityType, id); ok && entity != nil {
+			results[id] = entity
+		}
+	}
+	return results
+}
+
+// EntityRef identifies an entity by type and ID
+type EntityRef struct {
+	Type string
+	ID   string
+}
+
+// MultiGet retrieves entities of any type in one pass over committed data,
+// taking the read lock once. Pending changes in the transaction take
+// precedence and missing refs are left out of the result.
+func (tx *Transaction) MultiGet(refs []EntityRef) map[EntityRef]Entity {
+	results := make(map[EntityRef]Entity, len(refs))
+	var committed []EntityRef
+	for _, ref := range refs {
+		if entity, ok := tx.changes[tx.db.typeName(ref.Type)][ref.ID]; ok {
+			if entity != nil {
+				results[ref] = entity
+			}
+			continue
+		}
+		committed = append(committed, ref)
+	}
+
+	var missing []EntityRef
+	tx.db.mu.RLock()
+	for _, ref := range committed {
+		entityType := tx.db.typeName(ref.Type)
+		if entity, ok := tx.db.data[entityType][ref.ID]; ok {
+			results[ref] = entity
+		} else if c := tx.db.collections[entityType]; c != nil && c.loader != nil {
+			missing = append(missing, ref)
+		}
+	}
+	tx.db.mu.RUnlock()
+
+	// Refs with a read-through loader fall back to Get, which loads and stores them
+	for _, ref := range missing {
+		if entity, ok := tx.Get(ref.Type, ref.ID); ok {
+			results[ref] = entity
+		}
+	}
+	for ref, entity := range results {
+		results[ref] = tx.db.applyDefaults(ref.Type, entity)
+	}
+	return results
+}
+
+// decodeEntity converts an entity into T, decoding GenericEntity values loaded
+// from disk into a fresh T via a JSON round trip
+func decodeEntity[T Entity](entity Entity) (T, error) {
+	var zero T
+	if typed, ok := entity.(T); ok {
+		return typed, nil
+	}
+
+	t := reflect.TypeOf(zero)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return zero, fmt.Errorf("cannot decode entity into %T: type must be a pointer", zero)
+	}
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return zero, err
+	}
+	typed := reflect.New(t.Elem()).Interface().(T)
+	if err := json.Unmarshal(data, typed); err != nil {
+		return zero, err
+	}
+	return typed, nil
+}
+
+// Scan runs the query and appends the results to dest, which must be a
+// pointer to a slice of structs or struct pointers. Entities that are not
+// already of the element type are decoded via a JSON round trip.
+func (q *Query) Scan(dest interface{}) error {
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.IsNil() || destValue.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("scan destination must be a pointer to a slice, got %T", dest)
+	}
+	slice := destValue.Elem()
+	elemType := slice.Type().Elem()
+
+	results, err := q.Execute()
+	if err != nil {
+		return err
+	}
+
+	for _, entity := range results {
+		ev := reflect.ValueOf(entity)
+		if ev.Type().AssignableTo(elemType) {
+			slice = reflect.Append(slice, ev)
+			continue
+		}
+
+		data, err := json.Marshal(entity)
+		if err != nil {
+			return err
+		}
+		var target reflect.Value
+		if elemType.Kind() == reflect.Ptr {
+			target = reflect.New(elemType.Elem())
+		} else {
+			target = reflect.New(elemType)
+		}
+		if err := json.Unmarshal(data, target.Interface()); err != nil {
+			return fmt.Errorf("failed to decode entity %s: %w", entity.GetID(), err)
+		}
+		if elemType.Kind() != reflect.Ptr {
+			target = target.Elem()
+		}
+		slice = reflect.Append(slice, target)
+	}
+
+	destValue.Elem().Set(slice)
+	return nil
+}
@@ -0,0 +1,119 @@
+package flexdb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCollectionGetMany(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	writeTx := db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "1", Name: "Alice", Value: 30})
+	writeTx.Set("test", &TestEntity{ID: "2", Name: "Bob", Value: 25})
+	writeTx.Set("test", &TestEntity{ID: "3", Name: "Charlie", Value: 35})
+	writeTx.Commit()
+
+	// Reload so the entities come back as GenericEntity values
+	db, err := NewDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reload database: %v", err)
+	}
+
+	users := NewCollection[*TestEntity](db, "test")
+	results := users.GetMany([]string{"1", "3", "missing"})
+
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results["1"].Name != "Alice" || results["1"].Value != 30 {
+		t.Errorf("Unexpected entity 1: %+v", results["1"])
+	}
+	if results["3"].Name != "Charlie" || results["3"].Value != 35 {
+		t.Errorf("Unexpected entity 3: %+v", results["3"])
+	}
+
+	if bob, ok := users.Get("2"); !ok || bob.Name != "Bob" {
+		t.Errorf("Unexpected entity 2: %+v", bob)
+	}
+}
+
+func TestQueryScan(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	writeTx := db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "1", Name: "Alice", Value: 30})
+	writeTx.Set("test", &GenericEntity{ID: "2", Fields: map[string]interface{}{"ID": "2", "Name": "Bob", "Value": 25.0}})
+	writeTx.Set("test", &TestEntity{ID: "3", Name: "Charlie", Value: 35})
+	writeTx.Commit()
+
+	readTx := db.Transact(true)
+	defer readTx.Rollback()
+
+	var ptrs []*TestEntity
+	if err := readTx.NewQuery("test").WhereIn("ID", []interface{}{"1", "2"}).Scan(&ptrs); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(ptrs) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(ptrs))
+	}
+	for _, e := range ptrs {
+		if (e.ID == "1" && e.Name != "Alice") || (e.ID == "2" && (e.Name != "Bob" || e.Value != 25)) {
+			t.Errorf("Unexpected scanned entity: %+v", e)
+		}
+	}
+
+	var values []TestEntity
+	if err := readTx.NewQuery("test").Scan(&values); err != nil {
+		t.Fatalf("Scan into value slice failed: %v", err)
+	}
+	if len(values) != 3 {
+		t.Errorf("Expected 3 results, got %d", len(values))
+	}
+
+	if err := readTx.NewQuery("test").Scan(values); err == nil {
+		t.Error("Expected an error when scanning into a non-pointer")
+	}
+}
+
+func TestMultiGet(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	tx := db.Transact(false)
+	tx.Set("user", &UserEntity{ID: "u1", Email: "a@example.com"})
+	tx.Set("order", &OrderEntity{ID: "o1", UserID: "u1"})
+	tx.Set("order", &OrderEntity{ID: "o2", UserID: "u1"})
+	tx.Commit()
+
+	readTx := db.Transact(false)
+	defer readTx.Rollback()
+	readTx.Delete("order", "o2")
+
+	refs := []EntityRef{
+		{Type: "user", ID: "u1"},
+		{Type: "order", ID: "o1"},
+		{Type: "order", ID: "o2"},
+		{Type: "order", ID: "missing"},
+	}
+	results := readTx.MultiGet(refs)
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if user, ok := results[EntityRef{"user", "u1"}].(*UserEntity); !ok || user.Email != "a@example.com" {
+		t.Errorf("Unexpected user: %v", results[EntityRef{"user", "u1"}])
+	}
+	if _, ok := results[EntityRef{"order", "o1"}]; !ok {
+		t.Error("Expected order o1")
+	}
+	if _, ok := results[EntityRef{"order", "o2"}]; ok {
+		t.Error("Expected o2, deleted in the transaction, to be missing")
+	}
+}
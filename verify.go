@@ -0,0 +1,107 @@
+package flexdb
+
+import (
+	"fmt"
+	"sort"
+)
+
+// IntegrityIssue describes a single inconsistency found by Verify
+type IntegrityIssue struct {
+	EntityType string
+	ID         string
+	Field      string
+	Message    string
+}
+
+func (i IntegrityIssue) String() string {
+	if i.Field != "" {
+		return fmt.Sprintf("%s/%s (%s): %s", i.EntityType, i.ID, i.Field, i.Message)
+	}
+	return fmt.Sprintf("%s/%s: %s", i.EntityType, i.ID, i.Message)
+}
+
+// Verify checks the committed data, indexes and relations for consistency
+// and reports every issue found. It does not modify the database.
+func (db *Database) Verify() []IntegrityIssue {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var issues []IntegrityIssue
+	report := func(entityType, id, field, format string, args ...interface{}) {
+		issues = append(issues, IntegrityIssue{
+			EntityType: entityType,
+			ID:         id,
+			Field:      field,
+			Message:    fmt.Sprintf(format, args...),
+		})
+	}
+
+	for entityType, entities := range db.data {
+		for id, entity := range entities {
+			if isNilEntity(entity) {
+				report(entityType, id, "", "orphaned tombstone stored in data")
+				continue
+			}
+			if entity.GetID() != id {
+				report(entityType, id, "", "stored under a different ID than its own (%s)", entity.GetID())
+			}
+		}
+	}
+
+	for entityType, fields := range db.indexes {
+		for field, index := range fields {
+			keys := make([]string, 0, len(index))
+			for key := range index {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			indexed := make(map[string]string)
+			for _, key := range keys {
+				for _, id := range index[key] {
+					if previous, seen := indexed[id]; seen {
+						report(entityType, id, field, "indexed more than once (under %q and %q)", previous, key)
+						continue
+					}
+					indexed[id] = key
+
+					entity, ok := db.data[entityType][id]
+					if !ok || isNilEntity(entity) {
+						report(entityType, id, field, "index references missing entity")
+						continue
+					}
+					if actual, ok := indexKey(entity, field); !ok || actual != key {
+						report(entityType, id, field, "indexed under %q but value is %q", key, actual)
+					}
+				}
+			}
+			for id, entity := range db.data[entityType] {
+				if _, ok := indexed[id]; ok || isNilEntity(entity) {
+					continue
+				}
+				if _, ok := indexKey(entity, field); ok {
+					report(entityType, id, field, "entity missing from index")
+				}
+			}
+		}
+	}
+
+	for entityType, c := range db.collections {
+		for field, targetType := range c.relations {
+			for id, entity := range db.data[entityType] {
+				value, ok := getField(entity, field)
+				if !ok || isZeroValue(value) {
+					continue
+				}
+				if target, ok := db.data[targetType][fmt.Sprint(value)]; !ok || isNilEntity(target) {
+					report(entityType, id, field, "references missing %s %v", targetType, value)
+				}
+			}
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		return issues[i].String() < issues[j].String()
+	})
+	return issues
+}
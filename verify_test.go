@@ -0,0 +1,54 @@
+package flexdb
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+	db.AddIndex("test", "Name")
+	db.AddRelation("order", "UserID", "user")
+
+	writeTx := db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "1", Name: "Alice", Value: 30})
+	writeTx.Set("test", &TestEntity{ID: "2", Name: "Bob", Value: 25})
+	writeTx.Set("user", &UserEntity{ID: "u1"})
+	writeTx.Set("order", &OrderEntity{ID: "o1", UserID: "u1"})
+	writeTx.Commit()
+
+	if issues := db.Verify(); len(issues) != 0 {
+		t.Fatalf("Expected a consistent database, got %v", issues)
+	}
+
+	// Corrupt the index and data in memory
+	db.mu.Lock()
+	db.indexes["test"]["Name"]["Ghost"] = []string{"999"}
+	db.indexes["test"]["Name"]["Bob"] = append(db.indexes["test"]["Name"]["Bob"], "1")
+	delete(db.data["user"], "u1")
+	db.mu.Unlock()
+
+	issues := db.Verify()
+	if len(issues) != 3 {
+		t.Fatalf("Expected 3 issues, got %d: %v", len(issues), issues)
+	}
+
+	var report []string
+	for _, issue := range issues {
+		report = append(report, issue.String())
+	}
+	joined := strings.Join(report, "\n")
+	for _, want := range []string{
+		"test/999 (Name): index references missing entity",
+		"test/1 (Name): indexed more than once",
+		"order/o1 (UserID): references missing user u1",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("Expected issue %q in report:\n%s", want, joined)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package flexdb
+
+// watchBufferSize is the number of events buffered per subscriber before further events are dropped
+const watchBufferSize = 64
+
+const (
+	// OpSet identifies a change that created or updated an entity
+	OpSet = "set"
+	// OpDelete identifies a change that removed an entity
+	OpDelete = "delete"
+)
+
+// ChangeEvent describes a committed change to a single entity
+type ChangeEvent struct {
+	EntityType string
+	ID         string
+	Operation  string
+	Entity     Entity
+}
+
+type watcher struct {
+	entityType string
+	id         string
+	ch         chan ChangeEvent
+}
+
+func (w *watcher) matches(ev ChangeEvent) bool {
+	return w.entityType == ev.EntityType && (w.id == "" || w.id == ev.ID)
+}
+
+// WatchKey returns a channel receiving committed changes to a single entity
+func (db *Database) WatchKey(entityType, id string) <-chan ChangeEvent {
+	return db.watch(db.typeName(entityType), id)
+}
+
+// WatchType returns a channel receiving committed changes to any entity of a type
+func (db *Database) WatchType(entityType string) <-chan ChangeEvent {
+	return db.watch(db.typeName(entityType), "")
+}
+
+// Unwatch stops delivering events to a channel returned by WatchKey or WatchType and closes it
+func (db *Database) Unwatch(ch <-chan ChangeEvent) {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	for i, w := range db.watchers {
+		if w.ch == ch {
+			close(w.ch)
+			db.watchers = append(db.watchers[:i], db.watchers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (db *Database) watch(entityType, id string) <-chan ChangeEvent {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	w := &watcher{entityType: entityType, id: id, ch: make(chan ChangeEvent, watchBufferSize)}
+	db.watchers = append(db.watchers, w)
+	return w.ch
+}
+
+// publish fans committed events out to matching watchers. Events are dropped
+// for subscribers whose buffer is full so a slow reader never blocks a commit.
+func (db *Database) publish(events []ChangeEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	for _, ev := range events {
+		for _, w := range db.watchers {
+			if !w.matches(ev) {
+				continue
+			}
+			select {
+			case w.ch <- ev:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package flexdb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestWatch(t *testing.T) {
+	dbPath := "./test_db.json"
+	defer os.Remove(dbPath)
+
+	db, _ := NewDatabase(dbPath)
+
+	keyCh := db.WatchKey("test", "1")
+	typeCh := db.WatchType("test")
+
+	// Changes to other ids and types are not delivered to the key watcher
+	writeTx := db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "2", Name: "Other", Value: 2})
+	writeTx.Set("other", &TestEntity{ID: "1", Name: "Other type", Value: 1})
+	writeTx.Commit()
+
+	select {
+	case ev := <-keyCh:
+		t.Fatalf("Unexpected event for unrelated change: %+v", ev)
+	default:
+	}
+
+	select {
+	case ev := <-typeCh:
+		if ev.ID != "2" || ev.Operation != OpSet {
+			t.Errorf("Unexpected type event: %+v", ev)
+		}
+	default:
+		t.Fatal("Expected type watcher to receive an event")
+	}
+
+	writeTx = db.Transact(false)
+	writeTx.Set("test", &TestEntity{ID: "1", Name: "Watched", Value: 1})
+	writeTx.Commit()
+
+	select {
+	case ev := <-keyCh:
+		if ev.EntityType != "test" || ev.ID != "1" || ev.Entity.(*TestEntity).Name != "Watched" {
+			t.Errorf("Unexpected key event: %+v", ev)
+		}
+	default:
+		t.Fatal("Expected key watcher to receive an event")
+	}
+
+	writeTx = db.Transact(false)
+	writeTx.Delete("test", "1")
+	writeTx.Commit()
+
+	if ev := <-keyCh; ev.Operation != OpDelete {
+		t.Errorf("Expected delete event, got %+v", ev)
+	}
+
+	db.Unwatch(keyCh)
+	if _, ok := <-keyCh; ok {
+		t.Error("Expected channel to be closed after Unwatch")
+	}
+}